@@ -0,0 +1,293 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package apikeyprovider ...
+package apikeyprovider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/iamtoken"
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	apiKeyProvider "github.com/IBM/ibm-csi-common/provider"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// DefaultSocketPath is the unix socket the APIKeyProvider sidecar listens on
+	DefaultSocketPath = "/csi/provider.sock"
+
+	// DefaultShutdownTimeout is how long in-flight requests are waited for on shutdown
+	DefaultShutdownTimeout = 10 * time.Second
+
+	// DefaultWatchInterval is how often the sources are read to notify the WatchAPIKey clients of rotations
+	DefaultWatchInterval = 30 * time.Second
+
+	// tokenRefreshMargin is how long before their expiry the cached IAM tokens are exchanged again
+	tokenRefreshMargin = 5 * time.Minute
+
+	// socketPermissions only the user running the server and the driver may connect
+	socketPermissions = 0600
+)
+
+// Server is an APIKeyProvider gRPC server serving the API keys read from its sources.
+// A nil source is reported as not configured to the clients. If ClusterID is set, requests of another
+// cluster and requests without cluster ID are denied.
+type Server struct {
+	apiKeyProvider.UnimplementedAPIKeyProviderServer
+
+	VPCSource       KeySource
+	ContainerSource KeySource
+	ClusterID       string
+	ShutdownTimeout time.Duration
+	WatchInterval   time.Duration
+	Logger          *zap.Logger
+
+	// TokenExchangeURL is the IAM endpoint of GetIAMToken, iamtoken.DefaultTokenExchangeURL if empty
+	TokenExchangeURL string
+	HTTPClient       *http.Client
+
+	// stopping is closed on shutdown to end the WatchAPIKey streams
+	stopping chan struct{}
+	stopOnce sync.Once
+
+	tokensMutex sync.Mutex
+	// tokens are the IAM tokens by key type, i.e vpc, of the API key they were exchanged for
+	tokens map[string]*apiKeyProvider.IAMToken
+}
+
+var _ apiKeyProvider.APIKeyProviderServer = &Server{}
+
+// NewServer ...
+func NewServer(vpcSource KeySource, containerSource KeySource, logger *zap.Logger) *Server {
+	return &Server{
+		VPCSource:       vpcSource,
+		ContainerSource: containerSource,
+		ShutdownTimeout: DefaultShutdownTimeout,
+		WatchInterval:   DefaultWatchInterval,
+		Logger:          logger,
+		HTTPClient:      &http.Client{Timeout: 30 * time.Second},
+		stopping:        make(chan struct{}),
+		tokens:          map[string]*apiKeyProvider.IAMToken{},
+	}
+}
+
+// GetVPCAPIKey ...
+func (server *Server) GetVPCAPIKey(ctx context.Context, in *apiKeyProvider.Provider) (*apiKeyProvider.APIKey, error) {
+	if err := server.checkProvider(in, "vpc"); err != nil {
+		return nil, err
+	}
+	return server.getAPIKey(ctx, server.VPCSource, "vpc")
+}
+
+// GetContainerAPIKey ...
+func (server *Server) GetContainerAPIKey(ctx context.Context, in *apiKeyProvider.Provider) (*apiKeyProvider.APIKey, error) {
+	if err := server.checkProvider(in, "container"); err != nil {
+		return nil, err
+	}
+	return server.getAPIKey(ctx, server.ContainerSource, "container")
+}
+
+// GetIAMToken exchanges the requested API key for an IAM access token. Tokens are cached by API key
+// until shortly before they expire, a rotated key is exchanged right away.
+func (server *Server) GetIAMToken(ctx context.Context, in *apiKeyProvider.APIKeyRequest) (*apiKeyProvider.IAMToken, error) {
+	source, kind, err := server.getSource(in)
+	if err != nil {
+		return nil, err
+	}
+	apiKey, err := server.getAPIKey(ctx, source, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	server.tokensMutex.Lock()
+	token, ok := server.tokens[kind]
+	server.tokensMutex.Unlock()
+	if ok && token.GetKeyId() == apiKey.GetKeyId() && time.Now().Before(token.GetExpiresAt().AsTime().Add(-tokenRefreshMargin)) {
+		return token, nil
+	}
+	accessToken, expiresAt, err := iamtoken.ExchangeAPIKey(ctx, server.HTTPClient, server.TokenExchangeURL, apiKey.GetApikey(), server.Logger)
+	if err != nil {
+		server.Logger.Error("Failed to exchange API key for IAM token", zap.String("kind", kind), zap.String("keyID", apiKey.GetKeyId()), zap.Error(err))
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	token = &apiKeyProvider.IAMToken{AccessToken: accessToken, TokenType: "Bearer", ExpiresAt: timestamppb.New(expiresAt), KeyId: apiKey.GetKeyId()}
+	server.tokensMutex.Lock()
+	// Only the token of the current key of each type is kept
+	server.tokens[kind] = token
+	server.tokensMutex.Unlock()
+	return token, nil
+}
+
+// WatchAPIKey sends the current API key, then the new one whenever the source returns a different key.
+// The stream ends when the client cancels it or the server shuts down.
+func (server *Server) WatchAPIKey(in *apiKeyProvider.APIKeyRequest, stream apiKeyProvider.APIKeyProvider_WatchAPIKeyServer) error {
+	source, kind, err := server.getSource(in)
+	if err != nil {
+		return err
+	}
+	ctx := stream.Context()
+	current, err := server.getAPIKey(ctx, source, kind)
+	if err != nil {
+		return err
+	}
+	if err = stream.Send(current); err != nil {
+		return err
+	}
+
+	interval := server.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-server.stopping:
+			return nil
+		case <-ticker.C:
+			apiKey, err := server.getAPIKey(ctx, source, kind)
+			if err != nil || apiKey.GetKeyId() == current.GetKeyId() {
+				// A failing source is retried on the next tick, the client keeps the last key
+				continue
+			}
+			server.Logger.Info("API key rotated, notifying watcher", zap.String("kind", kind), zap.String("keyID", apiKey.GetKeyId()))
+			if err = stream.Send(apiKey); err != nil {
+				return err
+			}
+			current = apiKey
+		}
+	}
+}
+
+// getSource returns the source of the requested key type
+func (server *Server) getSource(in *apiKeyProvider.APIKeyRequest) (KeySource, string, error) {
+	switch in.GetKeyType() {
+	case apiKeyProvider.KeyType_VPC:
+		return server.VPCSource, "vpc", server.checkProvider(in.GetProvider(), "vpc")
+	case apiKeyProvider.KeyType_CONTAINER:
+		return server.ContainerSource, "container", server.checkProvider(in.GetProvider(), "container")
+	}
+	return nil, "", status.Errorf(codes.InvalidArgument, "Unknown key type %d", in.GetKeyType())
+}
+
+// checkProvider denies the requests of providers running in another cluster than ClusterID, or not telling their cluster
+func (server *Server) checkProvider(in *apiKeyProvider.Provider, kind string) error {
+	if server.ClusterID == "" || in.GetClusterId() == server.ClusterID {
+		return nil
+	}
+	if in.GetClusterId() == "" {
+		server.Logger.Warn("Denied API key request without cluster ID", zap.String("kind", kind), zap.String("providerName", in.GetProviderName()))
+		return status.Errorf(codes.PermissionDenied, "API keys of cluster %s are only served to requests carrying the cluster ID", server.ClusterID)
+	}
+	server.Logger.Warn("Denied API key request of another cluster", zap.String("kind", kind), zap.String("providerName", in.GetProviderName()), zap.String("clusterID", in.GetClusterId()))
+	return status.Errorf(codes.PermissionDenied, "API keys of cluster %s are not served to cluster %s", server.ClusterID, in.GetClusterId())
+}
+
+// getAPIKey reads the API key from source, the errors are mapped to gRPC status codes so clients can decide to retry
+func (server *Server) getAPIKey(ctx context.Context, source KeySource, kind string) (*apiKeyProvider.APIKey, error) {
+	if source == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "No %s API key source is configured", kind)
+	}
+	apiKey, err := source.GetAPIKey(ctx)
+	if err != nil {
+		server.Logger.Error("Failed to read API key", zap.String("kind", kind), zap.Error(err))
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &apiKeyProvider.APIKey{Apikey: apiKey, KeyId: KeyID(apiKey)}, nil
+}
+
+// KeyID identifies an API key without revealing it
+func KeyID(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Serve listens on the unix socket at socketPath and serves requests until ctx is done. On shutdown the
+// in-flight requests are given ShutdownTimeout to complete before they are cancelled and the connections closed.
+func (server *Server) Serve(ctx context.Context, socketPath string) error {
+	listener, err := Listen(socketPath)
+	if err != nil {
+		server.Logger.Error("Failed to listen on unix socket", zap.String("socketPath", socketPath), zap.Error(err))
+		return err
+	}
+
+	grpcServer := grpc.NewServer()
+	apiKeyProvider.RegisterAPIKeyProviderServer(grpcServer, server)
+	served := make(chan error, 1)
+	go func() {
+		served <- grpcServer.Serve(listener)
+	}()
+	server.Logger.Info("Serving APIKeyProvider", zap.String("socketPath", socketPath))
+
+	select {
+	case err = <-served:
+		server.Logger.Error("APIKeyProvider server stopped", zap.Error(err))
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := server.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	server.Stop()
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		server.Logger.Info("APIKeyProvider server stopped")
+	case <-time.After(timeout):
+		server.Logger.Warn("Timed out waiting for in-flight requests, closing connections", zap.Duration("timeout", timeout))
+		grpcServer.Stop()
+	}
+	return nil
+}
+
+// Stop ends the WatchAPIKey streams, Serve calls it on shutdown. It is for servers registered on another
+// gRPC server, i.e a bufconn one in tests, to be called before stopping it.
+func (server *Server) Stop() {
+	server.stopOnce.Do(func() {
+		if server.stopping != nil {
+			close(server.stopping)
+		}
+	})
+}
+
+// Listen creates the unix socket at socketPath, only accessible by its owner.
+// A socket left over by a previous run is removed, any other file at socketPath is an error.
+func Listen(socketPath string) (net.Listener, error) {
+	return utils.ListenUnixSocket(socketPath, socketPermissions)
+}
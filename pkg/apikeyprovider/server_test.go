@@ -0,0 +1,368 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package apikeyprovider ...
+package apikeyprovider
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/ibmcloudprovider/fakevpcserver"
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	apiKeyProvider "github.com/IBM/ibm-csi-common/provider"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// blockingSource blocks until released, to test the graceful shutdown
+type blockingSource struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (source *blockingSource) GetAPIKey(ctx context.Context) (string, error) {
+	close(source.started)
+	select {
+	case <-source.release:
+		return "slow-key", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// errorSource ...
+type errorSource struct {
+	err error
+}
+
+func (source *errorSource) GetAPIKey(ctx context.Context) (string, error) {
+	return "", source.err
+}
+
+// startServer serves server on a temporary unix socket, returns a client and the channel receiving the Serve error
+func startServer(t *testing.T, ctx context.Context, server *Server) (apiKeyProvider.APIKeyProviderClient, string, chan error) {
+	socketPath := filepath.Join(t.TempDir(), "provider.sock")
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx, socketPath) }()
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(socketPath)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	conn, err := grpc.NewClient("unix://"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return apiKeyProvider.NewAPIKeyProviderClient(conn), socketPath, served
+}
+
+func TestServer(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	t.Setenv("TEST_APIKEY_PROVIDER_KEY", "container-key")
+	server := NewServer(&errorSource{err: ErrAPIKeyNotFound}, &EnvSource{Name: "TEST_APIKEY_PROVIDER_KEY"}, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, socketPath, served := startServer(t, ctx, server)
+
+	info, err := os.Stat(socketPath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	apiKey, err := client.GetContainerAPIKey(ctx, &apiKeyProvider.Provider{})
+	assert.Nil(t, err)
+	assert.Equal(t, "container-key", apiKey.GetApikey())
+	assert.Equal(t, KeyID("container-key"), apiKey.GetKeyId())
+	assert.NotContains(t, apiKey.GetKeyId(), "container-key")
+
+	testCases := []struct {
+		testCaseName string
+		source       KeySource
+		expectedCode codes.Code
+	}{
+		{
+			testCaseName: "Not found",
+			source:       &errorSource{err: ErrAPIKeyNotFound},
+			expectedCode: codes.NotFound,
+		},
+		{
+			testCaseName: "Source failure",
+			source:       &errorSource{err: errors.New("permission denied")},
+			expectedCode: codes.Unavailable,
+		},
+		{
+			testCaseName: "Not configured",
+			expectedCode: codes.FailedPrecondition,
+		},
+	}
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			server.VPCSource = testcase.source
+			_, err := client.GetVPCAPIKey(ctx, &apiKeyProvider.Provider{})
+			assert.Equal(t, testcase.expectedCode, status.Code(err))
+		})
+	}
+
+	// Requests of another cluster or without cluster are denied
+	server.ClusterID = "myclusterid"
+	clusterTestCases := []struct {
+		testCaseName string
+		provider     *apiKeyProvider.Provider
+		expectedCode codes.Code
+	}{
+		{testCaseName: "Same cluster", provider: &apiKeyProvider.Provider{ProviderName: "vpc", ClusterId: "myclusterid"}, expectedCode: codes.OK},
+		{testCaseName: "No cluster", provider: &apiKeyProvider.Provider{ProviderName: "vpc"}, expectedCode: codes.PermissionDenied},
+		{testCaseName: "Other cluster", provider: &apiKeyProvider.Provider{ProviderName: "vpc", ClusterId: "otherclusterid"}, expectedCode: codes.PermissionDenied},
+	}
+	for _, testcase := range clusterTestCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			_, err := client.GetContainerAPIKey(ctx, testcase.provider)
+			assert.Equal(t, testcase.expectedCode, status.Code(err))
+			_, err = client.GetIAMToken(ctx, &apiKeyProvider.APIKeyRequest{Provider: testcase.provider, KeyType: apiKeyProvider.KeyType_VPC})
+			if testcase.expectedCode == codes.OK {
+				// VPC source is not configured
+				assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+			} else {
+				assert.Equal(t, testcase.expectedCode, status.Code(err))
+			}
+		})
+	}
+
+	cancel()
+	assert.Nil(t, <-served)
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestServerGracefulShutdown(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	source := &blockingSource{started: make(chan struct{}), release: make(chan struct{})}
+	server := NewServer(source, nil, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, _, served := startServer(t, ctx, server)
+
+	// In-flight request completes after shutdown started
+	response := make(chan string, 1)
+	go func() {
+		apiKey, _ := client.GetVPCAPIKey(context.Background(), &apiKeyProvider.Provider{})
+		response <- apiKey.GetApikey()
+	}()
+	<-source.started
+	cancel()
+	select {
+	case <-served:
+		t.Fatal("Server stopped before the in-flight request completed")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(source.release)
+	assert.Equal(t, "slow-key", <-response)
+	assert.Nil(t, <-served)
+
+	// In-flight requests are cancelled once the shutdown timeout expires
+	source = &blockingSource{started: make(chan struct{}), release: make(chan struct{})}
+	defer close(source.release)
+	server = NewServer(source, nil, logger)
+	server.ShutdownTimeout = 100 * time.Millisecond
+	ctx, cancel = context.WithCancel(context.Background())
+	client, _, served = startServer(t, ctx, server)
+	go func() { _, _ = client.GetVPCAPIKey(context.Background(), &apiKeyProvider.Provider{}) }()
+	<-source.started
+	cancel()
+	select {
+	case err := <-served:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop after the shutdown timeout")
+	}
+}
+
+func TestWatchAPIKey(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	keyPath := filepath.Join(t.TempDir(), "apikey")
+	assert.Nil(t, os.WriteFile(keyPath, []byte("container-key"), 0600))
+	server := NewServer(nil, &FileSource{Path: keyPath}, logger)
+	server.WatchInterval = 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, _, served := startServer(t, ctx, server)
+
+	// VPC source is not configured
+	vpcStream, err := client.WatchAPIKey(ctx, &apiKeyProvider.APIKeyRequest{})
+	assert.Nil(t, err)
+	_, err = vpcStream.Recv()
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	unknownStream, err := client.WatchAPIKey(ctx, &apiKeyProvider.APIKeyRequest{KeyType: apiKeyProvider.KeyType(7)})
+	assert.Nil(t, err)
+	_, err = unknownStream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := client.WatchAPIKey(ctx, &apiKeyProvider.APIKeyRequest{KeyType: apiKeyProvider.KeyType_CONTAINER})
+	assert.Nil(t, err)
+	apiKey, err := stream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, "container-key", apiKey.GetApikey())
+
+	// Only rotations are sent, a failing source is skipped
+	assert.Nil(t, os.Remove(keyPath))
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, os.WriteFile(keyPath, []byte("rotated-key"), 0600))
+	apiKey, err = stream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, "rotated-key", apiKey.GetApikey())
+	assert.Equal(t, KeyID("rotated-key"), apiKey.GetKeyId())
+
+	// Watchers do not delay the shutdown
+	cancel()
+	select {
+	case err = <-served:
+		assert.Nil(t, err)
+	case <-time.After(DefaultShutdownTimeout / 2):
+		t.Fatal("Server shutdown waited for the watchers")
+	}
+}
+
+func TestGetIAMToken(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	iam := fakevpcserver.NewServer()
+	defer iam.Close()
+	keyPath := filepath.Join(t.TempDir(), "apikey")
+	assert.Nil(t, os.WriteFile(keyPath, []byte(fakevpcserver.DefaultAPIKey), 0600))
+	server := NewServer(&FileSource{Path: keyPath}, &FileSource{Path: keyPath}, logger)
+	server.TokenExchangeURL = iam.URL
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, _, _ := startServer(t, ctx, server)
+
+	token, err := client.GetIAMToken(ctx, &apiKeyProvider.APIKeyRequest{})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, token.GetAccessToken())
+	assert.Equal(t, "Bearer", token.GetTokenType())
+	assert.Equal(t, KeyID(fakevpcserver.DefaultAPIKey), token.GetKeyId())
+	assert.WithinDuration(t, time.Now().Add(iam.TokenTTL), token.GetExpiresAt().AsTime(), 2*time.Second)
+
+	// Cached until it is about to expire
+	cached, err := client.GetIAMToken(ctx, &apiKeyProvider.APIKeyRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, token.GetAccessToken(), cached.GetAccessToken())
+	assert.Equal(t, 1, iam.RequestCount(fakevpcserver.RouteIAMToken))
+
+	// Tokens of each key type are cached separately
+	containerRequest := &apiKeyProvider.APIKeyRequest{KeyType: apiKeyProvider.KeyType_CONTAINER}
+	for i := 0; i < 2; i++ {
+		_, err = client.GetIAMToken(ctx, containerRequest)
+		assert.Nil(t, err)
+		cached, err = client.GetIAMToken(ctx, &apiKeyProvider.APIKeyRequest{})
+		assert.Nil(t, err)
+		assert.Equal(t, token.GetAccessToken(), cached.GetAccessToken())
+	}
+	assert.Equal(t, 2, iam.RequestCount(fakevpcserver.RouteIAMToken))
+
+	// Rotated key is exchanged right away, IAM rejections are reported as unavailable
+	assert.Nil(t, os.WriteFile(keyPath, []byte("rotated-key"), 0600))
+	_, err = client.GetIAMToken(ctx, &apiKeyProvider.APIKeyRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 3, iam.RequestCount(fakevpcserver.RouteIAMToken))
+}
+
+func TestServerStop(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	// Watch streams of a server registered on another gRPC server end on Stop
+	t.Setenv("TEST_APIKEY_PROVIDER_KEY", "vpc-key")
+	server := NewServer(&EnvSource{Name: "TEST_APIKEY_PROVIDER_KEY"}, nil, logger)
+	listener, err := Listen(filepath.Join(t.TempDir(), "provider.sock"))
+	assert.Nil(t, err)
+	grpcServer := grpc.NewServer()
+	apiKeyProvider.RegisterAPIKeyProviderServer(grpcServer, server)
+	go func() { _ = grpcServer.Serve(listener) }()
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient("unix://"+listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+	stream, err := apiKeyProvider.NewAPIKeyProviderClient(conn).WatchAPIKey(context.Background(), &apiKeyProvider.APIKeyRequest{})
+	assert.Nil(t, err)
+	_, err = stream.Recv()
+	assert.Nil(t, err)
+	server.Stop()
+	server.Stop()
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+
+	// Stale socket is replaced
+	socketPath := filepath.Join(dir, "sockets", "provider.sock")
+	listener, err := Listen(socketPath)
+	assert.Nil(t, err)
+	if unixListener, ok := listener.(interface{ SetUnlinkOnClose(bool) }); ok {
+		unixListener.SetUnlinkOnClose(false)
+	}
+	assert.Nil(t, listener.Close())
+	listener, err = Listen(socketPath)
+	assert.Nil(t, err)
+	assert.Nil(t, listener.Close())
+
+	// Regular file is never removed
+	filePath := filepath.Join(dir, "provider.sock")
+	assert.Nil(t, os.WriteFile(filePath, []byte("data"), 0600))
+	_, err = Listen(filePath)
+	assert.NotNil(t, err)
+	_, err = os.Stat(filePath)
+	assert.Nil(t, err)
+}
+
+func TestRun(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	err := Run(context.Background(), Options{SocketPath: filepath.Join(t.TempDir(), "provider.sock")}, logger)
+	assert.NotNil(t, err)
+	err = Run(context.Background(), Options{SocketPath: filepath.Join(t.TempDir(), "provider.sock"), VPCSource: "vault:apikey"}, logger)
+	assert.NotNil(t, err)
+
+	t.Setenv(SocketPathEnv, "")
+	t.Setenv(ShutdownTimeoutEnv, "30s")
+	t.Setenv(VPCSourceEnv, "env:VPC_API_KEY")
+	t.Setenv(ClusterIDEnv, "myclusterid")
+	t.Setenv(TokenExchangeURLEnv, "https://iam.test.cloud.ibm.com")
+	options, err := OptionsFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, Options{SocketPath: DefaultSocketPath, VPCSource: "env:VPC_API_KEY", ShutdownTimeout: 30 * time.Second, KubeConfig: os.Getenv(KubeConfigEnv),
+		ClusterID: "myclusterid", TokenExchangeURL: "https://iam.test.cloud.ibm.com"}, options)
+	t.Setenv(ShutdownTimeoutEnv, "soon")
+	_, err = OptionsFromEnv()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,189 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package apikeyprovider ...
+package apikeyprovider
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	fileSourcePrefix   = "file:"
+	envSourcePrefix    = "env:"
+	secretSourcePrefix = "secret:"
+)
+
+// ErrAPIKeyNotFound is returned by a KeySource which has no API key to serve
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// KeySource provides the API key served by the APIKeyProvider server
+type KeySource interface {
+	// GetAPIKey returns the current API key
+	GetAPIKey(ctx context.Context) (string, error)
+}
+
+// FileSource reads the API key from a file on every call, i.e a mounted secret key
+type FileSource struct {
+	Path string
+}
+
+// GetAPIKey ...
+func (source *FileSource) GetAPIKey(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(filepath.Clean(source.Path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: file %s does not exist", ErrAPIKeyNotFound, source.Path)
+		}
+		return "", err
+	}
+	apiKey := strings.TrimSpace(string(data))
+	if apiKey == "" {
+		return "", fmt.Errorf("%w: file %s is empty", ErrAPIKeyNotFound, source.Path)
+	}
+	return apiKey, nil
+}
+
+// EnvSource reads the API key from an environment variable
+type EnvSource struct {
+	Name string
+}
+
+// GetAPIKey ...
+func (source *EnvSource) GetAPIKey(ctx context.Context) (string, error) {
+	apiKey := strings.TrimSpace(os.Getenv(source.Name))
+	if apiKey == "" {
+		return "", fmt.Errorf("%w: environment variable %s is not set", ErrAPIKeyNotFound, source.Name)
+	}
+	return apiKey, nil
+}
+
+// SecretSource serves the API key stored under a key of a Kubernetes secret.
+// The secret is watched, so updates are served without reading the API server on every call.
+type SecretSource struct {
+	Namespace string
+	Name      string
+	Key       string
+
+	mutex  sync.RWMutex
+	apiKey string
+}
+
+// WatchSecret starts watching the secret and returns once the informer cache is synced.
+// The secret does not need to exist yet. The watch is stopped when ctx is cancelled.
+func WatchSecret(ctx context.Context, clientset kubernetes.Interface, namespace, name, key string, logger *zap.Logger) (*SecretSource, error) {
+	source := &SecretSource{Namespace: namespace, Name: name, Key: key}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(namespace), informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+	}))
+	informer := factory.Core().V1().Secrets().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			source.onUpdate(obj, logger)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			source.onUpdate(newObj, logger)
+		},
+		DeleteFunc: func(obj interface{}) {
+			logger.Warn("API key secret deleted", zap.String("namespace", namespace), zap.String("name", name))
+			source.set("")
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return nil, errors.New("Failed to sync secret informer cache")
+	}
+	go func() {
+		<-ctx.Done()
+		factory.Shutdown()
+	}()
+	logger.Info("Started watching API key secret", zap.String("namespace", namespace), zap.String("name", name), zap.String("key", key))
+	return source, nil
+}
+
+// onUpdate stores the API key of the updated secret
+func (source *SecretSource) onUpdate(obj interface{}, logger *zap.Logger) {
+	secret, ok := obj.(*v1.Secret)
+	if !ok || secret.Name != source.Name {
+		return
+	}
+	apiKey := strings.TrimSpace(string(secret.Data[source.Key]))
+	if apiKey == "" {
+		logger.Warn("API key secret has no value for the key", zap.String("namespace", source.Namespace), zap.String("name", source.Name), zap.String("key", source.Key))
+	}
+	source.set(apiKey)
+}
+
+// set ...
+func (source *SecretSource) set(apiKey string) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	source.apiKey = apiKey
+}
+
+// GetAPIKey ...
+func (source *SecretSource) GetAPIKey(ctx context.Context) (string, error) {
+	source.mutex.RLock()
+	defer source.mutex.RUnlock()
+	if source.apiKey == "" {
+		return "", fmt.Errorf("%w: secret %s/%s has no key %s", ErrAPIKeyNotFound, source.Namespace, source.Name, source.Key)
+	}
+	return source.apiKey, nil
+}
+
+// ParseSource builds a KeySource from its description:
+//   - file:<path> reads the file
+//   - env:<name> reads the environment variable
+//   - secret:<namespace>/<name>/<key> watches the secret, the client is created by getClient
+func ParseSource(ctx context.Context, spec string, getClient func() (kubernetes.Interface, error), logger *zap.Logger) (KeySource, error) {
+	switch {
+	case strings.HasPrefix(spec, fileSourcePrefix) && len(spec) > len(fileSourcePrefix):
+		return &FileSource{Path: strings.TrimPrefix(spec, fileSourcePrefix)}, nil
+	case strings.HasPrefix(spec, envSourcePrefix) && len(spec) > len(envSourcePrefix):
+		return &EnvSource{Name: strings.TrimPrefix(spec, envSourcePrefix)}, nil
+	case strings.HasPrefix(spec, secretSourcePrefix):
+		parts := strings.Split(strings.TrimPrefix(spec, secretSourcePrefix), "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("Invalid secret API key source '%s', expected secret:<namespace>/<name>/<key>", spec)
+		}
+		clientset, err := getClient()
+		if err != nil {
+			logger.Error("Failed to create kubernetes client", zap.Error(err))
+			return nil, err
+		}
+		return WatchSecret(ctx, clientset, parts[0], parts[1], parts[2], logger)
+	}
+	return nil, fmt.Errorf("Invalid API key source '%s', expected file:<path>, env:<name> or secret:<namespace>/<name>/<key>", spec)
+}
@@ -0,0 +1,155 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package apikeyprovider ...
+package apikeyprovider
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFileAndEnvSource(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "apikey")
+	fileSource := &FileSource{Path: keyPath}
+	_, err := fileSource.GetAPIKey(context.Background())
+	assert.True(t, errors.Is(err, ErrAPIKeyNotFound))
+	assert.Nil(t, os.WriteFile(keyPath, []byte("file-key\n"), 0600))
+	apiKey, err := fileSource.GetAPIKey(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "file-key", apiKey)
+
+	envSource := &EnvSource{Name: "TEST_APIKEY_PROVIDER_KEY"}
+	_, err = envSource.GetAPIKey(context.Background())
+	assert.True(t, errors.Is(err, ErrAPIKeyNotFound))
+	t.Setenv("TEST_APIKEY_PROVIDER_KEY", "env-key")
+	apiKey, err = envSource.GetAPIKey(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "env-key", apiKey)
+}
+
+func TestWatchSecret(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "storage-secret-store", Namespace: "kube-system"},
+		Data:       map[string][]byte{"apikey": []byte("secret-key")},
+	}
+	clientset := fake.NewSimpleClientset(secret, &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "other-secret", Namespace: "kube-system"},
+		Data:       map[string][]byte{"apikey": []byte("other-key")},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source, err := WatchSecret(ctx, clientset, "kube-system", "storage-secret-store", "apikey", logger)
+	assert.Nil(t, err)
+	apiKey, err := source.GetAPIKey(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret-key", apiKey)
+
+	// Rotated key is served once the update is received
+	secret.Data["apikey"] = []byte("rotated-key")
+	_, err = clientset.CoreV1().Secrets("kube-system").Update(ctx, secret, metav1.UpdateOptions{})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		apiKey, _ := source.GetAPIKey(ctx)
+		return apiKey == "rotated-key"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Deleted secret
+	err = clientset.CoreV1().Secrets("kube-system").Delete(ctx, "storage-secret-store", metav1.DeleteOptions{})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := source.GetAPIKey(ctx)
+		return errors.Is(err, ErrAPIKeyNotFound)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestParseSource(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	clientset := fake.NewSimpleClientset()
+	getClient := func() (kubernetes.Interface, error) { return clientset, nil }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testCases := []struct {
+		testCaseName   string
+		spec           string
+		expectedSource KeySource
+		expectedErr    bool
+	}{
+		{
+			testCaseName:   "File",
+			spec:           "file:/var/run/secrets/apikey",
+			expectedSource: &FileSource{Path: "/var/run/secrets/apikey"},
+		},
+		{
+			testCaseName:   "Env",
+			spec:           "env:VPC_API_KEY",
+			expectedSource: &EnvSource{Name: "VPC_API_KEY"},
+		},
+		{
+			testCaseName: "Secret",
+			spec:         "secret:kube-system/storage-secret-store/apikey",
+		},
+		{
+			testCaseName: "Secret without key",
+			spec:         "secret:kube-system/storage-secret-store",
+			expectedErr:  true,
+		},
+		{
+			testCaseName: "Empty file path",
+			spec:         "file:",
+			expectedErr:  true,
+		},
+		{
+			testCaseName: "Unknown",
+			spec:         "vault:apikey",
+			expectedErr:  true,
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			source, err := ParseSource(ctx, testcase.spec, getClient, logger)
+			if testcase.expectedErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			if testcase.expectedSource != nil {
+				assert.Equal(t, testcase.expectedSource, source)
+			} else {
+				assert.IsType(t, &SecretSource{}, source)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package apikeyprovider ...
+package apikeyprovider
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/metadata"
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// SocketPathEnv is the environment variable carrying the unix socket path
+	SocketPathEnv = "APIKEY_PROVIDER_SOCKET_PATH"
+
+	// VPCSourceEnv is the environment variable carrying the VPC API key source, see ParseSource
+	VPCSourceEnv = "VPC_API_KEY_SOURCE"
+
+	// ContainerSourceEnv is the environment variable carrying the container API key source, see ParseSource
+	ContainerSourceEnv = "CONTAINER_API_KEY_SOURCE"
+
+	// ShutdownTimeoutEnv is the environment variable carrying the shutdown timeout i.e 30s
+	ShutdownTimeoutEnv = "APIKEY_PROVIDER_SHUTDOWN_TIMEOUT"
+
+	// ClusterIDEnv is the environment variable carrying the cluster ID the API keys are served to, see Server.ClusterID
+	ClusterIDEnv = "CLUSTER_ID"
+
+	// TokenExchangeURLEnv is the environment variable carrying the IAM endpoint of GetIAMToken
+	TokenExchangeURLEnv = "IAM_TOKEN_EXCHANGE_URL"
+
+	// KubeConfigEnv is the environment variable carrying the kubeconfig path, in-cluster config is used if not set
+	KubeConfigEnv = "KUBECONFIG"
+)
+
+// Options configures a standalone APIKeyProvider server
+type Options struct {
+	SocketPath       string
+	VPCSource        string
+	ContainerSource  string
+	ShutdownTimeout  time.Duration
+	KubeConfig       string
+	ClusterID        string
+	TokenExchangeURL string
+}
+
+// OptionsFromEnv reads the options from the environment, using the defaults for the unset ones
+func OptionsFromEnv() (Options, error) {
+	options := Options{
+		SocketPath:       os.Getenv(SocketPathEnv),
+		VPCSource:        os.Getenv(VPCSourceEnv),
+		ContainerSource:  os.Getenv(ContainerSourceEnv),
+		ShutdownTimeout:  DefaultShutdownTimeout,
+		KubeConfig:       os.Getenv(KubeConfigEnv),
+		ClusterID:        os.Getenv(ClusterIDEnv),
+		TokenExchangeURL: os.Getenv(TokenExchangeURLEnv),
+	}
+	if options.SocketPath == "" {
+		options.SocketPath = DefaultSocketPath
+	}
+	if timeout := os.Getenv(ShutdownTimeoutEnv); timeout != "" {
+		var err error
+		if options.ShutdownTimeout, err = time.ParseDuration(timeout); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+// Run builds the sources described by options and serves the API keys until ctx is done.
+// At least one source must be configured.
+func Run(ctx context.Context, options Options, logger *zap.Logger) error {
+	if options.VPCSource == "" && options.ContainerSource == "" {
+		return errors.New("No API key source is configured")
+	}
+	getClient := func() (kubernetes.Interface, error) {
+		return metadata.NewKubeClient("", options.KubeConfig)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var sources [2]KeySource
+	for i, spec := range []string{options.VPCSource, options.ContainerSource} {
+		if spec == "" {
+			continue
+		}
+		source, err := ParseSource(ctx, spec, getClient, logger)
+		if err != nil {
+			logger.Error("Failed to create API key source", zap.Error(err))
+			return err
+		}
+		sources[i] = source
+	}
+
+	server := NewServer(sources[0], sources[1], logger)
+	server.ClusterID, server.TokenExchangeURL = options.ClusterID, options.TokenExchangeURL
+	if options.ShutdownTimeout > 0 {
+		server.ShutdownTimeout = options.ShutdownTimeout
+	}
+	return server.Serve(ctx, options.SocketPath)
+}
+
+// Main runs the server as a standalone binary configured by the environment, until SIGINT or SIGTERM is received.
+// A sidecar binary only needs to call it and exit with a non zero code if it returns an error.
+func Main() error {
+	logger, _ := utils.GetContextLogger(context.Background(), false)
+	defer func() { _ = logger.Sync() }()
+
+	options, err := OptionsFromEnv()
+	if err != nil {
+		logger.Error("Invalid APIKeyProvider options", zap.Error(err))
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return Run(ctx, options, logger)
+}
@@ -0,0 +1,112 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package iamtoken exchanges API keys and other credentials for IAM access tokens
+package iamtoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	util "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+	"github.com/IBM/ibmcloud-volume-interface/lib/utils/reasoncode"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultTokenExchangeURL is the IAM endpoint used if no token exchange URL is configured
+	DefaultTokenExchangeURL = "https://iam.cloud.ibm.com"
+
+	// apiKeyGrantType is the IAM grant type exchanging an API key for an access token
+	apiKeyGrantType = "urn:ibm:params:oauth:grant-type:apikey"
+
+	tokenPath       = "/identity/token"
+	maxResponseSize = 1 << 20
+)
+
+// TokenURL returns the token URL of the IAM endpoint tokenExchangeURL, DefaultTokenExchangeURL if empty
+func TokenURL(tokenExchangeURL string) string {
+	if tokenExchangeURL == "" {
+		tokenExchangeURL = DefaultTokenExchangeURL
+	}
+	return strings.TrimSuffix(tokenExchangeURL, "/") + tokenPath
+}
+
+// ExchangeAPIKey exchanges the API key for an IAM access token at the IAM endpoint tokenExchangeURL,
+// DefaultTokenExchangeURL if empty. Failures are ErrorFailedTokenExchange provider errors.
+func ExchangeAPIKey(ctx context.Context, client *http.Client, tokenExchangeURL string, apiKey string, logger *zap.Logger) (string, time.Time, error) {
+	return Request(ctx, client, TokenURL(tokenExchangeURL), url.Values{
+		"grant_type": {apiKeyGrantType},
+		"apikey":     {apiKey},
+	}, logger)
+}
+
+// Request posts the token request form to the IAM token URL and returns the access token and its expiry.
+// Unreachable IAM and rejected requests are ErrorFailedTokenExchange provider errors.
+func Request(ctx context.Context, client *http.Client, tokenURL string, form url.Values, logger *zap.Logger) (string, time.Time, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		logger.Error("IAM token exchange request failed", zap.String("url", tokenURL), zap.Error(err))
+		return "", time.Time{}, util.NewError(reasoncode.ErrorFailedTokenExchange, "IAM token exchange request failed", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		iamError := struct {
+			ErrorCode    string `json:"errorCode"`
+			ErrorMessage string `json:"errorMessage"`
+		}{}
+		_ = json.Unmarshal(body, &iamError)
+		logger.Error("IAM rejected the token exchange request", zap.String("grantType", form.Get("grant_type")), zap.Int("statusCode", response.StatusCode),
+			zap.String("errorCode", iamError.ErrorCode), zap.String("errorMessage", iamError.ErrorMessage))
+		return "", time.Time{}, util.NewError(reasoncode.ErrorFailedTokenExchange,
+			fmt.Sprintf("IAM token exchange request failed with status %d: %s %s", response.StatusCode, iamError.ErrorCode, iamError.ErrorMessage))
+	}
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Expiration  int64  `json:"expiration"`
+	}{}
+	if err = json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return "", time.Time{}, util.NewError(reasoncode.ErrorFailedTokenExchange, "Unexpected IAM token exchange response", err)
+	}
+	expiresAt := time.Unix(token.Expiration, 0)
+	if token.Expiration == 0 {
+		expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token.AccessToken, expiresAt, nil
+}
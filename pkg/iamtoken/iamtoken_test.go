@@ -0,0 +1,66 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package iamtoken ...
+package iamtoken
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/ibmcloudprovider/fakevpcserver"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/utils/reasoncode"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTokenURL(t *testing.T) {
+	assert.Equal(t, "https://iam.cloud.ibm.com/identity/token", TokenURL(""))
+	assert.Equal(t, "https://iam.test.cloud.ibm.com/identity/token", TokenURL("https://iam.test.cloud.ibm.com/"))
+}
+
+func TestExchangeAPIKey(t *testing.T) {
+	iam := fakevpcserver.NewServer()
+	defer iam.Close()
+
+	testCases := []struct {
+		testCaseName string
+		url          string
+		apiKey       string
+		expectedErr  bool
+	}{
+		{testCaseName: "Exchanged", url: iam.URL, apiKey: fakevpcserver.DefaultAPIKey},
+		{testCaseName: "Rejected API key", url: iam.URL, apiKey: "wrong-api-key", expectedErr: true},
+		{testCaseName: "IAM unreachable", url: "http://127.0.0.1:1", apiKey: fakevpcserver.DefaultAPIKey, expectedErr: true},
+	}
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			accessToken, expiresAt, err := ExchangeAPIKey(context.Background(), nil, testcase.url, testcase.apiKey, zap.NewNop())
+			if testcase.expectedErr {
+				assert.NotNil(t, err)
+				providerErr, ok := err.(provider.Error)
+				assert.True(t, ok)
+				assert.Equal(t, reasoncode.ErrorFailedTokenExchange, providerErr.Code())
+				return
+			}
+			assert.Nil(t, err)
+			assert.NotEmpty(t, accessToken)
+			assert.WithinDuration(t, time.Now().Add(iam.TokenTTL), expiresAt, 2*time.Second)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// DefaultConfigReloadDelay secrets and config maps are updated by kubelet with several file operations,
+	// the reload waits for them to settle
+	DefaultConfigReloadDelay = 2 * time.Second
+
+	// ConfigReloadedEventReason ...
+	ConfigReloadedEventReason = "ProviderConfigReloaded"
+
+	// ConfigRejectedEventReason ...
+	ConfigRejectedEventReason = "ProviderConfigRejected"
+)
+
+// ReloadConfig re-reads slclient.toml and the cluster info. If they changed and are valid, the configuration
+// is replaced and the cached session is invalidated so the next one uses the new credentials. An invalid
+// content is rejected and the current configuration kept, the same invalid content is reported only once.
+// Returns true if the configuration was replaced.
+func (icp *IBMCloudStorageProvider) ReloadConfig(logger *zap.Logger) (bool, error) {
+	files, err := readProviderFiles(icp.configPath, icp.credentialSource == nil, logger)
+	if files == nil {
+		return false, err
+	}
+
+	icp.configMutex.Lock()
+	if files.hash == icp.configHash || files.hash == icp.rejectedHash {
+		icp.configMutex.Unlock()
+		return false, nil
+	}
+	if err == nil && files.providerName != icp.ProviderName {
+		err = fmt.Errorf("Provider change from '%s' to '%s' requires a restart", icp.ProviderName, files.providerName)
+	}
+	if err == nil && files.clusterInfo.ClusterID != icp.ClusterInfo.ClusterID {
+		err = fmt.Errorf("Cluster ID change from '%s' to '%s' requires a restart", icp.ClusterInfo.ClusterID, files.clusterInfo.ClusterID)
+	}
+	if err != nil {
+		icp.rejectedHash = files.hash
+		icp.configMutex.Unlock()
+		return false, err
+	}
+	icp.ProviderConfig, icp.ClusterInfo = files.conf, files.clusterInfo
+	icp.tokenSource = files.newAccessTokenSource()
+	icp.configHash, icp.rejectedHash = files.hash, ""
+	icp.configMutex.Unlock()
+
+	icp.resetSession()
+	return true, nil
+}
+
+// WatchConfig reloads the configuration whenever slclient.toml or the secret directory changes, until ctx is done.
+// Every reload or rejection is logged and recorded as an event of object, if recorder is not nil.
+func (icp *IBMCloudStorageProvider) WatchConfig(ctx context.Context, logger *zap.Logger, recorder record.EventRecorder, object runtime.Object) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	configDir := utils.GetConfigDir()
+	for _, dir := range uniqueDirs(filepath.Dir(icp.configPath), configDir, filepath.Dir(utils.GetClusterInfoPath(configDir))) {
+		if err = watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			logger.Error("Failed to watch provider configuration", zap.String("dir", dir), zap.Error(err))
+			return err
+		}
+	}
+
+	delay := icp.ConfigReloadDelay
+	if delay <= 0 {
+		delay = DefaultConfigReloadDelay
+	}
+	logger.Info("Watching provider configuration", zap.String("configPath", icp.configPath), zap.String("configDir", configDir))
+	go func() {
+		defer watcher.Close()
+		var timer *time.Timer
+		var reload <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				logger.Debug("Provider configuration event", zap.String("event", event.String()))
+				if timer == nil {
+					timer = time.NewTimer(delay)
+				} else {
+					timer.Reset(delay)
+				}
+				reload = timer.C
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("Error while watching provider configuration", zap.Error(err))
+			case <-reload:
+				reload = nil
+				icp.reloadAndRecord(logger, recorder, object)
+			}
+		}
+	}()
+	return nil
+}
+
+// reloadAndRecord reloads the configuration, logging and recording the outcome
+func (icp *IBMCloudStorageProvider) reloadAndRecord(logger *zap.Logger, recorder record.EventRecorder, object runtime.Object) {
+	reloaded, err := icp.ReloadConfig(logger)
+	switch {
+	case err != nil:
+		logger.Error("Rejected provider configuration change, keeping the current configuration", zap.String("configPath", icp.configPath), zap.Error(err))
+		if recorder != nil {
+			recorder.Eventf(object, v1.EventTypeWarning, ConfigRejectedEventReason, "Rejected provider configuration change: %v", err)
+		}
+	case reloaded:
+		logger.Info("Reloaded provider configuration", zap.String("configPath", icp.configPath), zap.String("providerName", icp.ProviderName))
+		if recorder != nil {
+			recorder.Event(object, v1.EventTypeNormal, ConfigReloadedEventReason, "Reloaded provider configuration")
+		}
+	}
+}
+
+// uniqueDirs ...
+func uniqueDirs(dirs ...string) []string {
+	var unique []string
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if !contains(unique, dir) {
+			unique = append(unique, dir)
+		}
+	}
+	return unique
+}
+
+// contains ...
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	"github.com/IBM/ibmcloud-volume-interface/provider/local/fakes"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// setupConfigDir copies the test fixtures into a temporary secret directory and returns the slclient.toml path
+func setupConfigDir(t *testing.T) string {
+	configDir := t.TempDir()
+	t.Setenv(utils.SecretConfigPathEnv, configDir)
+	clusterInfoPath := utils.GetClusterInfoPath(configDir)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(clusterInfoPath), 0750))
+	clusterInfo, err := os.ReadFile(filepath.Join(testFixtures, "valid", "cluster_info", "cluster-config.json"))
+	assert.Nil(t, err)
+	writeFile(t, clusterInfoPath, string(clusterInfo))
+
+	configPath := filepath.Join(configDir, "slclient.toml")
+	writeFile(t, configPath, readFixtureConfig(t))
+	return configPath
+}
+
+// readFixtureConfig ...
+func readFixtureConfig(t *testing.T) string {
+	data, err := os.ReadFile(filepath.Join(testFixtures, "slconfig.toml"))
+	assert.Nil(t, err)
+	return string(data)
+}
+
+// writeFile replaces the file with a rename, as kubelet does when updating secrets
+func writeFile(t *testing.T, path string, content string) {
+	tmpPath := path + ".tmp"
+	assert.Nil(t, os.WriteFile(tmpPath, []byte(content), 0600))
+	assert.Nil(t, os.Rename(tmpPath, path))
+}
+
+func TestReloadConfig(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	configPath := setupConfigDir(t)
+	clusterInfoPath := utils.GetClusterInfoPath(utils.GetConfigDir())
+	fixtureConfig := readFixtureConfig(t)
+	clusterInfo, _ := os.ReadFile(clusterInfoPath)
+	cloudProvider, err := NewIBMCloudStorageProvider(configPath, &fakes.Provider{}, logger)
+	assert.Nil(t, err)
+	cloudProvider.session = &fake.FakeSession{}
+
+	testCases := []struct {
+		testCaseName       string
+		config             string
+		clusterInfo        string
+		expectedReloaded   bool
+		expectedErr        bool
+		expectedAPIKey     string
+		expectedNewSession bool
+	}{
+		{
+			testCaseName:   "Unchanged",
+			config:         fixtureConfig,
+			expectedAPIKey: "api-key",
+		},
+		{
+			testCaseName:       "API key rotated",
+			config:             strings.Replace(fixtureConfig, `g2_api_key = "api-key"`, `g2_api_key = "rotated-key"`, 1),
+			expectedReloaded:   true,
+			expectedAPIKey:     "rotated-key",
+			expectedNewSession: true,
+		},
+		{
+			testCaseName:   "Broken file",
+			config:         "[vpc\n  vpc_enabled = ",
+			expectedErr:    true,
+			expectedAPIKey: "rotated-key",
+		},
+		{
+			testCaseName:   "Same broken file is reported once",
+			config:         "[vpc\n  vpc_enabled = ",
+			expectedAPIKey: "rotated-key",
+		},
+		{
+			testCaseName:   "Providers disabled",
+			config:         strings.Replace(fixtureConfig, "vpc_enabled = true", "vpc_enabled = false", 1),
+			expectedErr:    true,
+			expectedAPIKey: "rotated-key",
+		},
+		{
+			testCaseName:   "Provider changed",
+			config:         strings.Replace(fixtureConfig, `vpc_block_provider_name = "vpc"`, `vpc_block_provider_name = "other"`, 1),
+			expectedErr:    true,
+			expectedAPIKey: "rotated-key",
+		},
+		{
+			testCaseName:   "Cluster ID changed",
+			config:         fixtureConfig,
+			clusterInfo:    `{"cluster_id": "other-cluster"}`,
+			expectedErr:    true,
+			expectedAPIKey: "rotated-key",
+		},
+		{
+			testCaseName:       "Fixed",
+			config:             fixtureConfig,
+			expectedReloaded:   true,
+			expectedAPIKey:     "api-key",
+			expectedNewSession: true,
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			if testcase.clusterInfo == "" {
+				testcase.clusterInfo = string(clusterInfo)
+			}
+			writeFile(t, configPath, testcase.config)
+			writeFile(t, clusterInfoPath, testcase.clusterInfo)
+			cachedSession := &fake.FakeSession{}
+			cloudProvider.session = cachedSession
+
+			reloaded, err := cloudProvider.ReloadConfig(logger)
+			assert.Equal(t, testcase.expectedReloaded, reloaded)
+			assert.Equal(t, testcase.expectedErr, err != nil, "error: %v", err)
+			assert.Equal(t, testcase.expectedAPIKey, cloudProvider.GetConfig().VPC.G2APIKey)
+			assert.Equal(t, "blhl930d0ruuc29rd523", cloudProvider.GetClusterID())
+			if testcase.expectedNewSession {
+				assert.Nil(t, cloudProvider.session)
+			} else {
+				assert.Equal(t, cachedSession, cloudProvider.session)
+			}
+		})
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	configPath := setupConfigDir(t)
+	fixtureConfig := readFixtureConfig(t)
+	cloudProvider, err := NewIBMCloudStorageProvider(configPath, &fakes.Provider{}, logger)
+	assert.Nil(t, err)
+	cloudProvider.ConfigReloadDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorder := record.NewFakeRecorder(10)
+	pod := &v1.ObjectReference{Kind: "Pod", Namespace: "kube-system", Name: "ibm-csi-controller-0"}
+	assert.Nil(t, cloudProvider.WatchConfig(ctx, logger, recorder, pod))
+
+	expectEvent := func(expected string) {
+		select {
+		case event := <-recorder.Events:
+			assert.Contains(t, event, expected)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Timed out waiting for %s event", expected)
+		}
+	}
+
+	writeFile(t, configPath, strings.Replace(fixtureConfig, `vpc_api_timeout = "120s"`, `vpc_api_timeout = "60s"`, 1))
+	expectEvent(v1.EventTypeNormal + " " + ConfigReloadedEventReason)
+	assert.Equal(t, "60s", cloudProvider.GetConfig().VPC.VPCTimeout)
+
+	writeFile(t, configPath, "[vpc\n")
+	expectEvent(v1.EventTypeWarning + " " + ConfigRejectedEventReason)
+	assert.Equal(t, "60s", cloudProvider.GetConfig().VPC.VPCTimeout)
+
+	// Missing directory
+	cloudProvider.configPath = filepath.Join(t.TempDir(), "missing", "slclient.toml")
+	assert.NotNil(t, cloudProvider.WatchConfig(ctx, logger, recorder, pod))
+}
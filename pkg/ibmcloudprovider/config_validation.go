@@ -0,0 +1,215 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/messages"
+	"github.com/IBM/ibmcloud-volume-interface/config"
+)
+
+const (
+	// FindingError the configuration can not be used
+	FindingError = "error"
+
+	// FindingWarning the configuration can be used but is likely wrong
+	FindingWarning = "warning"
+
+	// gcProviderType is the provider_type of VPC gen1 in slclient.toml
+	gcProviderType = "gc"
+
+	apiVersionLayout = "2006-01-02"
+)
+
+// ConfigFinding is a problem found in the provider configuration
+type ConfigFinding struct {
+	// Field is the slclient.toml section and key i.e vpc.g2_api_key
+	Field    string
+	Severity string
+	messages.Message
+}
+
+// ConfigFindings ...
+type ConfigFindings []ConfigFinding
+
+// HasErrors returns true if any finding is an error
+func (findings ConfigFindings) HasErrors() bool {
+	for _, finding := range findings {
+		if finding.Severity == FindingError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the error findings as a single error, nil if there is none
+func (findings ConfigFindings) Err() error {
+	var errs []error
+	for _, finding := range findings {
+		if finding.Severity == FindingError {
+			errs = append(errs, fmt.Errorf("%s: %w", finding.Field, finding.Message))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Without returns the findings without the ones with the given code
+func (findings ConfigFindings) Without(code string) ConfigFindings {
+	var filtered ConfigFindings
+	for _, finding := range findings {
+		if finding.Code != code {
+			filtered = append(filtered, finding)
+		}
+	}
+	return filtered
+}
+
+// newFinding returns the finding with the message of code, formatted with args
+func newFinding(field string, severity string, code string, args ...interface{}) ConfigFinding {
+	message := messages.InitMessages()[code]
+	if len(args) > 0 {
+		message.Description = fmt.Sprintf(message.Description, args...)
+	}
+	return ConfigFinding{Field: field, Severity: severity, Message: message}
+}
+
+// Validate checks the fields and the cross-field rules of the provider configuration, returning every problem found
+func Validate(conf *config.Config) ConfigFindings {
+	var findings ConfigFindings
+	add := func(field string, severity string, code string, args ...interface{}) {
+		findings = append(findings, newFinding(field, severity, code, args...))
+	}
+
+	iksEnabled := conf.IKS != nil && conf.IKS.Enabled
+	vpcEnabled := conf.VPC != nil && conf.VPC.Enabled
+	if !iksEnabled && !vpcEnabled {
+		add("vpc.vpc_enabled", FindingError, messages.NoProviderEnabled)
+		return findings
+	}
+
+	if iksEnabled {
+		if conf.IKS.IKSBlockProviderName == "" {
+			add("IKS.iks_block_provider_name", FindingError, messages.MissingProviderName, "iks_block_provider_name")
+		}
+		if conf.Bluemix == nil || conf.Bluemix.IamAPIKey == "" {
+			add("bluemix.iam_api_key", FindingError, messages.MissingAPIKey, "iam_api_key")
+		}
+	}
+	if vpcEnabled {
+		validateVPC(conf.VPC, iksEnabled, add)
+	}
+	return findings
+}
+
+// ValidateAuth checks the IAM authentication settings, a trusted profile does not need an API key
+func ValidateAuth(auth *AuthConfig) ConfigFindings {
+	var findings ConfigFindings
+	switch auth.IAMAuthType {
+	case APIKeyAuthType:
+	case TrustedProfileAuthType:
+		if auth.IAMProfileID == "" {
+			findings = append(findings, newFinding("vpc.iam_profile_id", FindingError, messages.MissingTrustedProfile, "iam_profile_id"))
+		}
+	default:
+		findings = append(findings, newFinding("vpc.iam_auth_type", FindingError, messages.InvalidAuthType, auth.IAMAuthType))
+	}
+	return findings
+}
+
+// validateVPC checks the vpc section, the API key and endpoints are not used if IKS fronts VPC
+func validateVPC(vpc *config.VPCProviderConfig, iksEnabled bool, add func(string, string, string, ...interface{})) {
+	if vpc.VPCBlockProviderName == "" {
+		add("vpc.vpc_block_provider_name", FindingError, messages.MissingProviderName, "vpc_block_provider_name")
+	}
+
+	switch vpc.VPCBlockProviderType {
+	case g2ProviderType:
+		if !iksEnabled && vpc.G2APIKey == "" && vpc.APIKey == "" {
+			add("vpc.g2_api_key", FindingError, messages.MissingAPIKey, "g2_api_key")
+		}
+		if !iksEnabled {
+			validateURL("vpc.g2_riaas_endpoint_url", vpc.G2EndpointURL, true, add)
+		}
+		validateURL("vpc.g2_riaas_endpoint_private_url", vpc.G2EndpointPrivateURL, false, add)
+		validateURL("vpc.g2_token_exchange_endpoint_url", vpc.G2TokenExchangeURL, false, add)
+		validateAPIVersion("vpc.g2_api_version", vpc.G2APIVersion, add)
+	case gcProviderType, "":
+		if !iksEnabled && vpc.APIKey == "" {
+			add("vpc.gc_api_key", FindingError, messages.MissingAPIKey, "gc_api_key")
+		}
+		if !iksEnabled {
+			validateURL("vpc.gc_riaas_endpoint_url", vpc.EndpointURL, true, add)
+		}
+		validateURL("vpc.gc_riaas_endpoint_private_url", vpc.PrivateEndpointURL, false, add)
+		validateURL("vpc.gc_token_exchange_endpoint_url", vpc.TokenExchangeURL, false, add)
+	default:
+		add("vpc.provider_type", FindingError, messages.InvalidProviderType, vpc.VPCBlockProviderType)
+	}
+	validateURL("vpc.iks_token_exchange_endpoint_private_url", vpc.IKSTokenExchangePrivateURL, false, add)
+	validateAPIVersion("vpc.api_version", vpc.APIVersion, add)
+
+	if vpc.VPCTimeout != "" {
+		if timeout, err := time.ParseDuration(vpc.VPCTimeout); err != nil || timeout <= 0 {
+			add("vpc.vpc_api_timeout", FindingError, messages.InvalidAPITimeout, vpc.VPCTimeout)
+		}
+	}
+
+	retrySettings := []struct {
+		field string
+		value int
+	}{
+		{"max_retry_attempt", vpc.MaxRetryAttempt},
+		{"max_retry_gap", vpc.MaxRetryGap},
+		{"max_vpc_retry_attempt", vpc.MaxVPCRetryAttempt},
+		{"min_vpc_retry_gap", vpc.MinVPCRetryGap},
+		{"min_vpc_retry_gap_attempt", vpc.MinVPCRetryGapAttempt},
+	}
+	for _, setting := range retrySettings {
+		if setting.value < 0 {
+			add("vpc."+setting.field, FindingError, messages.InvalidRetryConfig, setting.field, setting.value)
+		}
+	}
+}
+
+// validateURL checks the endpoint is an absolute http or https URL, a missing optional endpoint is not a problem
+func validateURL(field string, value string, required bool, add func(string, string, string, ...interface{})) {
+	if value == "" {
+		if required {
+			add(field, FindingError, messages.MissingEndpointURL, field)
+		}
+		return
+	}
+	endpoint, err := url.Parse(value)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		add(field, FindingError, messages.InvalidEndpointURL, field, value)
+	}
+}
+
+// validateAPIVersion checks the API version is a date, only a warning as the backend decides which versions it accepts
+func validateAPIVersion(field string, value string, add func(string, string, string, ...interface{})) {
+	if value == "" {
+		return
+	}
+	if _, err := time.Parse(apiVersionLayout, value); err != nil {
+		add(field, FindingWarning, messages.InvalidAPIVersion, field, value)
+	}
+}
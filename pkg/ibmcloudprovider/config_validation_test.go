@@ -0,0 +1,134 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IBM/ibm-csi-common/pkg/messages"
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/IBM/ibmcloud-volume-interface/config"
+	"github.com/IBM/ibmcloud-volume-interface/provider/local/fakes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	fixtureConfig := readFixtureConfig(t)
+	readFixture := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(testFixtures, name))
+		assert.Nil(t, err)
+		return string(data)
+	}
+
+	testCases := []struct {
+		testCaseName     string
+		config           string
+		expectedFindings map[string]string
+		expectedErr      bool
+	}{
+		{
+			testCaseName:     "Valid",
+			config:           fixtureConfig,
+			expectedFindings: map[string]string{},
+		},
+		{
+			testCaseName:     "Providers disabled",
+			config:           readFixture("provider-disabled.toml"),
+			expectedFindings: map[string]string{"vpc.vpc_enabled": messages.NoProviderEnabled},
+			expectedErr:      true,
+		},
+		{
+			testCaseName: "Invalid fields",
+			config:       readFixture(filepath.Join("invalid", "slconfig.toml")),
+			expectedFindings: map[string]string{
+				"vpc.vpc_block_provider_name": messages.MissingProviderName,
+				"vpc.provider_type":           messages.InvalidProviderType,
+				"vpc.api_version":             messages.InvalidAPIVersion,
+				"vpc.vpc_api_timeout":         messages.InvalidAPITimeout,
+				"vpc.max_retry_gap":           messages.InvalidRetryConfig,
+			},
+			expectedErr: true,
+		},
+		{
+			testCaseName:     "API key missing",
+			config:           strings.Replace(fixtureConfig, `g2_api_key = "api-key"`, `g2_api_key = ""`, 1),
+			expectedFindings: map[string]string{"vpc.g2_api_key": messages.MissingAPIKey},
+			expectedErr:      true,
+		},
+		{
+			testCaseName: "Endpoints invalid",
+			config: strings.NewReplacer(
+				`g2_riaas_endpoint_url = "https://us-south-stage01.iaasdev.cloud.ibm.com/"`, `g2_riaas_endpoint_url = ""`,
+				`g2_token_exchange_endpoint_url = "https://iam.stage1.bluemix.net"`, `g2_token_exchange_endpoint_url = "iam.stage1.bluemix.net"`,
+			).Replace(fixtureConfig),
+			expectedFindings: map[string]string{
+				"vpc.g2_riaas_endpoint_url":          messages.MissingEndpointURL,
+				"vpc.g2_token_exchange_endpoint_url": messages.InvalidEndpointURL,
+			},
+			expectedErr: true,
+		},
+		{
+			testCaseName:     "API version is only a warning",
+			config:           strings.Replace(fixtureConfig, `api_version = "2020-07-02"`, `api_version = "latest"`, 1),
+			expectedFindings: map[string]string{"vpc.api_version": messages.InvalidAPIVersion},
+		},
+		{
+			testCaseName:     "IKS without API key",
+			config:           strings.Replace(fixtureConfig, "iks_enabled = false", "iks_enabled = true", 1),
+			expectedFindings: map[string]string{"bluemix.iam_api_key": messages.MissingAPIKey},
+			expectedErr:      true,
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			conf, err := config.ParseConfig(logger, testcase.config)
+			assert.Nil(t, err)
+
+			findings := Validate(conf)
+			codes := map[string]string{}
+			for _, finding := range findings {
+				codes[finding.Field] = finding.Code
+				assert.NotEmpty(t, finding.Description)
+				assert.NotEmpty(t, finding.Action)
+				assert.NotContains(t, finding.Description, "%!")
+			}
+			assert.Equal(t, testcase.expectedFindings, codes)
+			assert.Equal(t, testcase.expectedErr, findings.HasErrors())
+			assert.Equal(t, testcase.expectedErr, findings.Err() != nil)
+		})
+	}
+}
+
+func TestNewIBMCloudStorageProviderInvalidConfig(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	t.Setenv(utils.SecretConfigPathEnv, filepath.Join(testFixtures, "valid"))
+	cloudProvider, err := NewIBMCloudStorageProvider(filepath.Join(testFixtures, "invalid", "slconfig.toml"), &fakes.Provider{}, logger)
+	assert.Nil(t, cloudProvider)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), messages.InvalidAPITimeout)
+	assert.NotContains(t, err.Error(), messages.InvalidAPIVersion)
+}
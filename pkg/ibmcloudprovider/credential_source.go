@@ -0,0 +1,245 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	grpcClient "github.com/IBM/ibm-csi-common/pkg/utils/grpc-client"
+	apiKeyProvider "github.com/IBM/ibm-csi-common/provider"
+	"github.com/IBM/ibmcloud-volume-interface/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+const (
+	// DefaultAPIKeyTTL is how long an API key read from the sidecar is used before it is read again
+	DefaultAPIKeyTTL = 10 * time.Minute
+
+	// sidecarRequestTimeout ...
+	sidecarRequestTimeout = 30 * time.Second
+)
+
+// CredentialSource provides the API key used to open provider sessions
+type CredentialSource interface {
+	// GetAPIKey returns the API key of the enabled provider
+	GetAPIKey(ctx context.Context, logger *zap.Logger) (string, error)
+}
+
+// Invalidator is implemented by the credential and token sources caching what they return. The cached value
+// is invalidated when the provider rejected it, so the next session is opened with a fresh one.
+type Invalidator interface {
+	// Invalidate drops the cached value
+	Invalidate()
+}
+
+// ProviderIdentifier is implemented by the credential sources which send the provider name and cluster ID
+// along with their requests. Both are set from the provider configuration, they cannot change without a restart.
+type ProviderIdentifier interface {
+	// SetProvider sets the provider name and cluster ID sent by the source
+	SetProvider(providerName string, clusterID string)
+}
+
+// configCredentialSource reads the API key from slclient.toml, it follows the configuration reloads
+type configCredentialSource struct {
+	getConfig func() *config.Config
+}
+
+// NewConfigCredentialSource returns a source reading the API key of the enabled provider from the configuration
+func NewConfigCredentialSource(getConfig func() *config.Config) CredentialSource {
+	return &configCredentialSource{getConfig: getConfig}
+}
+
+// GetAPIKey ...
+func (source *configCredentialSource) GetAPIKey(ctx context.Context, logger *zap.Logger) (string, error) {
+	apiKey := getAPIKey(source.getConfig())
+	if apiKey == "" {
+		return "", errors.New("API key is not set in the provider configuration")
+	}
+	return apiKey, nil
+}
+
+// fileCredentialSource reads the API key from a file, i.e a mounted secret key
+type fileCredentialSource struct {
+	path string
+}
+
+// NewFileCredentialSource returns a source reading the API key from the file on every call, so rotated keys are used right away
+func NewFileCredentialSource(path string) CredentialSource {
+	return &fileCredentialSource{path: path}
+}
+
+// GetAPIKey ...
+func (source *fileCredentialSource) GetAPIKey(ctx context.Context, logger *zap.Logger) (string, error) {
+	data, err := os.ReadFile(filepath.Clean(source.path))
+	if err != nil {
+		logger.Error("Failed to read API key file", zap.String("path", source.path), zap.Error(err))
+		return "", err
+	}
+	apiKey := strings.TrimSpace(string(data))
+	if apiKey == "" {
+		return "", fmt.Errorf("API key file %s is empty", source.path)
+	}
+	return apiKey, nil
+}
+
+// SidecarCredentialSource reads the API key from the APIKeyProvider gRPC sidecar. Keys are cached for TTL,
+// Start refreshes them in the background so callers do not wait for the sidecar.
+type SidecarCredentialSource struct {
+	client apiKeyProvider.APIKeyProviderClient
+	// container reads the container (IKS) API key instead of the VPC one
+	container bool
+	ttl       time.Duration
+
+	// provider identifies the provider and its cluster to the sidecar, see SetProvider
+	provider apiKeyProvider.Provider
+
+	mutex     sync.Mutex
+	apiKey    string
+	fetchedAt time.Time
+	// generation is incremented by Invalidate, keys requested before are not cached
+	generation uint64
+}
+
+var _ Invalidator = &SidecarCredentialSource{}
+var _ ProviderIdentifier = &SidecarCredentialSource{}
+
+// NewSidecarCredentialSource returns a source reading the VPC API key, or the container API key if container
+// is set, over conn. DefaultAPIKeyTTL is used if ttl is zero.
+func NewSidecarCredentialSource(conn grpc.ClientConnInterface, container bool, ttl time.Duration) *SidecarCredentialSource {
+	if ttl <= 0 {
+		ttl = DefaultAPIKeyTTL
+	}
+	return &SidecarCredentialSource{
+		client:    apiKeyProvider.NewAPIKeyProviderClient(conn),
+		container: container,
+		ttl:       ttl,
+	}
+}
+
+// DialSidecar connects to the APIKeyProvider sidecar listening on the unix socket at socketPath
+func DialSidecar(factory grpcClient.GrpcSessionFactory, socketPath string) (*grpc.ClientConn, error) {
+	session := factory.NewGrpcSession()
+	return session.GrpcDialWithConfig(context.Background(), grpcClient.DialConfig{Target: "unix://" + socketPath})
+}
+
+// GetAPIKey returns the cached API key, it is read from the sidecar if missing or older than TTL.
+// The sidecar is called without holding the mutex, so a slow sidecar does not block the cached key.
+func (source *SidecarCredentialSource) GetAPIKey(ctx context.Context, logger *zap.Logger) (string, error) {
+	source.mutex.Lock()
+	if source.apiKey != "" && time.Since(source.fetchedAt) < source.ttl {
+		apiKey := source.apiKey
+		source.mutex.Unlock()
+		return apiKey, nil
+	}
+	generation := source.generation
+	source.mutex.Unlock()
+
+	apiKey, err := source.request(ctx, logger)
+	if err != nil {
+		return "", err
+	}
+	source.store(apiKey, generation, logger)
+	return apiKey, nil
+}
+
+// SetProvider sets the provider name and cluster ID sent to the sidecar, which only serves the keys of its own cluster
+func (source *SidecarCredentialSource) SetProvider(providerName string, clusterID string) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	source.provider = apiKeyProvider.Provider{ProviderName: providerName, ClusterId: clusterID}
+}
+
+// Invalidate drops the cached API key after the provider rejected it, the next GetAPIKey reads it from the sidecar
+func (source *SidecarCredentialSource) Invalidate() {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	source.apiKey, source.fetchedAt = "", time.Time{}
+	source.generation++
+}
+
+// Start refreshes the API key every half TTL until ctx is done. A failed refresh keeps the cached key,
+// it is retried on the next tick or on the first GetAPIKey after the key expired.
+func (source *SidecarCredentialSource) Start(ctx context.Context, logger *zap.Logger) {
+	go func() {
+		ticker := time.NewTicker(source.ttl / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				source.mutex.Lock()
+				generation := source.generation
+				source.mutex.Unlock()
+				apiKey, err := source.request(ctx, logger)
+				if err != nil {
+					logger.Warn("Failed to refresh API key from sidecar, keeping the cached key", zap.Error(err))
+					continue
+				}
+				source.store(apiKey, generation, logger)
+			}
+		}
+	}()
+}
+
+// request reads the API key from the sidecar
+func (source *SidecarCredentialSource) request(ctx context.Context, logger *zap.Logger) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, sidecarRequestTimeout)
+	defer cancel()
+
+	source.mutex.Lock()
+	in := &apiKeyProvider.Provider{ProviderName: source.provider.ProviderName, ClusterId: source.provider.ClusterId}
+	source.mutex.Unlock()
+
+	var response *apiKeyProvider.APIKey
+	var err error
+	if source.container {
+		response, err = source.client.GetContainerAPIKey(ctx, in)
+	} else {
+		response, err = source.client.GetVPCAPIKey(ctx, in)
+	}
+	if err != nil {
+		logger.Error("Failed to get API key from sidecar", zap.Bool("container", source.container), zap.Error(err))
+		return "", fmt.Errorf("Failed to get API key from sidecar: %w", err)
+	}
+	if response.GetApikey() == "" {
+		return "", errors.New("Sidecar returned an empty API key")
+	}
+	return response.GetApikey(), nil
+}
+
+// store caches the API key requested at the given generation, unless it was invalidated since
+func (source *SidecarCredentialSource) store(apiKey string, generation uint64, logger *zap.Logger) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	if generation != source.generation {
+		return
+	}
+	if source.apiKey != "" && source.apiKey != apiKey {
+		logger.Info("API key rotated by sidecar", zap.Bool("container", source.container))
+	}
+	source.apiKey, source.fetchedAt = apiKey, time.Now()
+}
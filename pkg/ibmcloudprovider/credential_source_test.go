@@ -0,0 +1,308 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	grpcClient "github.com/IBM/ibm-csi-common/pkg/utils/grpc-client"
+	fakegrpc "github.com/IBM/ibm-csi-common/pkg/utils/grpc-client/fake-grpc"
+	apiKeyProvider "github.com/IBM/ibm-csi-common/provider"
+	"github.com/IBM/ibmcloud-volume-interface/config"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/provider/local/fakes"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// fakeAPIKeyServer serves configurable API keys and counts the calls
+type fakeAPIKeyServer struct {
+	apiKeyProvider.UnimplementedAPIKeyProviderServer
+
+	mutex          sync.Mutex
+	vpcAPIKey      string
+	containerKey   string
+	err            error
+	vpcCalls       int
+	containerCalls int
+	// provider is the provider of the last VPC call
+	provider *apiKeyProvider.Provider
+	// release blocks the VPC calls until it is closed, if set
+	release chan struct{}
+}
+
+func (s *fakeAPIKeyServer) GetVPCAPIKey(ctx context.Context, in *apiKeyProvider.Provider) (*apiKeyProvider.APIKey, error) {
+	s.mutex.Lock()
+	s.vpcCalls++
+	s.provider = in
+	release := s.release
+	s.mutex.Unlock()
+	if release != nil {
+		<-release
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &apiKeyProvider.APIKey{Apikey: s.vpcAPIKey}, nil
+}
+
+func (s *fakeAPIKeyServer) GetContainerAPIKey(ctx context.Context, in *apiKeyProvider.Provider) (*apiKeyProvider.APIKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.containerCalls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &apiKeyProvider.APIKey{Apikey: s.containerKey}, nil
+}
+
+func (s *fakeAPIKeyServer) set(vpcAPIKey string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.vpcAPIKey, s.err = vpcAPIKey, err
+}
+
+func (s *fakeAPIKeyServer) calls() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.vpcCalls
+}
+
+// startAPIKeyServer serves the fake in-process and returns a client connection
+func startAPIKeyServer(t *testing.T, server *fakeAPIKeyServer) *grpc.ClientConn {
+	factory := &fakegrpc.FakeGrpcSessionFactory{}
+	apiKeyProvider.RegisterAPIKeyProviderServer(factory, server)
+	t.Cleanup(factory.Close)
+
+	conn, err := DialSidecar(factory, "provider.sock")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestConfigAndFileCredentialSource(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	conf := &config.Config{VPC: &config.VPCProviderConfig{Enabled: true, VPCBlockProviderType: g2ProviderType, G2APIKey: "g2-key"}}
+	apiKey, err := NewConfigCredentialSource(func() *config.Config { return conf }).GetAPIKey(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, "g2-key", apiKey)
+	conf.VPC.G2APIKey = ""
+	_, err = NewConfigCredentialSource(func() *config.Config { return conf }).GetAPIKey(context.Background(), logger)
+	assert.NotNil(t, err)
+
+	keyPath := filepath.Join(t.TempDir(), "apikey")
+	source := NewFileCredentialSource(keyPath)
+	_, err = source.GetAPIKey(context.Background(), logger)
+	assert.NotNil(t, err)
+	assert.Nil(t, os.WriteFile(keyPath, []byte("  file-key\n"), 0600))
+	apiKey, err = source.GetAPIKey(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, "file-key", apiKey)
+	assert.Nil(t, os.WriteFile(keyPath, []byte("\n"), 0600))
+	_, err = source.GetAPIKey(context.Background(), logger)
+	assert.NotNil(t, err)
+}
+
+func TestSidecarCredentialSource(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	server := &fakeAPIKeyServer{vpcAPIKey: "vpc-key", containerKey: "container-key"}
+	conn := startAPIKeyServer(t, server)
+
+	// Cached until the TTL expires
+	source := NewSidecarCredentialSource(conn, false, 100*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		apiKey, err := source.GetAPIKey(context.Background(), logger)
+		assert.Nil(t, err)
+		assert.Equal(t, "vpc-key", apiKey)
+	}
+	assert.Equal(t, 1, server.calls())
+	server.set("rotated-key", nil)
+	time.Sleep(150 * time.Millisecond)
+	apiKey, err := source.GetAPIKey(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, "rotated-key", apiKey)
+
+	// Sidecar failures once the key expired
+	server.set("", errors.New("secret not found"))
+	time.Sleep(150 * time.Millisecond)
+	_, err = source.GetAPIKey(context.Background(), logger)
+	assert.NotNil(t, err)
+	server.set("", nil)
+	_, err = source.GetAPIKey(context.Background(), logger)
+	assert.NotNil(t, err)
+
+	// Invalidated key is read again
+	server.set("vpc-key", nil)
+	source = NewSidecarCredentialSource(conn, false, 0)
+	_, err = source.GetAPIKey(context.Background(), logger)
+	assert.Nil(t, err)
+	server.set("rotated-key", nil)
+	source.Invalidate()
+	apiKey, err = source.GetAPIKey(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, "rotated-key", apiKey)
+
+	// The sidecar is called without holding the lock, a key requested before the invalidation is not cached
+	release := make(chan struct{})
+	server.mutex.Lock()
+	server.release = release
+	server.mutex.Unlock()
+	source.Invalidate()
+	calls := server.calls()
+	requested := make(chan string)
+	go func() {
+		apiKey, err := source.GetAPIKey(context.Background(), logger)
+		assert.Nil(t, err)
+		requested <- apiKey
+	}()
+	assert.Eventually(t, func() bool { return server.calls() > calls }, time.Second, 5*time.Millisecond)
+	source.Invalidate()
+	server.mutex.Lock()
+	server.release = nil
+	server.mutex.Unlock()
+	close(release)
+	assert.Equal(t, "rotated-key", <-requested)
+	source.mutex.Lock()
+	assert.Empty(t, source.apiKey)
+	source.mutex.Unlock()
+
+	// Container key
+	apiKey, err = NewSidecarCredentialSource(conn, true, 0).GetAPIKey(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, "container-key", apiKey)
+}
+
+func TestSidecarCredentialSourceRefresh(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	server := &fakeAPIKeyServer{vpcAPIKey: "vpc-key"}
+	source := NewSidecarCredentialSource(startAPIKeyServer(t, server), false, 200*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := source.GetAPIKey(ctx, logger)
+	assert.Nil(t, err)
+	source.Start(ctx, logger)
+
+	// Refreshed in the background before it expires
+	server.set("rotated-key", nil)
+	assert.Eventually(t, func() bool {
+		source.mutex.Lock()
+		defer source.mutex.Unlock()
+		return source.apiKey == "rotated-key"
+	}, 2*time.Second, 20*time.Millisecond)
+
+	// A failed refresh keeps the cached key
+	server.set("", errors.New("sidecar unavailable"))
+	calls := server.calls()
+	assert.Eventually(t, func() bool { return server.calls() > calls }, 2*time.Second, 20*time.Millisecond)
+	source.mutex.Lock()
+	assert.Equal(t, "rotated-key", source.apiKey)
+	source.mutex.Unlock()
+}
+
+func TestDialSidecar(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	socketPath := filepath.Join(t.TempDir(), "provider.sock")
+	listener, err := net.Listen("unix", socketPath)
+	assert.Nil(t, err)
+	grpcServer := grpc.NewServer()
+	apiKeyProvider.RegisterAPIKeyProviderServer(grpcServer, &fakeAPIKeyServer{vpcAPIKey: "vpc-key"})
+	go func() { _ = grpcServer.Serve(listener) }()
+	defer grpcServer.Stop()
+
+	conn, err := DialSidecar(&grpcClient.ConnObjFactory{}, socketPath)
+	assert.Nil(t, err)
+	defer conn.Close()
+	apiKey, err := NewSidecarCredentialSource(conn, false, 0).GetAPIKey(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, "vpc-key", apiKey)
+
+	_, err = DialSidecar(&fakegrpc.FakeGrpcSessionFactory{FailGrpcConnection: true, FailGrpcConnectionErr: "dial failed"}, socketPath)
+	assert.NotNil(t, err)
+}
+
+func TestProviderWithSidecarCredentialSource(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	// slclient.toml without API key is accepted as the sidecar provides it
+	configPath := setupConfigDir(t)
+	writeFile(t, configPath, readFixtureConfigWithoutAPIKey(t))
+	prov := newTestVolumeProvider(provider.ContextCredentials{AuthType: provider.IAMAPIKey})
+	_, err := NewIBMCloudStorageProvider(configPath, prov, logger)
+	assert.NotNil(t, err)
+
+	server := &fakeAPIKeyServer{vpcAPIKey: "sidecar-key"}
+	source := NewSidecarCredentialSource(startAPIKeyServer(t, server), false, 0)
+	cloudProvider, err := NewIBMCloudStorageProviderWithCredentialSource(configPath, prov, source, logger)
+	assert.Nil(t, err)
+
+	ccf, _ := prov.ContextCredentialsFactory(nil)
+	_, err = cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	accountID, apiKey, _ := ccf.(*fakes.ContextCredentialsFactory).ForIAMAPIKeyArgsForCall(0)
+	assert.Equal(t, "t242f140687cd68a8e037b26680e0f23", accountID)
+	assert.Equal(t, "sidecar-key", apiKey)
+
+	// Sidecar is told the provider and the cluster of the configuration
+	server.mutex.Lock()
+	assert.Equal(t, "vpc", server.provider.GetProviderName())
+	assert.Equal(t, "blhl930d0ruuc29rd523", server.provider.GetClusterId())
+	server.mutex.Unlock()
+
+	// Rejected key is read again from the sidecar
+	server.set("rotated-key", nil)
+	calls := 0
+	err = cloudProvider.WithSession(context.Background(), logger, func(session provider.Session) error {
+		if calls++; calls == 1 {
+			return authError
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	_, apiKey, _ = ccf.(*fakes.ContextCredentialsFactory).ForIAMAPIKeyArgsForCall(1)
+	assert.Equal(t, "rotated-key", apiKey)
+
+	// Reloads keep accepting the configuration without API key
+	writeFile(t, configPath, readFixtureConfigWithoutAPIKey(t)+"\n# changed\n")
+	reloaded, err := cloudProvider.ReloadConfig(logger)
+	assert.Nil(t, err)
+	assert.True(t, reloaded)
+}
+
+// readFixtureConfigWithoutAPIKey ...
+func readFixtureConfigWithoutAPIKey(t *testing.T) string {
+	return strings.Replace(readFixtureConfig(t), `g2_api_key = "api-key"`, `g2_api_key = ""`, 1)
+}
@@ -98,7 +98,7 @@ type FakeIBMCloudStorageProvider struct {
 	ProviderName   string
 	ProviderConfig *config.Config
 	ClusterID      string
-	fakeSession    *fake.FakeSession
+	fakeSession    provider.Session
 }
 
 var _ CloudProviderInterface = &FakeIBMCloudStorageProvider{}
@@ -110,6 +110,13 @@ func NewFakeIBMCloudStorageProvider(configPath string, logger *zap.Logger) (*Fak
 		ClusterID:      "fake-clusterID", fakeSession: &fake.FakeSession{}}, nil
 }
 
+// NewFakeIBMCloudStorageProviderWithSession returns a fake provider handing out the given session, i.e a MemorySession
+func NewFakeIBMCloudStorageProviderWithSession(session provider.Session) *FakeIBMCloudStorageProvider {
+	return &FakeIBMCloudStorageProvider{ProviderName: "FakeIBMCloudStorageProvider",
+		ProviderConfig: &config.Config{VPC: &config.VPCProviderConfig{VPCBlockProviderName: "VPCFakeProvider"}},
+		ClusterID:      "fake-clusterID", fakeSession: session}
+}
+
 // GetProviderSession ...
 func (ficp *FakeIBMCloudStorageProvider) GetProviderSession(ctx context.Context, logger *zap.Logger) (provider.Session, error) {
 	return ficp.fakeSession, nil
@@ -0,0 +1,401 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fakevpcserver ...
+package fakevpcserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAPIKey is the API key accepted by the IAM token endpoint unless APIKey is changed
+	DefaultAPIKey = "fake-api-key"
+
+	// DefaultTokenTTL is the lifetime of issued IAM tokens unless TokenTTL is changed
+	DefaultTokenTTL = time.Hour
+
+	// APIKeyGrantType is the IAM grant type for API keys
+	APIKeyGrantType = "urn:ibm:params:oauth:grant-type:apikey"
+
+	// CRTokenGrantType is the IAM grant type exchanging a compute resource token for a trusted profile token
+	CRTokenGrantType = "urn:ibm:params:oauth:grant-type:cr-token"
+
+	// DefaultProfileID is the trusted profile accepted by the IAM token endpoint unless ProfileID is changed
+	DefaultProfileID = "Profile-fake-trusted-profile"
+
+	// RefreshTokenGrantType is the IAM grant type for refresh tokens
+	RefreshTokenGrantType = "refresh_token"
+
+	// AllRoutes selects every route in SetLatency, InjectFailure and ClearFailures
+	AllRoutes = ""
+)
+
+// Routes served by the fake, as used by SetLatency, InjectFailure and RequestCount
+const (
+	RouteIAMToken          = "POST /identity/token"
+	RouteCreateVolume      = "POST /v1/volumes"
+	RouteListVolumes       = "GET /v1/volumes"
+	RouteGetVolume         = "GET /v1/volumes/{id}"
+	RouteUpdateVolume      = "PATCH /v1/volumes/{id}"
+	RouteDeleteVolume      = "DELETE /v1/volumes/{id}"
+	RouteCreateSnapshot    = "POST /v1/snapshots"
+	RouteListSnapshots     = "GET /v1/snapshots"
+	RouteGetSnapshot       = "GET /v1/snapshots/{id}"
+	RouteDeleteSnapshot    = "DELETE /v1/snapshots/{id}"
+	RouteCreateAttachment  = "POST /v1/instances/{instance_id}/volume_attachments"
+	RouteListAttachments   = "GET /v1/instances/{instance_id}/volume_attachments"
+	RouteGetAttachment     = "GET /v1/instances/{instance_id}/volume_attachments/{id}"
+	RouteDeleteAttachment  = "DELETE /v1/instances/{instance_id}/volume_attachments/{id}"
+	RouteCreateShare       = "POST /v1/shares"
+	RouteGetShare          = "GET /v1/shares/{id}"
+	RouteDeleteShare       = "DELETE /v1/shares/{id}"
+	RouteCreateMountTarget = "POST /v1/shares/{id}/mount_targets"
+	RouteListMountTargets  = "GET /v1/shares/{id}/mount_targets"
+	RouteGetMountTarget    = "GET /v1/shares/{id}/mount_targets/{target_id}"
+	RouteDeleteMountTarget = "DELETE /v1/shares/{id}/mount_targets/{target_id}"
+	RouteListTags          = "GET /v3/tags"
+	RouteAttachTags        = "POST /v3/tags/attach"
+	RouteDetachTags        = "POST /v3/tags/detach"
+)
+
+// failure is an injected failure of a route
+type failure struct {
+	status int
+	// remaining is the number of requests still failing, negative fails until cleared
+	remaining int
+}
+
+// Server is an in-memory stand-in of the VPC infrastructure, global tagging and IAM token APIs,
+// listening on a local httptest server. All endpoints share the same URL, the VPC endpoints
+// under /v1, the global tagging endpoints under /v3 and IAM under /identity.
+type Server struct {
+	*httptest.Server
+
+	// APIKey is the API key accepted by the IAM token endpoint
+	APIKey string
+
+	// ProfileID is the trusted profile accepted by the IAM token endpoint
+	ProfileID string
+
+	// CRToken is the compute resource token accepted for ProfileID, any non empty token is accepted if empty
+	CRToken string
+
+	// TokenTTL is the lifetime of issued IAM tokens
+	TokenTTL time.Duration
+
+	// Region used in the CRN of created resources
+	Region string
+
+	// AccountID used in the CRN of created resources
+	AccountID string
+
+	mutex       sync.Mutex
+	counter     int
+	tokens      map[string]time.Time
+	volumes     map[string]*Volume
+	snapshots   map[string]*Snapshot
+	attachments map[string]*VolumeAttachment
+	shares      map[string]*Share
+	tags        map[string][]string
+	latency     map[string]time.Duration
+	failures    map[string]*failure
+	requests    map[string]int
+}
+
+// NewServer starts a new fake VPC API server, the caller must Close it
+func NewServer() *Server {
+	s := &Server{
+		APIKey:      DefaultAPIKey,
+		ProfileID:   DefaultProfileID,
+		TokenTTL:    DefaultTokenTTL,
+		Region:      "us-south",
+		AccountID:   "fake-account-id",
+		tokens:      map[string]time.Time{},
+		volumes:     map[string]*Volume{},
+		snapshots:   map[string]*Snapshot{},
+		attachments: map[string]*VolumeAttachment{},
+		shares:      map[string]*Share{},
+		tags:        map[string][]string{},
+		latency:     map[string]time.Duration{},
+		failures:    map[string]*failure{},
+		requests:    map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	s.handle(mux, RouteIAMToken, false, s.createToken)
+	s.handle(mux, RouteCreateVolume, true, s.createVolume)
+	s.handle(mux, RouteListVolumes, true, s.listVolumes)
+	s.handle(mux, RouteGetVolume, true, s.getVolume)
+	s.handle(mux, RouteUpdateVolume, true, s.updateVolume)
+	s.handle(mux, RouteDeleteVolume, true, s.deleteVolume)
+	s.handle(mux, RouteCreateSnapshot, true, s.createSnapshot)
+	s.handle(mux, RouteListSnapshots, true, s.listSnapshots)
+	s.handle(mux, RouteGetSnapshot, true, s.getSnapshot)
+	s.handle(mux, RouteDeleteSnapshot, true, s.deleteSnapshot)
+	s.handle(mux, RouteCreateAttachment, true, s.createAttachment)
+	s.handle(mux, RouteListAttachments, true, s.listAttachments)
+	s.handle(mux, RouteGetAttachment, true, s.getAttachment)
+	s.handle(mux, RouteDeleteAttachment, true, s.deleteAttachment)
+	s.handle(mux, RouteCreateShare, true, s.createShare)
+	s.handle(mux, RouteGetShare, true, s.getShare)
+	s.handle(mux, RouteDeleteShare, true, s.deleteShare)
+	s.handle(mux, RouteCreateMountTarget, true, s.createMountTarget)
+	s.handle(mux, RouteListMountTargets, true, s.listMountTargets)
+	s.handle(mux, RouteGetMountTarget, true, s.getMountTarget)
+	s.handle(mux, RouteDeleteMountTarget, true, s.deleteMountTarget)
+	s.handle(mux, RouteListTags, true, s.listTags)
+	s.handle(mux, RouteAttachTags, true, s.attachTags)
+	s.handle(mux, RouteDetachTags, true, s.detachTags)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// SetLatency delays every request of the route, of all routes if route is AllRoutes
+func (s *Server) SetLatency(route string, latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.latency[route] = latency
+}
+
+// InjectFailure fails the next count requests of the route with the HTTP status, all requests until
+// cleared if count is zero. AllRoutes fails every route.
+func (s *Server) InjectFailure(route string, status int, count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if count <= 0 {
+		count = -1
+	}
+	s.failures[route] = &failure{status: status, remaining: count}
+}
+
+// ClearFailures removes the injected failures of the route, of all routes if route is AllRoutes
+func (s *Server) ClearFailures(route string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if route == AllRoutes {
+		s.failures = map[string]*failure{}
+		return
+	}
+	delete(s.failures, route)
+}
+
+// RequestCount returns the number of requests received by the route, including failed ones
+func (s *Server) RequestCount(route string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests[route]
+}
+
+// ExpireTokens revokes all issued IAM tokens, the next calls fail with 401 until a new token is requested
+func (s *Server) ExpireTokens() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens = map[string]time.Time{}
+}
+
+// Volume returns a copy of the volume with the given ID
+func (s *Server) Volume(id string) (Volume, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	volume, ok := s.volumes[id]
+	if !ok {
+		return Volume{}, false
+	}
+	return *s.volumeView(volume), true
+}
+
+// Tags returns the global tags attached to the resource CRN
+func (s *Server) Tags(crn string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.tags[crn]...)
+}
+
+// handle registers the handler of the route, wrapped with the request accounting, latency,
+// failure injection and, if authenticated, the bearer token check
+func (s *Server) handle(mux *http.ServeMux, route string, authenticated bool, handler http.HandlerFunc) {
+	mux.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+		latency, status := s.beforeRequest(route)
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if status != 0 {
+			writeError(w, status, "injected_failure", fmt.Sprintf("Injected failure of %s", route))
+			return
+		}
+		if authenticated && !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "not_authorized", "The request is not authorized")
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// beforeRequest counts the request and returns its latency and injected failure status, if any
+func (s *Server) beforeRequest(route string) (time.Duration, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests[route]++
+
+	latency, ok := s.latency[route]
+	if !ok {
+		latency = s.latency[AllRoutes]
+	}
+	for _, key := range []string{route, AllRoutes} {
+		f, ok := s.failures[key]
+		if !ok || f.remaining == 0 {
+			continue
+		}
+		if f.remaining > 0 {
+			f.remaining--
+		}
+		return latency, f.status
+	}
+	return latency, 0
+}
+
+// authorized checks the bearer token of the request against the issued, unexpired tokens
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	expiry, ok := s.tokens[token]
+	return ok && time.Now().Before(expiry)
+}
+
+// createToken implements the IAM API key, compute resource token and refresh token exchange
+func (s *Server) createToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeIAMError(w, http.StatusBadRequest, "BXNIM0109E", "Request body could not be parsed")
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch r.PostForm.Get("grant_type") {
+	case APIKeyGrantType:
+		if r.PostForm.Get("apikey") != s.APIKey {
+			writeIAMError(w, http.StatusBadRequest, "BXNIM0415E", "Provided API key could not be found")
+			return
+		}
+	case CRTokenGrantType:
+		crToken := r.PostForm.Get("cr_token")
+		if crToken == "" || (s.CRToken != "" && crToken != s.CRToken) {
+			writeIAMError(w, http.StatusBadRequest, "BXNIM0438E", "Provided compute resource token is invalid")
+			return
+		}
+		if r.PostForm.Get("profile_id") != s.ProfileID {
+			writeIAMError(w, http.StatusBadRequest, "BXNIM0442E", "Trusted profile not found")
+			return
+		}
+	case RefreshTokenGrantType:
+		if _, ok := s.tokens[r.PostForm.Get("refresh_token")]; !ok {
+			writeIAMError(w, http.StatusBadRequest, "BXNIM0407E", "Provided refresh token is invalid")
+			return
+		}
+	default:
+		writeIAMError(w, http.StatusBadRequest, "BXNIM0103E", "Unsupported grant type")
+		return
+	}
+
+	expiry := time.Now().Add(s.TokenTTL)
+	accessToken := newAccessToken(s.nextID("token"), s.AccountID, expiry)
+	refreshToken := s.nextID("refresh")
+	s.tokens[accessToken] = expiry
+	s.tokens[refreshToken] = expiry
+	writeJSON(w, http.StatusOK, &Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.TokenTTL.Seconds()),
+		Expiration:   expiry.Unix(),
+	})
+}
+
+// newAccessToken returns an unsigned JWT carrying the claims clients read from IAM tokens
+func newAccessToken(id string, accountID string, expiry time.Time) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	header := encode([]byte(`{"alg":"none","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"jti":     id,
+		"iat":     time.Now().Unix(),
+		"exp":     expiry.Unix(),
+		"account": map[string]string{"bss": accountID},
+	})
+	return header + "." + encode(claims) + "." + encode([]byte(id))
+}
+
+// nextID returns a new unique ID with the given prefix, the caller must hold the mutex
+func (s *Server) nextID(prefix string) string {
+	s.counter++
+	return fmt.Sprintf("%s-%04d", prefix, s.counter)
+}
+
+// crn returns the CRN of a resource, the caller must hold the mutex
+func (s *Server) crn(resourceType string, id string) string {
+	return fmt.Sprintf("crn:v1:bluemix:public:is:%s:a/%s::%s:%s", s.Region, s.AccountID, resourceType, id)
+}
+
+// href returns the URL of a resource path
+func (s *Server) href(path string) string {
+	if s.Server == nil {
+		return path
+	}
+	return s.URL + path
+}
+
+// decode reads the JSON request body into v, writing a bad request response if it fails
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", fmt.Sprintf("Invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a VPC API error response
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, &ErrorResponse{
+		Errors: []Error{{Code: code, Message: message}},
+		Trace:  fmt.Sprintf("fake-%d", time.Now().UnixNano()),
+	})
+}
+
+// writeIAMError writes an IAM error response
+func writeIAMError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, &IAMErrorResponse{ErrorCode: code, ErrorMessage: message})
+}
@@ -0,0 +1,342 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fakevpcserver ...
+package fakevpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testClient calls the fake server the way the VPC and IAM clients do
+type testClient struct {
+	t      *testing.T
+	server *Server
+	token  string
+}
+
+// newTestClient starts a server and returns a client holding a valid IAM token
+func newTestClient(t *testing.T) *testClient {
+	server := NewServer()
+	t.Cleanup(server.Close)
+	client := &testClient{t: t, server: server}
+	token, status := client.requestToken(DefaultAPIKey)
+	assert.Equal(t, http.StatusOK, status)
+	client.token = token.AccessToken
+	return client
+}
+
+// requestToken exchanges the API key for an IAM token
+func (c *testClient) requestToken(apiKey string) (*Token, int) {
+	form := url.Values{"grant_type": {APIKeyGrantType}, "apikey": {apiKey}}
+	response, err := http.PostForm(c.server.URL+"/identity/token", form)
+	assert.Nil(c.t, err)
+	defer response.Body.Close()
+	token := &Token{}
+	_ = json.NewDecoder(response.Body).Decode(token)
+	return token, response.StatusCode
+}
+
+// do sends the request with the client token and decodes the response into out, if not nil
+func (c *testClient) do(ctx context.Context, method string, path string, body interface{}, out interface{}) int {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, c.server.URL+path, reader)
+	assert.Nil(c.t, err)
+	request.Header.Set("Authorization", "Bearer "+c.token)
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return 0
+	}
+	defer response.Body.Close()
+	if out != nil {
+		_ = json.NewDecoder(response.Body).Decode(out)
+	}
+	return response.StatusCode
+}
+
+// errorCode returns the code of the first error of the response
+func errorCode(response *ErrorResponse) string {
+	if len(response.Errors) == 0 {
+		return ""
+	}
+	return response.Errors[0].Code
+}
+
+func TestIAMToken(t *testing.T) {
+	client := newTestClient(t)
+
+	// Token is a JWT carrying the expiry
+	parts := strings.Split(client.token, ".")
+	assert.Equal(t, 3, len(parts))
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.Nil(t, err)
+	claims := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(payload, &claims))
+	assert.InDelta(t, float64(time.Now().Add(DefaultTokenTTL).Unix()), claims["exp"], 5)
+
+	// Invalid API key
+	_, status := client.requestToken("wrong")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Unauthenticated and expired tokens are rejected
+	response := &ErrorResponse{}
+	client.server.ExpireTokens()
+	assert.Equal(t, http.StatusUnauthorized, client.do(context.Background(), http.MethodGet, "/v1/volumes", nil, response))
+	assert.Equal(t, "not_authorized", errorCode(response))
+	token, status := client.requestToken(DefaultAPIKey)
+	assert.Equal(t, http.StatusOK, status)
+	client.token = token.AccessToken
+	assert.Equal(t, http.StatusOK, client.do(context.Background(), http.MethodGet, "/v1/volumes", nil, nil))
+
+	// Refresh token
+	form := url.Values{"grant_type": {RefreshTokenGrantType}, "refresh_token": {token.RefreshToken}}
+	refreshed, err := http.PostForm(client.server.URL+"/identity/token", form)
+	assert.Nil(t, err)
+	refreshed.Body.Close()
+	assert.Equal(t, http.StatusOK, refreshed.StatusCode)
+
+	// Compute resource token of a trusted profile
+	for profileID, expectedStatus := range map[string]int{DefaultProfileID: http.StatusOK, "Profile-unknown": http.StatusBadRequest} {
+		form = url.Values{"grant_type": {CRTokenGrantType}, "cr_token": {"sa-token"}, "profile_id": {profileID}}
+		exchanged, err := http.PostForm(client.server.URL+"/identity/token", form)
+		assert.Nil(t, err)
+		exchanged.Body.Close()
+		assert.Equal(t, expectedStatus, exchanged.StatusCode)
+	}
+}
+
+func TestVolumeLifecycle(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	zone := &Reference{Name: "us-south-1"}
+
+	// Create
+	volume := &Volume{}
+	status := client.do(ctx, http.MethodPost, "/v1/volumes", &VolumeRequest{Name: "pvc-1", Capacity: 10, Zone: zone}, volume)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, StatusPending, volume.Status)
+	assert.Contains(t, volume.CRN, volume.ID)
+
+	testCases := []struct {
+		testCaseName   string
+		request        *VolumeRequest
+		expectedStatus int
+		expectedCode   string
+	}{
+		{testCaseName: "Duplicate name", request: &VolumeRequest{Name: "pvc-1", Capacity: 10, Zone: zone}, expectedStatus: http.StatusBadRequest, expectedCode: "validation_unique_failed"},
+		{testCaseName: "Capacity too small", request: &VolumeRequest{Name: "pvc-2", Capacity: 1, Zone: zone}, expectedStatus: http.StatusBadRequest, expectedCode: "volume_capacity_invalid"},
+		{testCaseName: "Zone missing", request: &VolumeRequest{Name: "pvc-2", Capacity: 10}, expectedStatus: http.StatusBadRequest, expectedCode: "missing_field"},
+		{testCaseName: "Snapshot not found", request: &VolumeRequest{Name: "pvc-2", Zone: zone, SourceSnapshot: &Reference{ID: "unknown"}}, expectedStatus: http.StatusNotFound, expectedCode: "snapshot_not_found"},
+	}
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			response := &ErrorResponse{}
+			assert.Equal(t, testcase.expectedStatus, client.do(ctx, http.MethodPost, "/v1/volumes", testcase.request, response))
+			assert.Equal(t, testcase.expectedCode, errorCode(response))
+		})
+	}
+
+	// Becomes available once read
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, "/v1/volumes/"+volume.ID, nil, volume))
+	assert.Equal(t, StatusAvailable, volume.Status)
+
+	// Expand, shrinking is refused
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodPatch, "/v1/volumes/"+volume.ID, &VolumeRequest{Capacity: 20}, volume))
+	assert.Equal(t, int64(20), volume.Capacity)
+	assert.Equal(t, http.StatusBadRequest, client.do(ctx, http.MethodPatch, "/v1/volumes/"+volume.ID, &VolumeRequest{Capacity: 15}, nil))
+
+	// Snapshot requires an attachment
+	snapshotRequest := &SnapshotRequest{Name: "snap-1", SourceVolume: &Reference{ID: volume.ID}}
+	response := &ErrorResponse{}
+	assert.Equal(t, http.StatusBadRequest, client.do(ctx, http.MethodPost, "/v1/snapshots", snapshotRequest, response))
+	assert.Equal(t, "snapshot_source_volume_not_attached", errorCode(response))
+
+	// Attach
+	attachmentsPath := "/v1/instances/instance-1/volume_attachments"
+	attachment := &VolumeAttachment{}
+	assert.Equal(t, http.StatusCreated, client.do(ctx, http.MethodPost, attachmentsPath, &VolumeAttachmentRequest{Volume: &Reference{ID: volume.ID}}, attachment))
+	assert.Equal(t, StatusAttaching, attachment.Status)
+	assert.Equal(t, http.StatusConflict, client.do(ctx, http.MethodPost, "/v1/instances/instance-2/volume_attachments", &VolumeAttachmentRequest{Volume: &Reference{ID: volume.ID}}, nil))
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, attachmentsPath+"/"+attachment.ID, nil, attachment))
+	assert.Equal(t, StatusAttached, attachment.Status)
+	assert.Equal(t, http.StatusNotFound, client.do(ctx, http.MethodGet, "/v1/instances/instance-2/volume_attachments/"+attachment.ID, nil, nil))
+	attachments := &VolumeAttachmentList{}
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, attachmentsPath, nil, attachments))
+	assert.Equal(t, 1, len(attachments.VolumeAttachments))
+	stored, ok := client.server.Volume(volume.ID)
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(stored.VolumeAttachments))
+
+	// Snapshot and restore
+	snapshot := &Snapshot{}
+	assert.Equal(t, http.StatusCreated, client.do(ctx, http.MethodPost, "/v1/snapshots", snapshotRequest, snapshot))
+	assert.Equal(t, StatusPending, snapshot.LifecycleState)
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, "/v1/snapshots/"+snapshot.ID, nil, snapshot))
+	assert.Equal(t, StatusStable, snapshot.LifecycleState)
+	snapshots := &SnapshotList{}
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, "/v1/snapshots?source_volume.id="+volume.ID, nil, snapshots))
+	assert.Equal(t, 1, len(snapshots.Snapshots))
+	restored := &Volume{}
+	assert.Equal(t, http.StatusCreated, client.do(ctx, http.MethodPost, "/v1/volumes", &VolumeRequest{Name: "restored", Zone: zone, SourceSnapshot: &Reference{ID: snapshot.ID}}, restored))
+	assert.Equal(t, int64(20), restored.Capacity)
+	assert.Equal(t, snapshot.ID, restored.SourceSnapshot.ID)
+
+	// Delete is refused while attached or with snapshots
+	assert.Equal(t, http.StatusConflict, client.do(ctx, http.MethodDelete, "/v1/volumes/"+volume.ID, nil, nil))
+	assert.Equal(t, http.StatusNoContent, client.do(ctx, http.MethodDelete, attachmentsPath+"/"+attachment.ID, nil, nil))
+	assert.Equal(t, http.StatusConflict, client.do(ctx, http.MethodDelete, "/v1/volumes/"+volume.ID, nil, nil))
+	assert.Equal(t, http.StatusNoContent, client.do(ctx, http.MethodDelete, "/v1/snapshots/"+snapshot.ID, nil, nil))
+	assert.Equal(t, http.StatusNoContent, client.do(ctx, http.MethodDelete, "/v1/volumes/"+volume.ID, nil, nil))
+	response = &ErrorResponse{}
+	assert.Equal(t, http.StatusNotFound, client.do(ctx, http.MethodGet, "/v1/volumes/"+volume.ID, nil, response))
+	assert.Equal(t, "volume_not_found", errorCode(response))
+}
+
+func TestListVolumes(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	for _, name := range []string{"pvc-a", "pvc-b", "pvc-c"} {
+		assert.Equal(t, http.StatusCreated, client.do(ctx, http.MethodPost, "/v1/volumes", &VolumeRequest{Name: name, Capacity: 10, Zone: &Reference{Name: "us-south-1"}}, nil))
+	}
+
+	first := &VolumeList{}
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, "/v1/volumes?limit=2", nil, first))
+	assert.Equal(t, 2, len(first.Volumes))
+	assert.NotNil(t, first.Next)
+	next, err := url.Parse(first.Next.Href)
+	assert.Nil(t, err)
+	last := &VolumeList{}
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, next.RequestURI(), nil, last))
+	assert.Equal(t, 1, len(last.Volumes))
+	assert.Nil(t, last.Next)
+
+	filtered := &VolumeList{}
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, "/v1/volumes?name=pvc-b", nil, filtered))
+	assert.Equal(t, 1, len(filtered.Volumes))
+	assert.Equal(t, "pvc-b", filtered.Volumes[0].Name)
+
+	assert.Equal(t, http.StatusBadRequest, client.do(ctx, http.MethodGet, "/v1/volumes?limit=101", nil, nil))
+	assert.Equal(t, http.StatusBadRequest, client.do(ctx, http.MethodGet, "/v1/volumes?start=unknown", nil, nil))
+}
+
+func TestShares(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	share := &Share{}
+	assert.Equal(t, http.StatusCreated, client.do(ctx, http.MethodPost, "/v1/shares", &ShareRequest{Name: "share-1", Size: 10, Zone: &Reference{Name: "us-south-1"}}, share))
+	assert.Equal(t, StatusPending, share.LifecycleState)
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, "/v1/shares/"+share.ID, nil, share))
+	assert.Equal(t, StatusStable, share.LifecycleState)
+
+	targetsPath := "/v1/shares/" + share.ID + "/mount_targets"
+	target := &MountTarget{}
+	assert.Equal(t, http.StatusBadRequest, client.do(ctx, http.MethodPost, targetsPath, &MountTargetRequest{}, nil))
+	assert.Equal(t, http.StatusCreated, client.do(ctx, http.MethodPost, targetsPath, &MountTargetRequest{VPC: &Reference{ID: "vpc-1"}}, target))
+	assert.NotEmpty(t, target.MountPath)
+	assert.Equal(t, http.StatusConflict, client.do(ctx, http.MethodPost, targetsPath, &MountTargetRequest{VPC: &Reference{ID: "vpc-1"}}, nil))
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, targetsPath+"/"+target.ID, nil, target))
+	assert.Equal(t, StatusStable, target.LifecycleState)
+	targets := &MountTargetList{}
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, targetsPath, nil, targets))
+	assert.Equal(t, 1, len(targets.MountTargets))
+
+	// Mount targets are removed once read after delete
+	assert.Equal(t, http.StatusConflict, client.do(ctx, http.MethodDelete, "/v1/shares/"+share.ID, nil, nil))
+	assert.Equal(t, http.StatusAccepted, client.do(ctx, http.MethodDelete, targetsPath+"/"+target.ID, nil, target))
+	assert.Equal(t, StatusDeleting, target.LifecycleState)
+	assert.Equal(t, http.StatusNotFound, client.do(ctx, http.MethodGet, targetsPath+"/"+target.ID, nil, nil))
+	assert.Equal(t, http.StatusAccepted, client.do(ctx, http.MethodDelete, "/v1/shares/"+share.ID, nil, nil))
+	assert.Equal(t, http.StatusNotFound, client.do(ctx, http.MethodGet, "/v1/shares/"+share.ID, nil, nil))
+}
+
+func TestTags(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	crn := "crn:v1:bluemix:public:is:us-south:a/account::volume:vol-1"
+
+	attach := &TagResources{Resources: []TagResource{{ResourceID: crn}}, TagNames: []string{"clusterid:mycluster", "env:test"}}
+	results := &TagResults{}
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodPost, "/v3/tags/attach", attach, results))
+	assert.Equal(t, 1, len(results.Results))
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodPost, "/v3/tags/attach", attach, nil))
+	assert.Equal(t, []string{"clusterid:mycluster", "env:test"}, client.server.Tags(crn))
+
+	list := &TagList{}
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, "/v3/tags?attached_to="+url.QueryEscape(crn), nil, list))
+	assert.Equal(t, 2, list.TotalCount)
+
+	detach := &TagResources{Resources: []TagResource{{ResourceID: crn}}, TagNames: []string{"env:test"}}
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodPost, "/v3/tags/detach", detach, nil))
+	assert.Equal(t, []string{"clusterid:mycluster"}, client.server.Tags(crn))
+}
+
+func TestInjectFailure(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	// Twice, other routes are not affected
+	client.server.InjectFailure(RouteListVolumes, http.StatusServiceUnavailable, 2)
+	response := &ErrorResponse{}
+	assert.Equal(t, http.StatusServiceUnavailable, client.do(ctx, http.MethodGet, "/v1/volumes", nil, response))
+	assert.Equal(t, "injected_failure", errorCode(response))
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, "/v1/snapshots", nil, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, client.do(ctx, http.MethodGet, "/v1/volumes", nil, nil))
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, "/v1/volumes", nil, nil))
+	assert.Equal(t, 3, client.server.RequestCount(RouteListVolumes))
+
+	// All routes until cleared
+	client.server.InjectFailure(AllRoutes, http.StatusInternalServerError, 0)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusInternalServerError, client.do(ctx, http.MethodGet, "/v1/snapshots", nil, nil))
+	}
+	_, status := client.requestToken(DefaultAPIKey)
+	assert.Equal(t, http.StatusInternalServerError, status)
+	client.server.ClearFailures(AllRoutes)
+	assert.Equal(t, http.StatusOK, client.do(ctx, http.MethodGet, "/v1/snapshots", nil, nil))
+}
+
+func TestLatency(t *testing.T) {
+	client := newTestClient(t)
+
+	client.server.SetLatency(RouteListVolumes, 100*time.Millisecond)
+	start := time.Now()
+	assert.Equal(t, http.StatusOK, client.do(context.Background(), http.MethodGet, "/v1/volumes", nil, nil))
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	// Clients give up on their own deadline
+	client.server.SetLatency(AllRoutes, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, 0, client.do(ctx, http.MethodGet, "/v1/snapshots", nil, nil))
+}
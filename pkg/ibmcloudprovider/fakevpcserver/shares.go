@@ -0,0 +1,252 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fakevpcserver ...
+package fakevpcserver
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ShareRequest is the body of the create share call
+type ShareRequest struct {
+	Name          string     `json:"name,omitempty"`
+	Size          int64      `json:"size"`
+	Iops          int64      `json:"iops,omitempty"`
+	Profile       *Reference `json:"profile,omitempty"`
+	Zone          *Reference `json:"zone,omitempty"`
+	ResourceGroup *Reference `json:"resource_group,omitempty"`
+	UserTags      []string   `json:"user_tags,omitempty"`
+}
+
+// MountTargetRequest is the body of the create share mount target call
+type MountTargetRequest struct {
+	Name              string     `json:"name,omitempty"`
+	TransitEncryption string     `json:"transit_encryption,omitempty"`
+	VPC               *Reference `json:"vpc,omitempty"`
+}
+
+// createShare ...
+func (s *Server) createShare(w http.ResponseWriter, r *http.Request) {
+	request := &ShareRequest{}
+	if !decode(w, r, request) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if request.Zone == nil || request.Zone.Name == "" {
+		writeError(w, http.StatusBadRequest, "missing_field", "Zone is required")
+		return
+	}
+	if request.Size < MinVolumeCapacity || request.Size > MaxVolumeCapacity {
+		writeError(w, http.StatusBadRequest, "share_size_invalid", fmt.Sprintf("Size must be between %d and %d GiB", MinVolumeCapacity, MaxVolumeCapacity))
+		return
+	}
+	for _, share := range s.shares {
+		if request.Name != "" && share.Name == request.Name {
+			writeError(w, http.StatusBadRequest, "validation_unique_failed", fmt.Sprintf("The share name '%s' is already in use", request.Name))
+			return
+		}
+	}
+
+	id := s.nextID("r006-share")
+	if request.Name == "" {
+		request.Name = id
+	}
+	share := &Share{
+		ID:             id,
+		CRN:            s.crn("share", id),
+		Href:           s.href("/v1/shares/" + id),
+		Name:           request.Name,
+		Size:           request.Size,
+		Iops:           request.Iops,
+		LifecycleState: StatusPending,
+		Profile:        request.Profile,
+		Zone:           request.Zone,
+		ResourceGroup:  request.ResourceGroup,
+		UserTags:       request.UserTags,
+		MountTargets:   []*MountTarget{},
+		CreatedAt:      time.Now().UTC(),
+	}
+	s.shares[id] = share
+	writeJSON(w, http.StatusCreated, shareView(share))
+}
+
+// getShare ...
+func (s *Server) getShare(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	share, ok := s.findShare(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if share.LifecycleState == StatusPending {
+		share.LifecycleState = StatusStable
+	}
+	writeJSON(w, http.StatusOK, shareView(share))
+}
+
+// deleteShare refuses to delete shares with mount targets
+func (s *Server) deleteShare(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	share, ok := s.findShare(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if len(share.MountTargets) > 0 {
+		writeError(w, http.StatusConflict, "share_mount_targets_exist", fmt.Sprintf("Share %s has mount targets", share.ID))
+		return
+	}
+	delete(s.shares, share.ID)
+	delete(s.tags, share.CRN)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// createMountTarget ...
+func (s *Server) createMountTarget(w http.ResponseWriter, r *http.Request) {
+	request := &MountTargetRequest{}
+	if !decode(w, r, request) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	share, ok := s.findShare(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if request.VPC == nil || request.VPC.ID == "" {
+		writeError(w, http.StatusBadRequest, "missing_field", "VPC is required")
+		return
+	}
+	for _, target := range share.MountTargets {
+		if target.VPC.ID == request.VPC.ID {
+			writeError(w, http.StatusConflict, "share_mount_target_vpc_exists", fmt.Sprintf("Share %s already has a mount target in VPC %s", share.ID, request.VPC.ID))
+			return
+		}
+	}
+
+	id := s.nextID("r006-mount-target")
+	if request.Name == "" {
+		request.Name = id
+	}
+	target := &MountTarget{
+		ID:                id,
+		Href:              s.href(fmt.Sprintf("/v1/shares/%s/mount_targets/%s", share.ID, id)),
+		Name:              request.Name,
+		LifecycleState:    StatusPending,
+		MountPath:         fmt.Sprintf("fsf-fake.%s.file-storage.appdomain.cloud:/%s", s.Region, share.ID),
+		TransitEncryption: request.TransitEncryption,
+		VPC:               request.VPC,
+		CreatedAt:         time.Now().UTC(),
+	}
+	share.MountTargets = append(share.MountTargets, target)
+	view := *target
+	writeJSON(w, http.StatusCreated, &view)
+}
+
+// listMountTargets ...
+func (s *Server) listMountTargets(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	share, ok := s.findShare(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, &MountTargetList{MountTargets: shareView(share).MountTargets})
+}
+
+// getMountTarget ...
+func (s *Server) getMountTarget(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	target, ok := s.findMountTarget(w, r)
+	if !ok {
+		return
+	}
+	if target.LifecycleState == StatusPending {
+		target.LifecycleState = StatusStable
+	}
+	view := *target
+	writeJSON(w, http.StatusOK, &view)
+}
+
+// deleteMountTarget marks the mount target deleting, it is removed the next time it is read
+func (s *Server) deleteMountTarget(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	target, ok := s.findMountTarget(w, r)
+	if !ok {
+		return
+	}
+	target.LifecycleState = StatusDeleting
+	view := *target
+	writeJSON(w, http.StatusAccepted, &view)
+}
+
+// findShare returns the share or writes a not found response, the caller must hold the mutex
+func (s *Server) findShare(w http.ResponseWriter, id string) (*Share, bool) {
+	share, ok := s.shares[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "share_not_found", fmt.Sprintf("Share %s not found", id))
+	}
+	return share, ok
+}
+
+// findMountTarget returns the mount target of the request path or writes a not found response.
+// Deleting mount targets are removed once read, the caller must hold the mutex.
+func (s *Server) findMountTarget(w http.ResponseWriter, r *http.Request) (*MountTarget, bool) {
+	share, ok := s.findShare(w, r.PathValue("id"))
+	if !ok {
+		return nil, false
+	}
+	for _, target := range share.MountTargets {
+		if target.ID != r.PathValue("target_id") {
+			continue
+		}
+		if target.LifecycleState == StatusDeleting && r.Method == http.MethodGet {
+			removeMountTarget(share, target.ID)
+			break
+		}
+		return target, true
+	}
+	writeError(w, http.StatusNotFound, "share_mount_target_not_found", fmt.Sprintf("Mount target %s not found", r.PathValue("target_id")))
+	return nil, false
+}
+
+// removeMountTarget ...
+func removeMountTarget(share *Share, id string) {
+	for i, target := range share.MountTargets {
+		if target.ID == id {
+			share.MountTargets = append(share.MountTargets[:i], share.MountTargets[i+1:]...)
+			return
+		}
+	}
+}
+
+// shareView returns a copy of the share and its mount targets
+func shareView(share *Share) *Share {
+	view := *share
+	view.UserTags = append([]string(nil), share.UserTags...)
+	view.MountTargets = make([]*MountTarget, 0, len(share.MountTargets))
+	for _, target := range share.MountTargets {
+		targetView := *target
+		view.MountTargets = append(view.MountTargets, &targetView)
+	}
+	return &view
+}
@@ -0,0 +1,109 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fakevpcserver ...
+package fakevpcserver
+
+import (
+	"net/http"
+	"sort"
+)
+
+// listTags lists the tags attached to the attached_to CRN, all known tags if it is not set
+func (s *Server) listTags(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var names []string
+	if crn := r.URL.Query().Get("attached_to"); crn != "" {
+		names = append(names, s.tags[crn]...)
+	} else {
+		unique := map[string]bool{}
+		for _, tags := range s.tags {
+			for _, tag := range tags {
+				if !unique[tag] {
+					unique[tag] = true
+					names = append(names, tag)
+				}
+			}
+		}
+		sort.Strings(names)
+	}
+
+	list := &TagList{TotalCount: len(names), Limit: len(names), Items: []TagItem{}}
+	for _, name := range names {
+		list.Items = append(list.Items, TagItem{Name: name})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// attachTags attaches the tags to the resources, tags already attached are ignored
+func (s *Server) attachTags(w http.ResponseWriter, r *http.Request) {
+	request := &TagResources{}
+	if !decode(w, r, request) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	results := &TagResults{Results: []TagResource{}}
+	for _, resource := range request.Resources {
+		tags := s.tags[resource.ResourceID]
+		for _, name := range request.TagNames {
+			if !contains(tags, name) {
+				tags = append(tags, name)
+			}
+		}
+		s.tags[resource.ResourceID] = tags
+		results.Results = append(results.Results, TagResource{ResourceID: resource.ResourceID})
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// detachTags detaches the tags from the resources
+func (s *Server) detachTags(w http.ResponseWriter, r *http.Request) {
+	request := &TagResources{}
+	if !decode(w, r, request) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	results := &TagResults{Results: []TagResource{}}
+	for _, resource := range request.Resources {
+		var tags []string
+		for _, name := range s.tags[resource.ResourceID] {
+			if !contains(request.TagNames, name) {
+				tags = append(tags, name)
+			}
+		}
+		if len(tags) == 0 {
+			delete(s.tags, resource.ResourceID)
+		} else {
+			s.tags[resource.ResourceID] = tags
+		}
+		results.Results = append(results.Results, TagResource{ResourceID: resource.ResourceID})
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// contains ...
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fakevpcserver ...
+package fakevpcserver
+
+import (
+	"time"
+)
+
+// Reference is a named reference to another resource i.e zone, profile, instance
+type Reference struct {
+	ID   string `json:"id,omitempty"`
+	CRN  string `json:"crn,omitempty"`
+	Name string `json:"name,omitempty"`
+	Href string `json:"href,omitempty"`
+}
+
+// Volume is a VPC block volume
+type Volume struct {
+	ID                string             `json:"id"`
+	CRN               string             `json:"crn"`
+	Href              string             `json:"href"`
+	Name              string             `json:"name"`
+	Capacity          int64              `json:"capacity"`
+	Iops              int64              `json:"iops,omitempty"`
+	Status            string             `json:"status"`
+	Profile           *Reference         `json:"profile,omitempty"`
+	Zone              *Reference         `json:"zone,omitempty"`
+	ResourceGroup     *Reference         `json:"resource_group,omitempty"`
+	EncryptionKey     *Reference         `json:"encryption_key,omitempty"`
+	SourceSnapshot    *Reference         `json:"source_snapshot,omitempty"`
+	UserTags          []string           `json:"user_tags,omitempty"`
+	CreatedAt         time.Time          `json:"created_at"`
+	VolumeAttachments []VolumeAttachment `json:"volume_attachments"`
+}
+
+// VolumeList ...
+type VolumeList struct {
+	Volumes []*Volume  `json:"volumes"`
+	Limit   int        `json:"limit"`
+	First   *Reference `json:"first,omitempty"`
+	Next    *Reference `json:"next,omitempty"`
+}
+
+// Snapshot is a VPC block volume snapshot
+type Snapshot struct {
+	ID              string     `json:"id"`
+	CRN             string     `json:"crn"`
+	Href            string     `json:"href"`
+	Name            string     `json:"name"`
+	LifecycleState  string     `json:"lifecycle_state"`
+	MinimumCapacity int64      `json:"minimum_capacity"`
+	Size            int64      `json:"size"`
+	SourceVolume    *Reference `json:"source_volume"`
+	UserTags        []string   `json:"user_tags,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// SnapshotList ...
+type SnapshotList struct {
+	Snapshots []*Snapshot `json:"snapshots"`
+	Limit     int         `json:"limit"`
+	First     *Reference  `json:"first,omitempty"`
+	Next      *Reference  `json:"next,omitempty"`
+}
+
+// VolumeAttachment is the attachment of a volume to an instance
+type VolumeAttachment struct {
+	ID                           string     `json:"id"`
+	Href                         string     `json:"href"`
+	Name                         string     `json:"name"`
+	Status                       string     `json:"status,omitempty"`
+	Type                         string     `json:"type,omitempty"`
+	DeleteVolumeOnInstanceDelete bool       `json:"delete_volume_on_instance_delete"`
+	Device                       *Reference `json:"device,omitempty"`
+	Volume                       *Reference `json:"volume,omitempty"`
+	Instance                     *Reference `json:"instance,omitempty"`
+	CreatedAt                    time.Time  `json:"created_at"`
+}
+
+// VolumeAttachmentList ...
+type VolumeAttachmentList struct {
+	VolumeAttachments []*VolumeAttachment `json:"volume_attachments"`
+}
+
+// Share is a VPC file share
+type Share struct {
+	ID             string         `json:"id"`
+	CRN            string         `json:"crn"`
+	Href           string         `json:"href"`
+	Name           string         `json:"name"`
+	Size           int64          `json:"size"`
+	Iops           int64          `json:"iops,omitempty"`
+	LifecycleState string         `json:"lifecycle_state"`
+	Profile        *Reference     `json:"profile,omitempty"`
+	Zone           *Reference     `json:"zone,omitempty"`
+	ResourceGroup  *Reference     `json:"resource_group,omitempty"`
+	UserTags       []string       `json:"user_tags,omitempty"`
+	MountTargets   []*MountTarget `json:"mount_targets"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+// MountTarget is a share mount target, the access point of a file share
+type MountTarget struct {
+	ID                string     `json:"id"`
+	Href              string     `json:"href"`
+	Name              string     `json:"name"`
+	LifecycleState    string     `json:"lifecycle_state"`
+	MountPath         string     `json:"mount_path,omitempty"`
+	TransitEncryption string     `json:"transit_encryption,omitempty"`
+	VPC               *Reference `json:"vpc,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// MountTargetList ...
+type MountTargetList struct {
+	MountTargets []*MountTarget `json:"mount_targets"`
+}
+
+// TagResources is the request of the global tagging attach and detach calls
+type TagResources struct {
+	Resources []TagResource `json:"resources"`
+	TagNames  []string      `json:"tag_names"`
+}
+
+// TagResource ...
+type TagResource struct {
+	ResourceID string `json:"resource_id"`
+	IsError    bool   `json:"is_error,omitempty"`
+}
+
+// TagResults is the response of the global tagging attach and detach calls
+type TagResults struct {
+	Results []TagResource `json:"results"`
+}
+
+// TagList is the response of the global tagging list call
+type TagList struct {
+	TotalCount int       `json:"total_count"`
+	Offset     int       `json:"offset"`
+	Limit      int       `json:"limit"`
+	Items      []TagItem `json:"items"`
+}
+
+// TagItem ...
+type TagItem struct {
+	Name string `json:"name"`
+}
+
+// Token is the IAM token response
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Expiration   int64  `json:"expiration"`
+}
+
+// Error is a VPC API error
+type Error struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	MoreInfo string `json:"more_info,omitempty"`
+}
+
+// ErrorResponse is the body of failed VPC API calls
+type ErrorResponse struct {
+	Errors []Error `json:"errors"`
+	Trace  string  `json:"trace"`
+}
+
+// IAMErrorResponse is the body of failed IAM calls
+type IAMErrorResponse struct {
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
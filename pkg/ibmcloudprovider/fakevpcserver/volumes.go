@@ -0,0 +1,528 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fakevpcserver ...
+package fakevpcserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// MinVolumeCapacity in GiB
+	MinVolumeCapacity = 10
+
+	// MaxVolumeCapacity in GiB
+	MaxVolumeCapacity = 16000
+
+	defaultListLimit = 50
+	maxListLimit     = 100
+)
+
+// Volume, snapshot, attachment and share states. Resources are returned pending by the create
+// call and become available, stable or attached once read, so clients exercise their wait loops.
+const (
+	StatusPending   = "pending"
+	StatusAvailable = "available"
+	StatusStable    = "stable"
+	StatusAttaching = "attaching"
+	StatusAttached  = "attached"
+	StatusDeleting  = "deleting"
+)
+
+// VolumeRequest is the body of the create and update volume calls
+type VolumeRequest struct {
+	Name           string     `json:"name,omitempty"`
+	Capacity       int64      `json:"capacity,omitempty"`
+	Iops           int64      `json:"iops,omitempty"`
+	Profile        *Reference `json:"profile,omitempty"`
+	Zone           *Reference `json:"zone,omitempty"`
+	ResourceGroup  *Reference `json:"resource_group,omitempty"`
+	EncryptionKey  *Reference `json:"encryption_key,omitempty"`
+	SourceSnapshot *Reference `json:"source_snapshot,omitempty"`
+	UserTags       []string   `json:"user_tags,omitempty"`
+}
+
+// SnapshotRequest is the body of the create snapshot call
+type SnapshotRequest struct {
+	Name         string     `json:"name,omitempty"`
+	SourceVolume *Reference `json:"source_volume"`
+	UserTags     []string   `json:"user_tags,omitempty"`
+}
+
+// VolumeAttachmentRequest is the body of the create volume attachment call
+type VolumeAttachmentRequest struct {
+	Name                         string     `json:"name,omitempty"`
+	Volume                       *Reference `json:"volume"`
+	DeleteVolumeOnInstanceDelete bool       `json:"delete_volume_on_instance_delete"`
+}
+
+// createVolume ...
+func (s *Server) createVolume(w http.ResponseWriter, r *http.Request) {
+	request := &VolumeRequest{}
+	if !decode(w, r, request) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if request.Zone == nil || request.Zone.Name == "" {
+		writeError(w, http.StatusBadRequest, "missing_field", "Zone is required")
+		return
+	}
+	if request.Name != "" && s.volumeByName(request.Name) != nil {
+		writeError(w, http.StatusBadRequest, "validation_unique_failed", fmt.Sprintf("The volume name '%s' is already in use", request.Name))
+		return
+	}
+	if request.SourceSnapshot != nil {
+		snapshot, ok := s.snapshots[request.SourceSnapshot.ID]
+		if !ok {
+			writeError(w, http.StatusNotFound, "snapshot_not_found", fmt.Sprintf("Snapshot %s not found", request.SourceSnapshot.ID))
+			return
+		}
+		if request.Capacity == 0 {
+			request.Capacity = snapshot.MinimumCapacity
+		}
+		request.SourceSnapshot = &Reference{ID: snapshot.ID, CRN: snapshot.CRN, Name: snapshot.Name}
+	}
+	if request.Capacity < MinVolumeCapacity || request.Capacity > MaxVolumeCapacity {
+		writeError(w, http.StatusBadRequest, "volume_capacity_invalid", fmt.Sprintf("Capacity must be between %d and %d GiB", MinVolumeCapacity, MaxVolumeCapacity))
+		return
+	}
+
+	id := s.nextID("r006-volume")
+	if request.Name == "" {
+		request.Name = id
+	}
+	volume := &Volume{
+		ID:             id,
+		CRN:            s.crn("volume", id),
+		Href:           s.href("/v1/volumes/" + id),
+		Name:           request.Name,
+		Capacity:       request.Capacity,
+		Iops:           request.Iops,
+		Status:         StatusPending,
+		Profile:        request.Profile,
+		Zone:           request.Zone,
+		ResourceGroup:  request.ResourceGroup,
+		EncryptionKey:  request.EncryptionKey,
+		SourceSnapshot: request.SourceSnapshot,
+		UserTags:       request.UserTags,
+		CreatedAt:      time.Now().UTC(),
+	}
+	s.volumes[id] = volume
+	writeJSON(w, http.StatusCreated, s.volumeView(volume))
+}
+
+// listVolumes supports the name and zone.name filters
+func (s *Server) listVolumes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var ids []string
+	for id, volume := range s.volumes {
+		if name := query.Get("name"); name != "" && volume.Name != name {
+			continue
+		}
+		if zone := query.Get("zone.name"); zone != "" && (volume.Zone == nil || volume.Zone.Name != zone) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	page, limit, next, ok := s.paginate(w, r, ids)
+	if !ok {
+		return
+	}
+	list := &VolumeList{Volumes: []*Volume{}, Limit: limit, First: &Reference{Href: s.pageHref(r, "", limit)}}
+	for _, id := range page {
+		list.Volumes = append(list.Volumes, s.volumeView(s.volumes[id]))
+	}
+	if next != "" {
+		list.Next = &Reference{Href: s.pageHref(r, next, limit)}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// getVolume ...
+func (s *Server) getVolume(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	volume, ok := s.findVolume(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if volume.Status == StatusPending {
+		volume.Status = StatusAvailable
+	}
+	writeJSON(w, http.StatusOK, s.volumeView(volume))
+}
+
+// updateVolume supports changing the name, capacity, IOPS and user tags, capacity can only grow
+func (s *Server) updateVolume(w http.ResponseWriter, r *http.Request) {
+	request := &VolumeRequest{}
+	if !decode(w, r, request) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	volume, ok := s.findVolume(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if request.Capacity != 0 && (request.Capacity < volume.Capacity || request.Capacity > MaxVolumeCapacity) {
+		writeError(w, http.StatusBadRequest, "volume_capacity_invalid", fmt.Sprintf("Capacity can only be increased, up to %d GiB", MaxVolumeCapacity))
+		return
+	}
+	if request.Name != "" && request.Name != volume.Name && s.volumeByName(request.Name) != nil {
+		writeError(w, http.StatusBadRequest, "validation_unique_failed", fmt.Sprintf("The volume name '%s' is already in use", request.Name))
+		return
+	}
+
+	if request.Name != "" {
+		volume.Name = request.Name
+	}
+	if request.Capacity != 0 {
+		volume.Capacity = request.Capacity
+	}
+	if request.Iops != 0 {
+		volume.Iops = request.Iops
+	}
+	if request.UserTags != nil {
+		volume.UserTags = request.UserTags
+	}
+	writeJSON(w, http.StatusOK, s.volumeView(volume))
+}
+
+// deleteVolume refuses to delete attached volumes or volumes with snapshots
+func (s *Server) deleteVolume(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	volume, ok := s.findVolume(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if len(s.volumeAttachments(volume.ID)) > 0 {
+		writeError(w, http.StatusConflict, "volume_in_use", fmt.Sprintf("Volume %s is attached to an instance", volume.ID))
+		return
+	}
+	for _, snapshot := range s.snapshots {
+		if snapshot.SourceVolume.ID == volume.ID {
+			writeError(w, http.StatusConflict, "volume_has_snapshots", fmt.Sprintf("Volume %s has snapshots", volume.ID))
+			return
+		}
+	}
+	delete(s.volumes, volume.ID)
+	delete(s.tags, volume.CRN)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createSnapshot requires the source volume to be attached, as VPC does
+func (s *Server) createSnapshot(w http.ResponseWriter, r *http.Request) {
+	request := &SnapshotRequest{}
+	if !decode(w, r, request) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if request.SourceVolume == nil {
+		writeError(w, http.StatusBadRequest, "missing_field", "Source volume is required")
+		return
+	}
+	volume, ok := s.findVolume(w, request.SourceVolume.ID)
+	if !ok {
+		return
+	}
+	if len(s.volumeAttachments(volume.ID)) == 0 {
+		writeError(w, http.StatusBadRequest, "snapshot_source_volume_not_attached", fmt.Sprintf("Volume %s is not attached to a running instance", volume.ID))
+		return
+	}
+
+	id := s.nextID("r006-snapshot")
+	if request.Name == "" {
+		request.Name = id
+	}
+	snapshot := &Snapshot{
+		ID:              id,
+		CRN:             s.crn("snapshot", id),
+		Href:            s.href("/v1/snapshots/" + id),
+		Name:            request.Name,
+		LifecycleState:  StatusPending,
+		MinimumCapacity: volume.Capacity,
+		Size:            volume.Capacity,
+		SourceVolume:    &Reference{ID: volume.ID, CRN: volume.CRN, Name: volume.Name},
+		UserTags:        request.UserTags,
+		CreatedAt:       time.Now().UTC(),
+	}
+	s.snapshots[id] = snapshot
+	view := *snapshot
+	writeJSON(w, http.StatusCreated, &view)
+}
+
+// listSnapshots supports the name and source_volume.id filters
+func (s *Server) listSnapshots(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var ids []string
+	for id, snapshot := range s.snapshots {
+		if name := query.Get("name"); name != "" && snapshot.Name != name {
+			continue
+		}
+		if volumeID := query.Get("source_volume.id"); volumeID != "" && snapshot.SourceVolume.ID != volumeID {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	page, limit, next, ok := s.paginate(w, r, ids)
+	if !ok {
+		return
+	}
+	list := &SnapshotList{Snapshots: []*Snapshot{}, Limit: limit, First: &Reference{Href: s.pageHref(r, "", limit)}}
+	for _, id := range page {
+		view := *s.snapshots[id]
+		list.Snapshots = append(list.Snapshots, &view)
+	}
+	if next != "" {
+		list.Next = &Reference{Href: s.pageHref(r, next, limit)}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// getSnapshot ...
+func (s *Server) getSnapshot(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot, ok := s.snapshots[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "snapshot_not_found", fmt.Sprintf("Snapshot %s not found", r.PathValue("id")))
+		return
+	}
+	if snapshot.LifecycleState == StatusPending {
+		snapshot.LifecycleState = StatusStable
+	}
+	view := *snapshot
+	writeJSON(w, http.StatusOK, &view)
+}
+
+// deleteSnapshot ...
+func (s *Server) deleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot, ok := s.snapshots[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "snapshot_not_found", fmt.Sprintf("Snapshot %s not found", r.PathValue("id")))
+		return
+	}
+	delete(s.snapshots, snapshot.ID)
+	delete(s.tags, snapshot.CRN)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createAttachment attaches a volume to at most one instance
+func (s *Server) createAttachment(w http.ResponseWriter, r *http.Request) {
+	request := &VolumeAttachmentRequest{}
+	if !decode(w, r, request) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if request.Volume == nil {
+		writeError(w, http.StatusBadRequest, "missing_field", "Volume is required")
+		return
+	}
+	volume, ok := s.findVolume(w, request.Volume.ID)
+	if !ok {
+		return
+	}
+	if len(s.volumeAttachments(volume.ID)) > 0 {
+		writeError(w, http.StatusConflict, "volume_attachment_already_exists", fmt.Sprintf("Volume %s is already attached", volume.ID))
+		return
+	}
+
+	instanceID := r.PathValue("instance_id")
+	id := s.nextID("r006-attachment")
+	if request.Name == "" {
+		request.Name = id
+	}
+	attachment := &VolumeAttachment{
+		ID:                           id,
+		Href:                         s.href(fmt.Sprintf("/v1/instances/%s/volume_attachments/%s", instanceID, id)),
+		Name:                         request.Name,
+		Status:                       StatusAttaching,
+		Type:                         "data",
+		DeleteVolumeOnInstanceDelete: request.DeleteVolumeOnInstanceDelete,
+		Device:                       &Reference{ID: id + "-device"},
+		Volume:                       &Reference{ID: volume.ID, CRN: volume.CRN, Name: volume.Name},
+		Instance:                     &Reference{ID: instanceID},
+		CreatedAt:                    time.Now().UTC(),
+	}
+	s.attachments[id] = attachment
+	view := *attachment
+	writeJSON(w, http.StatusCreated, &view)
+}
+
+// listAttachments lists the volume attachments of the instance
+func (s *Server) listAttachments(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	list := &VolumeAttachmentList{VolumeAttachments: []*VolumeAttachment{}}
+	for _, id := range sortedKeys(s.attachments) {
+		attachment := s.attachments[id]
+		if attachment.Instance.ID == r.PathValue("instance_id") {
+			view := *attachment
+			list.VolumeAttachments = append(list.VolumeAttachments, &view)
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// getAttachment ...
+func (s *Server) getAttachment(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	attachment, ok := s.findAttachment(w, r)
+	if !ok {
+		return
+	}
+	if attachment.Status == StatusAttaching {
+		attachment.Status = StatusAttached
+	}
+	view := *attachment
+	writeJSON(w, http.StatusOK, &view)
+}
+
+// deleteAttachment detaches the volume, the attachment is gone once the call returns
+func (s *Server) deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	attachment, ok := s.findAttachment(w, r)
+	if !ok {
+		return
+	}
+	delete(s.attachments, attachment.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findVolume returns the volume or writes a not found response, the caller must hold the mutex
+func (s *Server) findVolume(w http.ResponseWriter, id string) (*Volume, bool) {
+	volume, ok := s.volumes[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "volume_not_found", fmt.Sprintf("Volume %s not found", id))
+	}
+	return volume, ok
+}
+
+// findAttachment returns the attachment of the request path or writes a not found response, the caller must hold the mutex
+func (s *Server) findAttachment(w http.ResponseWriter, r *http.Request) (*VolumeAttachment, bool) {
+	attachment, ok := s.attachments[r.PathValue("id")]
+	if !ok || attachment.Instance.ID != r.PathValue("instance_id") {
+		writeError(w, http.StatusNotFound, "volume_attachment_not_found", fmt.Sprintf("Volume attachment %s not found", r.PathValue("id")))
+		return nil, false
+	}
+	return attachment, true
+}
+
+// volumeByName returns the volume with the given name, the caller must hold the mutex
+func (s *Server) volumeByName(name string) *Volume {
+	for _, volume := range s.volumes {
+		if volume.Name == name {
+			return volume
+		}
+	}
+	return nil
+}
+
+// volumeAttachments returns the attachments of the volume, the caller must hold the mutex
+func (s *Server) volumeAttachments(volumeID string) []VolumeAttachment {
+	attachments := []VolumeAttachment{}
+	for _, id := range sortedKeys(s.attachments) {
+		if attachment := s.attachments[id]; attachment.Volume.ID == volumeID {
+			attachments = append(attachments, *attachment)
+		}
+	}
+	return attachments
+}
+
+// volumeView returns a copy of the volume including its attachments, the caller must hold the mutex
+func (s *Server) volumeView(volume *Volume) *Volume {
+	view := *volume
+	view.UserTags = append([]string(nil), volume.UserTags...)
+	view.VolumeAttachments = s.volumeAttachments(volume.ID)
+	return &view
+}
+
+// paginate returns the page of the sorted IDs selected by the start and limit query parameters and
+// the start of the next page, writing a bad request response if they are invalid
+func (s *Server) paginate(w http.ResponseWriter, r *http.Request, ids []string) ([]string, int, string, bool) {
+	sort.Strings(ids)
+	query := r.URL.Query()
+
+	limit := defaultListLimit
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			writeError(w, http.StatusBadRequest, "bad_request", fmt.Sprintf("Limit must be between 1 and %d", maxListLimit))
+			return nil, 0, "", false
+		}
+	}
+
+	first := 0
+	if start := query.Get("start"); start != "" {
+		first = sort.SearchStrings(ids, start)
+		if first == len(ids) || ids[first] != start {
+			writeError(w, http.StatusBadRequest, "bad_request", fmt.Sprintf("Invalid start %s", start))
+			return nil, 0, "", false
+		}
+	}
+
+	last := first + limit
+	if last >= len(ids) {
+		return ids[first:], limit, "", true
+	}
+	return ids[first:last], limit, ids[last], true
+}
+
+// pageHref returns the URL of the list page starting at start, keeping the filters of the request
+func (s *Server) pageHref(r *http.Request, start string, limit int) string {
+	query := url.Values{}
+	for key, values := range r.URL.Query() {
+		query[key] = values
+	}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Del("start")
+	if start != "" {
+		query.Set("start", start)
+	}
+	return s.href(r.URL.Path + "?" + query.Encode())
+}
+
+// sortedKeys returns the keys of the map in order, so responses are deterministic
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,940 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	util "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+)
+
+const (
+	// MinVolumeCapacity is the minimum capacity of a volume in GiB
+	MinVolumeCapacity = 10
+
+	// MaxVolumeCapacity is the maximum capacity of a volume in GiB
+	MaxVolumeCapacity = 16000
+
+	// maxListLimit is the maximum page size of list calls
+	maxListLimit = 100
+
+	// defaultListLimit is the page size of list calls if the limit is not set
+	defaultListLimit = 50
+)
+
+// Attachment and access point states
+const (
+	// StatusAttaching attachment is created but the volume is not yet attached
+	StatusAttaching = "attaching"
+
+	// StatusAttached volume is attached
+	StatusAttached = "attached"
+
+	// StatusDetaching detach is requested but the volume is not yet detached
+	StatusDetaching = "detaching"
+
+	// StatusPending access point is created but not yet usable
+	StatusPending = "pending"
+
+	// StatusStable access point is usable
+	StatusStable = "stable"
+
+	// StatusDeleting access point delete is requested
+	StatusDeleting = "deleting"
+)
+
+// Operation names used for error injection, same as the provider.Session method names
+const (
+	OpCreateVolume                = "CreateVolume"
+	OpCreateVolumeFromSnapshot    = "CreateVolumeFromSnapshot"
+	OpUpdateVolume                = "UpdateVolume"
+	OpDeleteVolume                = "DeleteVolume"
+	OpGetVolume                   = "GetVolume"
+	OpGetVolumeByName             = "GetVolumeByName"
+	OpListVolumes                 = "ListVolumes"
+	OpExpandVolume                = "ExpandVolume"
+	OpAttachVolume                = "AttachVolume"
+	OpDetachVolume                = "DetachVolume"
+	OpWaitForAttachVolume         = "WaitForAttachVolume"
+	OpWaitForDetachVolume         = "WaitForDetachVolume"
+	OpGetVolumeAttachment         = "GetVolumeAttachment"
+	OpCreateSnapshot              = "CreateSnapshot"
+	OpDeleteSnapshot              = "DeleteSnapshot"
+	OpGetSnapshot                 = "GetSnapshot"
+	OpGetSnapshotByName           = "GetSnapshotByName"
+	OpListSnapshots               = "ListSnapshots"
+	OpCreateVolumeAccessPoint     = "CreateVolumeAccessPoint"
+	OpDeleteVolumeAccessPoint     = "DeleteVolumeAccessPoint"
+	OpWaitForCreateAccessPoint    = "WaitForCreateVolumeAccessPoint"
+	OpWaitForDeleteAccessPoint    = "WaitForDeleteVolumeAccessPoint"
+	OpGetVolumeAccessPoint        = "GetVolumeAccessPoint"
+	OpGetSubnetForAccessPoint     = "GetSubnetForVolumeAccessPoint"
+	OpGetSecurityGroupAccessPoint = "GetSecurityGroupForVolumeAccessPoint"
+)
+
+// memoryAttachment is a volume attachment of MemorySession
+type memoryAttachment struct {
+	id         string
+	instanceID string
+	status     string
+	createdAt  time.Time
+}
+
+// memoryAccessPoint is a file share access point of MemorySession
+type memoryAccessPoint struct {
+	id        string
+	volumeID  string
+	status    string
+	createdAt time.Time
+}
+
+// injectedError is returned by an operation, count times or until cleared if count is 0
+type injectedError struct {
+	err   error
+	count int
+}
+
+// MemorySession is a provider.Session keeping volumes, snapshots, attachments and access points in memory.
+// It enforces the state transitions of the VPC backend and returns util.Message errors of the same types, i.e
+// an attached volume or a volume with snapshots can not be deleted, and a block volume is attached to a single instance.
+// Errors can be injected per operation with InjectError.
+type MemorySession struct {
+	providerName provider.VolumeProvider
+	volumeType   provider.VolumeType
+
+	// CapacityQuota is the total capacity in GiB of all the volumes, unlimited if zero
+	CapacityQuota int
+
+	// SubnetID and SecurityGroupID are returned for access point subnet and security group lookups
+	SubnetID        string
+	SecurityGroupID string
+
+	mutex        sync.Mutex
+	nextID       int
+	volumes      map[string]*provider.Volume
+	snapshots    map[string]*provider.Snapshot
+	attachments  map[string]*memoryAttachment
+	accessPoints map[string]*memoryAccessPoint
+	errors       map[string]*injectedError
+}
+
+var _ provider.Session = &MemorySession{}
+
+// NewMemorySession ...
+func NewMemorySession(providerName provider.VolumeProvider, volumeType provider.VolumeType) *MemorySession {
+	return &MemorySession{
+		providerName: providerName,
+		volumeType:   volumeType,
+		volumes:      map[string]*provider.Volume{},
+		snapshots:    map[string]*provider.Snapshot{},
+		attachments:  map[string]*memoryAttachment{},
+		accessPoints: map[string]*memoryAccessPoint{},
+		errors:       map[string]*injectedError{},
+	}
+}
+
+// InjectError makes the operation return err for the next count calls, or until ClearError if count is 0
+func (ms *MemorySession) InjectError(operation string, err error, count int) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.errors[operation] = &injectedError{err: err, count: count}
+}
+
+// ClearError stops returning the injected error of the operation
+func (ms *MemorySession) ClearError(operation string) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	delete(ms.errors, operation)
+}
+
+// injected returns the error injected for the operation, the caller must hold the mutex
+func (ms *MemorySession) injected(operation string) error {
+	injected, ok := ms.errors[operation]
+	if !ok {
+		return nil
+	}
+	if injected.count > 0 {
+		injected.count--
+		if injected.count == 0 {
+			delete(ms.errors, operation)
+		}
+	}
+	return injected.err
+}
+
+// newID returns a unique ID with the given prefix, the caller must hold the mutex
+func (ms *MemorySession) newID(prefix string) string {
+	ms.nextID++
+	return fmt.Sprintf("%s-%08d", prefix, ms.nextID)
+}
+
+// newMessage ...
+func newMessage(code string, errType string, rc int, format string, args ...interface{}) error {
+	return util.Message{Code: code, Type: errType, RC: rc, Description: fmt.Sprintf(format, args...)}
+}
+
+// volumeNotFound ...
+func volumeNotFound(volumeID string) error {
+	return newMessage("StorageFindFailedWithVolumeId", util.EntityNotFound, http.StatusNotFound, "A volume with the specified volume ID '%s' could not be found.", volumeID)
+}
+
+// snapshotNotFound ...
+func snapshotNotFound(snapshotID string) error {
+	return newMessage("StorageFindFailedWithSnapshotId", util.EntityNotFound, http.StatusNotFound, "No volume snapshot could be found with the specified snapshot ID '%s'.", snapshotID)
+}
+
+// ProviderName ...
+func (ms *MemorySession) ProviderName() provider.VolumeProvider {
+	return ms.providerName
+}
+
+// Type ...
+func (ms *MemorySession) Type() provider.VolumeType {
+	return ms.volumeType
+}
+
+// GetProviderDisplayName ...
+func (ms *MemorySession) GetProviderDisplayName() provider.VolumeProvider {
+	return ms.providerName
+}
+
+// Close ...
+func (ms *MemorySession) Close() {
+}
+
+// usedCapacity returns the total capacity of all the volumes, the caller must hold the mutex
+func (ms *MemorySession) usedCapacity() int {
+	used := 0
+	for _, volume := range ms.volumes {
+		used += *volume.Capacity
+	}
+	return used
+}
+
+// checkCapacity validates a new volume capacity, the caller must hold the mutex
+func (ms *MemorySession) checkCapacity(capacity int, additional int) error {
+	if capacity < MinVolumeCapacity || capacity > MaxVolumeCapacity {
+		return newMessage("VolumeCapacityInvalid", util.InvalidRequest, http.StatusBadRequest, "Volume capacity %d GiB is not in the range of %d-%d GiB.", capacity, MinVolumeCapacity, MaxVolumeCapacity)
+	}
+	if ms.CapacityQuota > 0 && ms.usedCapacity()+additional > ms.CapacityQuota {
+		return newMessage("VolumeQuotaExceeded", util.ProvisioningFailed, http.StatusBadRequest, "Volume capacity quota of %d GiB exceeded.", ms.CapacityQuota)
+	}
+	return nil
+}
+
+// findVolumeByName returns the volume with the given name, the caller must hold the mutex
+func (ms *MemorySession) findVolumeByName(name string) *provider.Volume {
+	for _, volume := range ms.volumes {
+		if volume.Name != nil && *volume.Name == name {
+			return volume
+		}
+	}
+	return nil
+}
+
+// CreateVolume ...
+func (ms *MemorySession) CreateVolume(volumeRequest provider.Volume) (*provider.Volume, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpCreateVolume); err != nil {
+		return nil, err
+	}
+	if volumeRequest.Name == nil || *volumeRequest.Name == "" {
+		return nil, newMessage("InvalidVolumeName", util.InvalidRequest, http.StatusBadRequest, "Volume name is required.")
+	}
+	if ms.findVolumeByName(*volumeRequest.Name) != nil {
+		return nil, newMessage("VolumeAlreadyExists", util.ProvisioningFailed, http.StatusConflict, "A volume with the name '%s' already exists.", *volumeRequest.Name)
+	}
+	// Volumes restored from a snapshot default to the capacity of the source volume
+	var source *provider.Snapshot
+	if snapshotID := volumeRequest.Snapshot.SnapshotID; snapshotID != "" {
+		var ok bool
+		if source, ok = ms.snapshots[snapshotID]; !ok {
+			return nil, snapshotNotFound(snapshotID)
+		}
+		if sourceVolume := ms.volumes[source.VolumeID]; volumeRequest.Capacity == nil && sourceVolume != nil {
+			volumeRequest.Capacity = sourceVolume.Capacity
+		}
+	}
+	if volumeRequest.Capacity == nil {
+		return nil, newMessage("VolumeCapacityInvalid", util.InvalidRequest, http.StatusBadRequest, "Volume capacity is required.")
+	}
+	if err := ms.checkCapacity(*volumeRequest.Capacity, *volumeRequest.Capacity); err != nil {
+		return nil, err
+	}
+
+	volume := copyVolume(&volumeRequest)
+	volume.VolumeID = ms.newID("r000-vol")
+	volume.CRN = fmt.Sprintf("crn:v1:bluemix:public:is:%s:a/memory::volume:%s", volume.Az, volume.VolumeID)
+	volume.Provider = ms.providerName
+	volume.VolumeType = ms.volumeType
+	volume.CreationTime = time.Now()
+	volume.Snapshot = provider.Snapshot{}
+	if source != nil {
+		volume.Snapshot = *copySnapshot(source)
+	}
+	ms.volumes[volume.VolumeID] = volume
+	return ms.volumeView(volume), nil
+}
+
+// CreateVolumeFromSnapshot ...
+func (ms *MemorySession) CreateVolumeFromSnapshot(snapshot provider.Snapshot, tags map[string]string) (*provider.Volume, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpCreateVolumeFromSnapshot); err != nil {
+		return nil, err
+	}
+	source, ok := ms.snapshots[snapshot.SnapshotID]
+	if !ok {
+		return nil, snapshotNotFound(snapshot.SnapshotID)
+	}
+	sourceVolume := ms.volumes[source.VolumeID]
+	capacity := MinVolumeCapacity
+	if sourceVolume != nil {
+		capacity = *sourceVolume.Capacity
+	}
+	if err := ms.checkCapacity(capacity, capacity); err != nil {
+		return nil, err
+	}
+
+	name := ms.newID("restored")
+	volume := &provider.Volume{Name: &name, Capacity: &capacity, VolumeNotes: copyStringMap(tags)}
+	volume.VolumeID = ms.newID("r000-vol")
+	volume.Provider = ms.providerName
+	volume.VolumeType = ms.volumeType
+	volume.CreationTime = time.Now()
+	volume.Snapshot = *copySnapshot(source)
+	if sourceVolume != nil {
+		volume.Az, volume.Region = sourceVolume.Az, sourceVolume.Region
+	}
+	ms.volumes[volume.VolumeID] = volume
+	return ms.volumeView(volume), nil
+}
+
+// UpdateVolume replaces the tags, capacity and IOPS of the volume as the PV watcher does
+func (ms *MemorySession) UpdateVolume(volumeRequest provider.Volume) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpUpdateVolume); err != nil {
+		return err
+	}
+	volume, ok := ms.volumes[volumeRequest.VolumeID]
+	if !ok {
+		return volumeNotFound(volumeRequest.VolumeID)
+	}
+	if volumeRequest.CRN != "" && volumeRequest.CRN != volume.CRN {
+		return newMessage("UpdateFailed", util.UpdateFailed, http.StatusBadRequest, "Volume CRN '%s' does not match volume '%s'.", volumeRequest.CRN, volume.VolumeID)
+	}
+	if volumeRequest.Tags != nil {
+		volume.Tags = append([]string{}, volumeRequest.Tags...)
+	}
+	if volumeRequest.Iops != nil {
+		iops := *volumeRequest.Iops
+		volume.Iops = &iops
+	}
+	if len(volumeRequest.Attributes) > 0 {
+		if volume.Attributes == nil {
+			volume.Attributes = map[string]string{}
+		}
+		for key, value := range volumeRequest.Attributes {
+			volume.Attributes[key] = value
+		}
+	}
+	return nil
+}
+
+// DeleteVolume fails if the volume is attached or has snapshots
+func (ms *MemorySession) DeleteVolume(volumeRequest *provider.Volume) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpDeleteVolume); err != nil {
+		return err
+	}
+	if volumeRequest == nil {
+		return newMessage("InvalidVolumeID", util.InvalidRequest, http.StatusBadRequest, "Volume ID is required.")
+	}
+	if _, ok := ms.volumes[volumeRequest.VolumeID]; !ok {
+		return volumeNotFound(volumeRequest.VolumeID)
+	}
+	if _, ok := ms.attachments[volumeRequest.VolumeID]; ok {
+		return newMessage("VolumeDeletionFailed", util.DeletionFailed, http.StatusConflict, "Volume '%s' is attached to an instance.", volumeRequest.VolumeID)
+	}
+	for _, snapshot := range ms.snapshots {
+		if snapshot.VolumeID == volumeRequest.VolumeID {
+			return newMessage("VolumeDeletionFailed", util.DeletionFailed, http.StatusConflict, "Volume '%s' has snapshots.", volumeRequest.VolumeID)
+		}
+	}
+	for _, accessPoint := range ms.accessPoints {
+		if accessPoint.volumeID == volumeRequest.VolumeID {
+			return newMessage("VolumeDeletionFailed", util.DeletionFailed, http.StatusConflict, "Volume '%s' has access points.", volumeRequest.VolumeID)
+		}
+	}
+	delete(ms.volumes, volumeRequest.VolumeID)
+	return nil
+}
+
+// GetVolume ...
+func (ms *MemorySession) GetVolume(id string) (*provider.Volume, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpGetVolume); err != nil {
+		return nil, err
+	}
+	volume, ok := ms.volumes[id]
+	if !ok {
+		return nil, volumeNotFound(id)
+	}
+	return ms.volumeView(volume), nil
+}
+
+// GetVolumeByName ...
+func (ms *MemorySession) GetVolumeByName(name string) (*provider.Volume, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpGetVolumeByName); err != nil {
+		return nil, err
+	}
+	volume := ms.findVolumeByName(name)
+	if volume == nil {
+		return nil, newMessage("StorageFindFailedWithVolumeName", util.EntityNotFound, http.StatusNotFound, "A volume with the specified volume name '%s' does not exist.", name)
+	}
+	return ms.volumeView(volume), nil
+}
+
+// ListVolumes supports name, zone.name and resource_group.id filters, pages are ordered by volume ID
+func (ms *MemorySession) ListVolumes(limit int, start string, tags map[string]string) (*provider.VolumeList, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpListVolumes); err != nil {
+		return nil, err
+	}
+	if limit < 0 || limit > maxListLimit {
+		return nil, newMessage("InvalidListVolumesLimit", util.InvalidRequest, http.StatusBadRequest, "The value '%d' specified in the limit parameter of the list volume call is not valid.", limit)
+	}
+	ids := []string{}
+	for id, volume := range ms.volumes {
+		if volumeMatches(volume, tags) {
+			ids = append(ids, id)
+		}
+	}
+	page, next, err := paginate(ids, limit, start)
+	if err != nil {
+		return nil, err
+	}
+	volumeList := &provider.VolumeList{Next: next, Volumes: []*provider.Volume{}}
+	for _, id := range page {
+		volumeList.Volumes = append(volumeList.Volumes, ms.volumeView(ms.volumes[id]))
+	}
+	return volumeList, nil
+}
+
+// volumeMatches ...
+func volumeMatches(volume *provider.Volume, filters map[string]string) bool {
+	for key, value := range filters {
+		switch key {
+		case "name":
+			if volume.Name == nil || *volume.Name != value {
+				return false
+			}
+		case "zone.name":
+			if volume.Az != value {
+				return false
+			}
+		case "resource_group.id":
+			if volume.ResourceGroup == nil || volume.ResourceGroup.ID != value {
+				return false
+			}
+		default:
+			if volume.Attributes[key] != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// paginate returns the page of sorted IDs after start and the start of the next page
+func paginate(ids []string, limit int, start string) ([]string, string, error) {
+	sort.Strings(ids)
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	first := 0
+	if start != "" {
+		first = sort.SearchStrings(ids, start)
+		if first == len(ids) || ids[first] != start {
+			return nil, "", newMessage("StartVolumeIDNotFound", util.InvalidRequest, http.StatusBadRequest, "The start ID '%s' specified in the list call is not valid.", start)
+		}
+	}
+	last := first + limit
+	if last >= len(ids) {
+		return ids[first:], "", nil
+	}
+	return ids[first:last], ids[last], nil
+}
+
+// GetVolumeByRequestID is not supported by the VPC backend
+func (ms *MemorySession) GetVolumeByRequestID(requestID string) (*provider.Volume, error) {
+	return nil, newMessage("MethodNotSupported", util.InvalidRequest, http.StatusBadRequest, "GetVolumeByRequestID is not supported.")
+}
+
+// AuthorizeVolume is a no-op for the VPC backend
+func (ms *MemorySession) AuthorizeVolume(volumeAuthorization provider.VolumeAuthorization) error {
+	return nil
+}
+
+// ExpandVolume only grows the volume
+func (ms *MemorySession) ExpandVolume(expandVolumeRequest provider.ExpandVolumeRequest) (int64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpExpandVolume); err != nil {
+		return -1, err
+	}
+	volume, ok := ms.volumes[expandVolumeRequest.VolumeID]
+	if !ok {
+		return -1, volumeNotFound(expandVolumeRequest.VolumeID)
+	}
+	capacity := int(expandVolumeRequest.Capacity)
+	if capacity < *volume.Capacity {
+		return -1, newMessage("VolumeExpansionFailed", util.ExpansionFailed, http.StatusBadRequest, "Volume '%s' can not shrink from %d GiB to %d GiB.", volume.VolumeID, *volume.Capacity, capacity)
+	}
+	if err := ms.checkCapacity(capacity, capacity-*volume.Capacity); err != nil {
+		return -1, err
+	}
+	volume.Capacity = &capacity
+	return int64(capacity), nil
+}
+
+// AttachVolume attaches a volume to a single instance, attaching again to the same instance returns the existing attachment
+func (ms *MemorySession) AttachVolume(attachRequest provider.VolumeAttachmentRequest) (*provider.VolumeAttachmentResponse, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpAttachVolume); err != nil {
+		return nil, err
+	}
+	if attachRequest.VolumeID == "" || attachRequest.InstanceID == "" {
+		return nil, newMessage("InvalidVolumeAttachRequest", util.InvalidRequest, http.StatusBadRequest, "Volume ID and instance ID are required.")
+	}
+	if _, ok := ms.volumes[attachRequest.VolumeID]; !ok {
+		return nil, volumeNotFound(attachRequest.VolumeID)
+	}
+	if attachment, ok := ms.attachments[attachRequest.VolumeID]; ok {
+		if attachment.instanceID != attachRequest.InstanceID {
+			return nil, newMessage("VolumeAttachFailed", util.AttachFailed, http.StatusConflict, "Volume '%s' is already attached to instance '%s'.", attachRequest.VolumeID, attachment.instanceID)
+		}
+		return attachmentResponse(attachRequest.VolumeID, attachment), nil
+	}
+	attachment := &memoryAttachment{id: ms.newID("r000-attach"), instanceID: attachRequest.InstanceID, status: StatusAttaching, createdAt: time.Now()}
+	ms.attachments[attachRequest.VolumeID] = attachment
+	return attachmentResponse(attachRequest.VolumeID, attachment), nil
+}
+
+// findAttachment returns the attachment of the volume to the instance, the caller must hold the mutex
+func (ms *MemorySession) findAttachment(request provider.VolumeAttachmentRequest) (*memoryAttachment, error) {
+	attachment, ok := ms.attachments[request.VolumeID]
+	if !ok || attachment.instanceID != request.InstanceID {
+		return nil, newMessage("VolumeAttachFindFailed", util.EntityNotFound, http.StatusNotFound, "No volume attachment could be found for volume '%s' and instance '%s'.", request.VolumeID, request.InstanceID)
+	}
+	return attachment, nil
+}
+
+// DetachVolume ...
+func (ms *MemorySession) DetachVolume(detachRequest provider.VolumeAttachmentRequest) (*http.Response, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpDetachVolume); err != nil {
+		return nil, err
+	}
+	attachment, err := ms.findAttachment(detachRequest)
+	if err != nil {
+		return nil, err
+	}
+	attachment.status = StatusDetaching
+	return &http.Response{StatusCode: http.StatusAccepted}, nil
+}
+
+// WaitForAttachVolume completes the attachment
+func (ms *MemorySession) WaitForAttachVolume(attachRequest provider.VolumeAttachmentRequest) (*provider.VolumeAttachmentResponse, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpWaitForAttachVolume); err != nil {
+		return nil, err
+	}
+	attachment, err := ms.findAttachment(attachRequest)
+	if err != nil {
+		return nil, err
+	}
+	if attachment.status == StatusDetaching {
+		return nil, newMessage("VolumeAttachTimedOut", util.AttachFailed, http.StatusConflict, "Volume '%s' is being detached from instance '%s'.", attachRequest.VolumeID, attachRequest.InstanceID)
+	}
+	attachment.status = StatusAttached
+	return attachmentResponse(attachRequest.VolumeID, attachment), nil
+}
+
+// WaitForDetachVolume completes the detachment, it is a no-op if the volume is not attached
+func (ms *MemorySession) WaitForDetachVolume(detachRequest provider.VolumeAttachmentRequest) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpWaitForDetachVolume); err != nil {
+		return err
+	}
+	attachment, err := ms.findAttachment(detachRequest)
+	if err != nil {
+		return nil
+	}
+	if attachment.status != StatusDetaching {
+		return newMessage("VolumeDetachTimedOut", util.DetachFailed, http.StatusConflict, "Volume '%s' is still attached to instance '%s'.", detachRequest.VolumeID, detachRequest.InstanceID)
+	}
+	delete(ms.attachments, detachRequest.VolumeID)
+	return nil
+}
+
+// GetVolumeAttachment ...
+func (ms *MemorySession) GetVolumeAttachment(attachRequest provider.VolumeAttachmentRequest) (*provider.VolumeAttachmentResponse, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpGetVolumeAttachment); err != nil {
+		return nil, err
+	}
+	attachment, err := ms.findAttachment(attachRequest)
+	if err != nil {
+		return nil, err
+	}
+	return attachmentResponse(attachRequest.VolumeID, attachment), nil
+}
+
+// attachmentResponse ...
+func attachmentResponse(volumeID string, attachment *memoryAttachment) *provider.VolumeAttachmentResponse {
+	createdAt := attachment.createdAt
+	return &provider.VolumeAttachmentResponse{
+		VolumeAttachmentRequest: provider.VolumeAttachmentRequest{
+			VolumeID:            volumeID,
+			InstanceID:          attachment.instanceID,
+			VPCVolumeAttachment: &provider.VolumeAttachment{ID: attachment.id, Type: "data", DevicePath: "/dev/disk/by-id/virtio-" + attachment.id},
+		},
+		Status:    attachment.status,
+		CreatedAt: &createdAt,
+	}
+}
+
+// CreateSnapshot requires the source volume to be attached, as the VPC backend does
+func (ms *MemorySession) CreateSnapshot(sourceVolumeID string, snapshotParameters provider.SnapshotParameters) (*provider.Snapshot, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpCreateSnapshot); err != nil {
+		return nil, err
+	}
+	volume, ok := ms.volumes[sourceVolumeID]
+	if !ok {
+		return nil, volumeNotFound(sourceVolumeID)
+	}
+	if attachment, ok := ms.attachments[sourceVolumeID]; !ok || attachment.status != StatusAttached {
+		return nil, newMessage("SnapshotSpaceOrderFailed", util.ProvisioningFailed, http.StatusBadRequest, "Volume '%s' must be attached to a running instance to create a snapshot.", sourceVolumeID)
+	}
+	if snapshotParameters.Name != "" {
+		for _, snapshot := range ms.snapshots {
+			if snapshot.VPC.Name == snapshotParameters.Name {
+				return nil, newMessage("SnapshotAlreadyExists", util.ProvisioningFailed, http.StatusConflict, "A snapshot with the name '%s' already exists.", snapshotParameters.Name)
+			}
+		}
+	}
+
+	snapshot := &provider.Snapshot{
+		VolumeID:             sourceVolumeID,
+		SnapshotID:           ms.newID("r000-snap"),
+		SnapshotSize:         int64(*volume.Capacity) * 1024 * 1024 * 1024,
+		SnapshotCreationTime: time.Now(),
+		SnapshotTags:         copyStringMap(snapshotParameters.SnapshotTags),
+		ReadyToUse:           true,
+	}
+	snapshot.SnapshotCRN = fmt.Sprintf("crn:v1:bluemix:public:is:%s:a/memory::snapshot:%s", volume.Region, snapshot.SnapshotID)
+	snapshot.VPC.ID = snapshot.SnapshotID
+	snapshot.VPC.Name = snapshotParameters.Name
+	ms.snapshots[snapshot.SnapshotID] = snapshot
+	return copySnapshot(snapshot), nil
+}
+
+// DeleteSnapshot ...
+func (ms *MemorySession) DeleteSnapshot(snapshotRequest *provider.Snapshot) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpDeleteSnapshot); err != nil {
+		return err
+	}
+	if snapshotRequest == nil {
+		return newMessage("InvalidSnapshotID", util.InvalidRequest, http.StatusBadRequest, "Snapshot ID is required.")
+	}
+	if _, ok := ms.snapshots[snapshotRequest.SnapshotID]; !ok {
+		return snapshotNotFound(snapshotRequest.SnapshotID)
+	}
+	delete(ms.snapshots, snapshotRequest.SnapshotID)
+	return nil
+}
+
+// GetSnapshot ...
+func (ms *MemorySession) GetSnapshot(snapshotID string) (*provider.Snapshot, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpGetSnapshot); err != nil {
+		return nil, err
+	}
+	snapshot, ok := ms.snapshots[snapshotID]
+	if !ok {
+		return nil, snapshotNotFound(snapshotID)
+	}
+	return copySnapshot(snapshot), nil
+}
+
+// GetSnapshotByName ...
+func (ms *MemorySession) GetSnapshotByName(snapshotName string) (*provider.Snapshot, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpGetSnapshotByName); err != nil {
+		return nil, err
+	}
+	for _, snapshot := range ms.snapshots {
+		if snapshot.VPC.Name == snapshotName {
+			return copySnapshot(snapshot), nil
+		}
+	}
+	return nil, newMessage("StorageFindFailedWithSnapshotName", util.EntityNotFound, http.StatusNotFound, "No volume snapshot could be found with the specified snapshot name '%s'.", snapshotName)
+}
+
+// ListSnapshots supports name and source_volume.id filters, pages are ordered by snapshot ID
+func (ms *MemorySession) ListSnapshots(limit int, start string, tags map[string]string) (*provider.SnapshotList, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpListSnapshots); err != nil {
+		return nil, err
+	}
+	if limit < 0 || limit > maxListLimit {
+		return nil, newMessage("InvalidListSnapshotLimit", util.InvalidRequest, http.StatusBadRequest, "The value '%d' specified in the limit parameter of the list snapshot call is not valid.", limit)
+	}
+	ids := []string{}
+	for id, snapshot := range ms.snapshots {
+		if (tags["name"] == "" || snapshot.VPC.Name == tags["name"]) &&
+			(tags["source_volume.id"] == "" || snapshot.VolumeID == tags["source_volume.id"]) {
+			ids = append(ids, id)
+		}
+	}
+	page, next, err := paginate(ids, limit, start)
+	if err != nil {
+		return nil, err
+	}
+	snapshotList := &provider.SnapshotList{Next: next, Snapshots: []*provider.Snapshot{}}
+	for _, id := range page {
+		snapshotList.Snapshots = append(snapshotList.Snapshots, copySnapshot(ms.snapshots[id]))
+	}
+	return snapshotList, nil
+}
+
+// CreateVolumeAccessPoint ...
+func (ms *MemorySession) CreateVolumeAccessPoint(accessPointRequest provider.VolumeAccessPointRequest) (*provider.VolumeAccessPointResponse, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpCreateVolumeAccessPoint); err != nil {
+		return nil, err
+	}
+	if _, ok := ms.volumes[accessPointRequest.VolumeID]; !ok {
+		return nil, volumeNotFound(accessPointRequest.VolumeID)
+	}
+	for _, accessPoint := range ms.accessPoints {
+		if accessPoint.volumeID == accessPointRequest.VolumeID {
+			return accessPointResponse(accessPoint), nil
+		}
+	}
+	accessPoint := &memoryAccessPoint{id: ms.newID("r000-ap"), volumeID: accessPointRequest.VolumeID, status: StatusPending, createdAt: time.Now()}
+	ms.accessPoints[accessPoint.id] = accessPoint
+	return accessPointResponse(accessPoint), nil
+}
+
+// findAccessPoint ...
+func (ms *MemorySession) findAccessPoint(request provider.VolumeAccessPointRequest) (*memoryAccessPoint, error) {
+	accessPoint, ok := ms.accessPoints[request.AccessPointID]
+	if !ok || accessPoint.volumeID != request.VolumeID {
+		return nil, newMessage("VolumeAccessPointFindFailed", util.VolumeAccessPointFindFailed, http.StatusNotFound, "No volume access point could be found for volume '%s' and access point '%s'.", request.VolumeID, request.AccessPointID)
+	}
+	return accessPoint, nil
+}
+
+// DeleteVolumeAccessPoint ...
+func (ms *MemorySession) DeleteVolumeAccessPoint(deleteAccessPointRequest provider.VolumeAccessPointRequest) (*http.Response, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpDeleteVolumeAccessPoint); err != nil {
+		return nil, err
+	}
+	accessPoint, err := ms.findAccessPoint(deleteAccessPointRequest)
+	if err != nil {
+		return nil, err
+	}
+	accessPoint.status = StatusDeleting
+	return &http.Response{StatusCode: http.StatusAccepted}, nil
+}
+
+// WaitForCreateVolumeAccessPoint ...
+func (ms *MemorySession) WaitForCreateVolumeAccessPoint(accessPointRequest provider.VolumeAccessPointRequest) (*provider.VolumeAccessPointResponse, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpWaitForCreateAccessPoint); err != nil {
+		return nil, err
+	}
+	accessPoint, err := ms.findAccessPoint(accessPointRequest)
+	if err != nil {
+		return nil, err
+	}
+	if accessPoint.status == StatusPending {
+		accessPoint.status = StatusStable
+	}
+	return accessPointResponse(accessPoint), nil
+}
+
+// WaitForDeleteVolumeAccessPoint ...
+func (ms *MemorySession) WaitForDeleteVolumeAccessPoint(deleteAccessPointRequest provider.VolumeAccessPointRequest) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpWaitForDeleteAccessPoint); err != nil {
+		return err
+	}
+	accessPoint, err := ms.findAccessPoint(deleteAccessPointRequest)
+	if err != nil {
+		return nil
+	}
+	if accessPoint.status != StatusDeleting {
+		return newMessage("DeleteVolumeAccessPointTimedOut", util.DeleteVolumeAccessPointFailed, http.StatusConflict, "Access point '%s' is not being deleted.", accessPoint.id)
+	}
+	delete(ms.accessPoints, accessPoint.id)
+	return nil
+}
+
+// GetVolumeAccessPoint ...
+func (ms *MemorySession) GetVolumeAccessPoint(accessPointRequest provider.VolumeAccessPointRequest) (*provider.VolumeAccessPointResponse, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpGetVolumeAccessPoint); err != nil {
+		return nil, err
+	}
+	if accessPointRequest.AccessPointID == "" {
+		for _, accessPoint := range ms.accessPoints {
+			if accessPoint.volumeID == accessPointRequest.VolumeID {
+				return accessPointResponse(accessPoint), nil
+			}
+		}
+	}
+	accessPoint, err := ms.findAccessPoint(accessPointRequest)
+	if err != nil {
+		return nil, err
+	}
+	return accessPointResponse(accessPoint), nil
+}
+
+// GetSubnetForVolumeAccessPoint returns SubnetID if it is part of the requested subnet list
+func (ms *MemorySession) GetSubnetForVolumeAccessPoint(subnetRequest provider.SubnetRequest) (string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpGetSubnetForAccessPoint); err != nil {
+		return "", err
+	}
+	if ms.SubnetID == "" || !strings.Contains(subnetRequest.SubnetIDList, ms.SubnetID) {
+		return "", newMessage("SubnetFindFailed", util.EntityNotFound, http.StatusNotFound, "No subnet found in zone '%s' matching '%s'.", subnetRequest.ZoneName, subnetRequest.SubnetIDList)
+	}
+	return ms.SubnetID, nil
+}
+
+// GetSecurityGroupForVolumeAccessPoint ...
+func (ms *MemorySession) GetSecurityGroupForVolumeAccessPoint(securityGroupRequest provider.SecurityGroupRequest) (string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.injected(OpGetSecurityGroupAccessPoint); err != nil {
+		return "", err
+	}
+	if ms.SecurityGroupID == "" {
+		return "", newMessage("SecurityGroupFindFailed", util.EntityNotFound, http.StatusNotFound, "No security group found with name '%s'.", securityGroupRequest.Name)
+	}
+	return ms.SecurityGroupID, nil
+}
+
+// accessPointResponse ...
+func accessPointResponse(accessPoint *memoryAccessPoint) *provider.VolumeAccessPointResponse {
+	createdAt := accessPoint.createdAt
+	return &provider.VolumeAccessPointResponse{
+		VolumeID:      accessPoint.volumeID,
+		AccessPointID: accessPoint.id,
+		Status:        accessPoint.status,
+		MountPath:     "10.240.0.4:/" + accessPoint.id,
+		CreatedAt:     &createdAt,
+	}
+}
+
+// volumeView returns a copy of the volume including its attachments, the caller must hold the mutex
+func (ms *MemorySession) volumeView(volume *provider.Volume) *provider.Volume {
+	view := copyVolume(volume)
+	if attachment, ok := ms.attachments[volume.VolumeID]; ok {
+		view.VolumeAttachments = &[]provider.VolumeAttachment{*attachmentResponse(volume.VolumeID, attachment).VPCVolumeAttachment}
+	}
+	return view
+}
+
+// copyVolume copies the volume so that callers can not change the session state
+func copyVolume(volume *provider.Volume) *provider.Volume {
+	copied := *volume
+	if volume.Capacity != nil {
+		capacity := *volume.Capacity
+		copied.Capacity = &capacity
+	}
+	if volume.Name != nil {
+		name := *volume.Name
+		copied.Name = &name
+	}
+	if volume.Iops != nil {
+		iops := *volume.Iops
+		copied.Iops = &iops
+	}
+	if volume.Tags != nil {
+		copied.Tags = append([]string{}, volume.Tags...)
+	}
+	copied.Attributes = copyStringMap(volume.Attributes)
+	copied.VolumeNotes = copyStringMap(volume.VolumeNotes)
+	copied.VolumeAttachments = nil
+	return &copied
+}
+
+// copySnapshot ...
+func copySnapshot(snapshot *provider.Snapshot) *provider.Snapshot {
+	copied := *snapshot
+	copied.SnapshotTags = copyStringMap(snapshot.SnapshotTags)
+	return &copied
+}
+
+// copyStringMap ...
+func copyStringMap(in map[string]string) map[string]string {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]string, len(in))
+	for key, value := range in {
+		out[key] = value
+	}
+	return out
+}
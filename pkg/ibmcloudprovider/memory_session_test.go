@@ -0,0 +1,241 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	util "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// newTestVolume ...
+func newTestVolume(name string, capacity int) provider.Volume {
+	return provider.Volume{Name: &name, Capacity: &capacity, Az: "us-south-1", Region: "us-south"}
+}
+
+// assertErrorType checks the util.Message type of the error
+func assertErrorType(t *testing.T, expectedType string, err error) {
+	assert.NotNil(t, err)
+	assert.Equal(t, expectedType, util.GetErrorType(err), "error: %v", err)
+}
+
+func TestMemorySessionVolumeLifecycle(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	session := NewMemorySession("vpc", "vpc-block")
+	cloudProvider := NewFakeIBMCloudStorageProviderWithSession(session)
+	providerSession, err := cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+
+	// Create
+	volume, err := providerSession.CreateVolume(newTestVolume("pvc-1", 10))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, volume.VolumeID)
+	assert.NotEmpty(t, volume.CRN)
+	_, err = providerSession.CreateVolume(newTestVolume("pvc-1", 10))
+	assertErrorType(t, util.ProvisioningFailed, err)
+
+	// Tag, as the PV watcher does
+	err = providerSession.UpdateVolume(provider.Volume{VolumeID: volume.VolumeID, VPCVolume: provider.VPCVolume{VPCBlockVolume: provider.VPCBlockVolume{Tags: []string{"clusterid:mycluster"}}}})
+	assert.Nil(t, err)
+	err = providerSession.UpdateVolume(provider.Volume{VolumeID: "unknown"})
+	assertErrorType(t, util.EntityNotFound, err)
+	tagged, err := providerSession.GetVolumeByName("pvc-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"clusterid:mycluster"}, tagged.Tags)
+
+	// Returned volumes are copies
+	*tagged.Capacity = 1000
+	current, _ := providerSession.GetVolume(volume.VolumeID)
+	assert.Equal(t, 10, *current.Capacity)
+
+	// Expand
+	capacity, err := providerSession.ExpandVolume(provider.ExpandVolumeRequest{VolumeID: volume.VolumeID, Capacity: 20})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), capacity)
+	_, err = providerSession.ExpandVolume(provider.ExpandVolumeRequest{VolumeID: volume.VolumeID, Capacity: 15})
+	assertErrorType(t, util.ExpansionFailed, err)
+
+	// Attach
+	attachRequest := provider.VolumeAttachmentRequest{VolumeID: volume.VolumeID, InstanceID: "instance-1"}
+	attachment, err := providerSession.AttachVolume(attachRequest)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusAttaching, attachment.Status)
+	attachment, err = providerSession.WaitForAttachVolume(attachRequest)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusAttached, attachment.Status)
+	_, err = providerSession.AttachVolume(provider.VolumeAttachmentRequest{VolumeID: volume.VolumeID, InstanceID: "instance-2"})
+	assertErrorType(t, util.AttachFailed, err)
+	attached, _ := providerSession.GetVolume(volume.VolumeID)
+	assert.Equal(t, 1, len(*attached.VolumeAttachments))
+
+	// Snapshot and restore
+	snapshot, err := providerSession.CreateSnapshot(volume.VolumeID, provider.SnapshotParameters{Name: "snap-1"})
+	assert.Nil(t, err)
+	assert.True(t, snapshot.ReadyToUse)
+	restored, err := providerSession.CreateVolumeFromSnapshot(*snapshot, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, *restored.Capacity)
+	assert.Equal(t, snapshot.SnapshotID, restored.SnapshotID)
+	restoredName := "pvc-restored"
+	restoredFromRequest, err := providerSession.CreateVolume(provider.Volume{Name: &restoredName, Snapshot: provider.Snapshot{SnapshotID: snapshot.SnapshotID}})
+	assert.Nil(t, err)
+	assert.Equal(t, 20, *restoredFromRequest.Capacity)
+	assert.Equal(t, snapshot.SnapshotID, restoredFromRequest.SnapshotID)
+	missingName := "pvc-missing-snapshot"
+	_, err = providerSession.CreateVolume(provider.Volume{Name: &missingName, Snapshot: provider.Snapshot{SnapshotID: "r000-missing"}})
+	assertErrorType(t, util.EntityNotFound, err)
+
+	// Delete is refused while attached or with snapshots
+	err = providerSession.DeleteVolume(volume)
+	assertErrorType(t, util.DeletionFailed, err)
+	_, err = providerSession.DetachVolume(attachRequest)
+	assert.Nil(t, err)
+	assert.Nil(t, providerSession.WaitForDetachVolume(attachRequest))
+	_, err = providerSession.GetVolumeAttachment(attachRequest)
+	assertErrorType(t, util.EntityNotFound, err)
+	err = providerSession.DeleteVolume(volume)
+	assertErrorType(t, util.DeletionFailed, err)
+	assert.Nil(t, providerSession.DeleteSnapshot(snapshot))
+	assert.Nil(t, providerSession.DeleteVolume(volume))
+	_, err = providerSession.GetVolume(volume.VolumeID)
+	assertErrorType(t, util.EntityNotFound, err)
+}
+
+func TestMemorySessionValidation(t *testing.T) {
+	session := NewMemorySession("vpc", "vpc-block")
+	session.CapacityQuota = 100
+
+	testCases := []struct {
+		testCaseName string
+		volume       provider.Volume
+		expectedType string
+	}{
+		{testCaseName: "Name missing", volume: provider.Volume{}, expectedType: util.InvalidRequest},
+		{testCaseName: "Capacity too small", volume: newTestVolume("small", 1), expectedType: util.InvalidRequest},
+		{testCaseName: "Capacity too large", volume: newTestVolume("large", MaxVolumeCapacity+1), expectedType: util.InvalidRequest},
+		{testCaseName: "Quota exceeded", volume: newTestVolume("quota", 200), expectedType: util.ProvisioningFailed},
+	}
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			_, err := session.CreateVolume(testcase.volume)
+			assertErrorType(t, testcase.expectedType, err)
+		})
+	}
+
+	// Snapshot of a detached volume
+	volume, err := session.CreateVolume(newTestVolume("detached", 10))
+	assert.Nil(t, err)
+	_, err = session.CreateSnapshot(volume.VolumeID, provider.SnapshotParameters{})
+	assertErrorType(t, util.ProvisioningFailed, err)
+
+	_, err = session.GetVolumeByRequestID("request")
+	assert.NotNil(t, err)
+}
+
+func TestMemorySessionList(t *testing.T) {
+	session := NewMemorySession("vpc", "vpc-block")
+	for i := 0; i < 5; i++ {
+		_, err := session.CreateVolume(newTestVolume(fmt.Sprintf("pvc-%d", i), 10))
+		assert.Nil(t, err)
+	}
+
+	first, err := session.ListVolumes(2, "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(first.Volumes))
+	assert.NotEmpty(t, first.Next)
+	second, err := session.ListVolumes(2, first.Next, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(second.Volumes))
+	last, err := session.ListVolumes(2, second.Next, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(last.Volumes))
+	assert.Empty(t, last.Next)
+
+	filtered, err := session.ListVolumes(0, "", map[string]string{"name": "pvc-3"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(filtered.Volumes))
+	assert.Equal(t, "pvc-3", *filtered.Volumes[0].Name)
+
+	_, err = session.ListVolumes(maxListLimit+1, "", nil)
+	assertErrorType(t, util.InvalidRequest, err)
+	_, err = session.ListVolumes(2, "unknown", nil)
+	assertErrorType(t, util.InvalidRequest, err)
+}
+
+func TestMemorySessionAccessPoint(t *testing.T) {
+	session := NewMemorySession("vpc-share", "vpc-file")
+	volume, err := session.CreateVolume(newTestVolume("share", 10))
+	assert.Nil(t, err)
+
+	request := provider.VolumeAccessPointRequest{VolumeID: volume.VolumeID}
+	accessPoint, err := session.CreateVolumeAccessPoint(request)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusPending, accessPoint.Status)
+	request.AccessPointID = accessPoint.AccessPointID
+	accessPoint, err = session.WaitForCreateVolumeAccessPoint(request)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusStable, accessPoint.Status)
+
+	assertErrorType(t, util.DeletionFailed, session.DeleteVolume(volume))
+	_, err = session.DeleteVolumeAccessPoint(request)
+	assert.Nil(t, err)
+	assert.Nil(t, session.WaitForDeleteVolumeAccessPoint(request))
+	_, err = session.GetVolumeAccessPoint(request)
+	assertErrorType(t, util.VolumeAccessPointFindFailed, err)
+	assert.Nil(t, session.DeleteVolume(volume))
+
+	_, err = session.GetSubnetForVolumeAccessPoint(provider.SubnetRequest{SubnetIDList: "subnet-1"})
+	assertErrorType(t, util.EntityNotFound, err)
+	session.SubnetID = "subnet-1"
+	subnetID, err := session.GetSubnetForVolumeAccessPoint(provider.SubnetRequest{SubnetIDList: "subnet-0,subnet-1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "subnet-1", subnetID)
+}
+
+func TestMemorySessionInjectError(t *testing.T) {
+	session := NewMemorySession("vpc", "vpc-block")
+	injected := errors.New("backend unavailable")
+
+	// Twice
+	session.InjectError(OpCreateVolume, injected, 2)
+	_, err := session.CreateVolume(newTestVolume("pvc", 10))
+	assert.Equal(t, injected, err)
+	_, err = session.CreateVolume(newTestVolume("pvc", 10))
+	assert.Equal(t, injected, err)
+	volume, err := session.CreateVolume(newTestVolume("pvc", 10))
+	assert.Nil(t, err)
+
+	// Until cleared, other operations are not affected
+	session.InjectError(OpGetVolume, injected, 0)
+	for i := 0; i < 3; i++ {
+		_, err = session.GetVolume(volume.VolumeID)
+		assert.Equal(t, injected, err)
+	}
+	_, err = session.GetVolumeByName("pvc")
+	assert.Nil(t, err)
+	session.ClearError(OpGetVolume)
+	_, err = session.GetVolume(volume.VolumeID)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,243 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/metrics"
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/utils/reasoncode"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultSessionTTL IAM tokens are valid for an hour, the session is refreshed before that
+	DefaultSessionTTL = 50 * time.Minute
+
+	// sessionRefreshMargin is how long before the token expiry the session is refreshed
+	sessionRefreshMargin = 5 * time.Minute
+)
+
+// sessionRefresh is a session being opened by GetProviderSession, done is closed once session and err are set
+type sessionRefresh struct {
+	done    chan struct{}
+	session provider.Session
+	err     error
+}
+
+// GetProviderSession returns the cached session shared by all the callers. A new session is opened
+// if there is none yet, or if the token of the cached one is about to expire. Only one session is
+// opened at a time, concurrent callers wait for it until their ctx is done.
+// The session is closed once it is replaced, callers must not Close it and should get the session
+// again for every operation instead of keeping it.
+func (icp *IBMCloudStorageProvider) GetProviderSession(ctx context.Context, logger *zap.Logger) (provider.Session, error) {
+	for {
+		icp.sessionMutex.Lock()
+		if icp.session != nil && time.Now().Before(icp.refreshAt) {
+			session := icp.session
+			icp.sessionMutex.Unlock()
+			metrics.RegisterSessionCacheLookup(metrics.SessionCacheHit)
+			return session, nil
+		}
+		refresh := icp.refresh
+		if refresh == nil {
+			break
+		}
+		icp.sessionMutex.Unlock()
+
+		select {
+		case <-refresh.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// The session is opened with the context of the first caller, others open their own if it was cancelled
+		if refresh.err == nil || !isContextError(refresh.err) {
+			return refresh.session, refresh.err
+		}
+	}
+
+	// sessionMutex is held
+	stale, epoch := icp.session, icp.sessionEpoch
+	if stale != nil {
+		logger.Info("Refreshing provider session", zap.String("providerName", icp.ProviderName), zap.Time("refreshAt", icp.refreshAt))
+		metrics.RegisterSessionCacheLookup(metrics.SessionCacheRefresh)
+	} else {
+		metrics.RegisterSessionCacheLookup(metrics.SessionCacheMiss)
+	}
+	refresh := &sessionRefresh{done: make(chan struct{})}
+	icp.session, icp.refresh = nil, refresh
+	icp.sessionMutex.Unlock()
+	if stale != nil {
+		stale.Close()
+	}
+
+	session, contextCredentials, err := icp.openSessionWithRetry(ctx, logger)
+	icp.sessionMutex.Lock()
+	refresh.session, refresh.err = session, err
+	icp.refresh = nil
+	// A session opened before the configuration was reloaded is returned to the waiting callers but not cached
+	if err == nil && epoch == icp.sessionEpoch {
+		icp.session, icp.refreshAt = session, icp.getRefreshTime(contextCredentials, logger)
+	}
+	close(refresh.done)
+	icp.sessionMutex.Unlock()
+	return session, err
+}
+
+// isContextError ...
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// openSessionWithRetry opens a new session, authentication failures are retried up to utils.MaxRetryAttemptForSessions attempts
+func (icp *IBMCloudStorageProvider) openSessionWithRetry(ctx context.Context, logger *zap.Logger) (provider.Session, provider.ContextCredentials, error) {
+	var session provider.Session
+	var contextCredentials provider.ContextCredentials
+	var err error
+	for attempt := 1; attempt <= utils.MaxRetryAttemptForSessions; attempt++ {
+		session, contextCredentials, err = icp.openSession(ctx, logger)
+		if err == nil || !IsAuthError(err) {
+			break
+		}
+		logger.Warn("Authentication failed while opening provider session", zap.Int("attempt", attempt), zap.Error(err))
+		icp.invalidateCredentials(logger)
+	}
+	return session, contextCredentials, err
+}
+
+// InvalidateSession drops and closes the cached session if it is still the given one, the next GetProviderSession
+// opens a new session
+func (icp *IBMCloudStorageProvider) InvalidateSession(session provider.Session) {
+	icp.sessionMutex.Lock()
+	if session == nil || icp.session != session {
+		icp.sessionMutex.Unlock()
+		return
+	}
+	icp.session = nil
+	icp.sessionMutex.Unlock()
+	session.Close()
+}
+
+// invalidateCredentials drops the cached access token or API key after the provider rejected them
+func (icp *IBMCloudStorageProvider) invalidateCredentials(logger *zap.Logger) {
+	var source interface{} = icp.getCredentialSource()
+	if tokenSource := icp.getAccessTokenSource(); tokenSource != nil {
+		source = tokenSource
+	}
+	if invalidator, ok := source.(Invalidator); ok {
+		logger.Info("Invalidating cached credentials", zap.String("providerName", icp.ProviderName))
+		invalidator.Invalidate()
+	}
+}
+
+// resetSession drops and closes the cached session, the session being opened is not cached either
+func (icp *IBMCloudStorageProvider) resetSession() {
+	icp.sessionMutex.Lock()
+	stale := icp.session
+	icp.session = nil
+	icp.sessionEpoch++
+	icp.sessionMutex.Unlock()
+	if stale != nil {
+		stale.Close()
+	}
+}
+
+// WithSession runs fn with the cached session. If fn fails to authenticate, the session is invalidated and
+// fn is retried with a new session, up to utils.MaxRetryAttemptForSessions attempts in total.
+func (icp *IBMCloudStorageProvider) WithSession(ctx context.Context, logger *zap.Logger, fn func(provider.Session) error) error {
+	var err error
+	for attempt := 1; attempt <= utils.MaxRetryAttemptForSessions; attempt++ {
+		var session provider.Session
+		session, err = icp.GetProviderSession(ctx, logger)
+		if err != nil {
+			return err
+		}
+		if err = fn(session); err == nil || !IsAuthError(err) {
+			return err
+		}
+		logger.Warn("Authentication failed with cached provider session, retrying with a new session", zap.Int("attempt", attempt), zap.Error(err))
+		icp.invalidateCredentials(logger)
+		icp.InvalidateSession(session)
+	}
+	return err
+}
+
+// getRefreshTime returns when the session must be refreshed. The expiry of IAM access tokens is read
+// from the token itself, SessionTTL is used for the other credentials.
+func (icp *IBMCloudStorageProvider) getRefreshTime(contextCredentials provider.ContextCredentials, logger *zap.Logger) time.Time {
+	if contextCredentials.AuthType == provider.IAMAccessToken {
+		if expiry, err := getTokenExpiry(contextCredentials.Credential); err == nil {
+			return expiry.Add(-sessionRefreshMargin)
+		}
+		logger.Warn("Unable to read access token expiry, using session TTL", zap.Duration("sessionTTL", icp.getSessionTTL()))
+	}
+	return time.Now().Add(icp.getSessionTTL())
+}
+
+// getSessionTTL ...
+func (icp *IBMCloudStorageProvider) getSessionTTL() time.Duration {
+	if icp.SessionTTL > 0 {
+		return icp.SessionTTL
+	}
+	return DefaultSessionTTL
+}
+
+// getTokenExpiry reads the exp claim of a JWT access token, the signature is not verified
+func getTokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("access token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, err
+	}
+	claims := struct {
+		Exp int64 `json:"exp"`
+	}{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, err
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, errors.New("exp claim missing in access token")
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
+
+// IsAuthError returns true if the provider failed to authenticate or exchange the IAM token
+func IsAuthError(err error) bool {
+	var code reasoncode.ReasonCode
+	var providerErr provider.Error
+	var providerErrPtr *provider.Error
+	switch {
+	case errors.As(err, &providerErr):
+		code = providerErr.Code()
+	case errors.As(err, &providerErrPtr) && providerErrPtr != nil:
+		code = providerErrPtr.Code()
+	default:
+		return false
+	}
+	return code == reasoncode.ErrorUnauthorised || code == reasoncode.ErrorFailedTokenExchange
+}
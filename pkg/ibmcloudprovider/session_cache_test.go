@@ -0,0 +1,286 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/IBM/ibmcloud-volume-interface/config"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	"github.com/IBM/ibmcloud-volume-interface/lib/utils/reasoncode"
+	"github.com/IBM/ibmcloud-volume-interface/provider/local/fakes"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+var authError = provider.Error{Fault: provider.Fault{Message: "token expired", ReasonCode: reasoncode.ErrorUnauthorised}}
+
+// newTestVolumeProvider returns a fake provider which opens a new fake session every time
+func newTestVolumeProvider(contextCredentials provider.ContextCredentials) *fakes.Provider {
+	ccf := &fakes.ContextCredentialsFactory{}
+	ccf.ForIAMAPIKeyReturns(contextCredentials, nil)
+	prov := &fakes.Provider{}
+	prov.ContextCredentialsFactoryReturns(ccf, nil)
+	prov.OpenSessionStub = func(ctx context.Context, contextCredentials provider.ContextCredentials, logger *zap.Logger) (provider.Session, error) {
+		return &fake.FakeSession{}, nil
+	}
+	return prov
+}
+
+// newTestSessionProvider returns a provider opening its sessions with newTestVolumeProvider
+func newTestSessionProvider(providerName string, contextCredentials provider.ContextCredentials) (*IBMCloudStorageProvider, *fakes.Provider) {
+	prov := newTestVolumeProvider(contextCredentials)
+	return &IBMCloudStorageProvider{
+		ProviderName:   providerName,
+		ProviderConfig: &config.Config{VPC: &config.VPCProviderConfig{Enabled: true, VPCBlockProviderName: providerName, APIKey: "api-key"}},
+		ClusterInfo:    &utils.ClusterInfo{ClusterID: "myclusterid", AccountID: "myaccountid"},
+		volumeProvider: prov,
+	}, prov
+}
+
+// newTestToken returns an unsigned JWT with the given expiry
+func newTestToken(expiry time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, expiry.Unix())))
+	return "eyJhbGciOiJub25lIn0." + payload + ".signature"
+}
+
+func TestGetProviderSessionCache(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	cloudProvider, prov := newTestSessionProvider("cache-provider", provider.ContextCredentials{AuthType: provider.IAMAPIKey})
+
+	// Miss
+	session, err := cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, prov.OpenSessionCallCount())
+
+	// Concurrent hits reuse the same session
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cached, err := cloudProvider.GetProviderSession(context.Background(), logger)
+			assert.Nil(t, err)
+			assert.True(t, session == cached)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, prov.OpenSessionCallCount())
+
+	// Refresh once expired
+	cloudProvider.refreshAt = time.Now().Add(-time.Second)
+	refreshed, err := cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.False(t, session == refreshed)
+	assert.Equal(t, 2, prov.OpenSessionCallCount())
+	assert.Equal(t, 1, session.(*fake.FakeSession).CloseCallCount())
+
+	// Invalidating a stale session keeps the current one
+	cloudProvider.InvalidateSession(session)
+	cached, err := cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.True(t, refreshed == cached)
+	assert.Equal(t, 2, prov.OpenSessionCallCount())
+	assert.Equal(t, 1, session.(*fake.FakeSession).CloseCallCount())
+	assert.Equal(t, 0, refreshed.(*fake.FakeSession).CloseCallCount())
+
+	// Failed refresh is not cached
+	cloudProvider.InvalidateSession(refreshed)
+	assert.Equal(t, 1, refreshed.(*fake.FakeSession).CloseCallCount())
+	prov.OpenSessionStub = nil
+	prov.OpenSessionReturns(nil, errors.New("session failed"))
+	_, err = cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.NotNil(t, err)
+	assert.Nil(t, cloudProvider.session)
+}
+
+func TestGetProviderSessionConcurrentOpen(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	cloudProvider, prov := newTestSessionProvider("concurrent-provider", provider.ContextCredentials{AuthType: provider.IAMAPIKey})
+	opening, release := make(chan struct{}), make(chan struct{})
+	prov.OpenSessionStub = func(ctx context.Context, contextCredentials provider.ContextCredentials, logger *zap.Logger) (provider.Session, error) {
+		close(opening)
+		<-release
+		return &fake.FakeSession{}, nil
+	}
+
+	opened := make(chan provider.Session)
+	go func() {
+		session, err := cloudProvider.GetProviderSession(context.Background(), logger)
+		assert.Nil(t, err)
+		opened <- session
+	}()
+	<-opening
+
+	// The session is opened without holding the lock, waiting callers give up once their context is done
+	cloudProvider.InvalidateSession(&fake.FakeSession{})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := cloudProvider.GetProviderSession(ctx, logger)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Waiting callers get the session being opened
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session, err := cloudProvider.GetProviderSession(context.Background(), logger)
+			assert.Nil(t, err)
+			assert.NotNil(t, session)
+		}()
+	}
+	close(release)
+	session := <-opened
+	wg.Wait()
+	assert.Equal(t, 1, prov.OpenSessionCallCount())
+
+	// Reloading the configuration closes the cached session
+	configPath := setupConfigDir(t)
+	cloudProvider.configPath = configPath
+	writeFile(t, configPath, strings.Replace(readFixtureConfig(t), `g2_api_key = "api-key"`, `g2_api_key = "new-api-key"`, 1))
+	cloudProvider.ProviderName, cloudProvider.ClusterInfo = "vpc", &utils.ClusterInfo{ClusterID: "blhl930d0ruuc29rd523"}
+	reloaded, err := cloudProvider.ReloadConfig(logger)
+	assert.Nil(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, 1, session.(*fake.FakeSession).CloseCallCount())
+	assert.Nil(t, cloudProvider.session)
+}
+
+func TestGetProviderSessionAuthRetry(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	cloudProvider, prov := newTestSessionProvider("auth-provider", provider.ContextCredentials{AuthType: provider.IAMAPIKey})
+
+	// Token exchange failure is retried
+	prov.OpenSessionStub = nil
+	prov.OpenSessionReturnsOnCall(0, nil, provider.Error{Fault: provider.Fault{ReasonCode: reasoncode.ErrorFailedTokenExchange}})
+	prov.OpenSessionReturnsOnCall(1, &fake.FakeSession{}, nil)
+	session, err := cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.NotNil(t, session)
+	assert.Equal(t, 2, prov.OpenSessionCallCount())
+
+	// Attempts are bounded
+	cloudProvider.InvalidateSession(session)
+	prov.OpenSessionReturnsOnCall(2, nil, authError)
+	prov.OpenSessionReturnsOnCall(3, nil, authError)
+	prov.OpenSessionReturnsOnCall(4, &fake.FakeSession{}, nil)
+	_, err = cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.True(t, IsAuthError(err))
+	assert.Equal(t, 2+utils.MaxRetryAttemptForSessions, prov.OpenSessionCallCount())
+}
+
+func TestWithSession(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	cloudProvider, prov := newTestSessionProvider("with-session-provider", provider.ContextCredentials{AuthType: provider.IAMAPIKey})
+
+	// Auth failure is retried once with a new session
+	var sessions []provider.Session
+	err := cloudProvider.WithSession(context.Background(), logger, func(session provider.Session) error {
+		sessions = append(sessions, session)
+		if len(sessions) == 1 {
+			return authError
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(sessions))
+	assert.False(t, sessions[0] == sessions[1])
+	assert.Equal(t, 2, prov.OpenSessionCallCount())
+
+	// Bounded by MaxRetryAttemptForSessions
+	calls := 0
+	err = cloudProvider.WithSession(context.Background(), logger, func(session provider.Session) error {
+		calls++
+		return authError
+	})
+	assert.True(t, IsAuthError(err))
+	assert.Equal(t, utils.MaxRetryAttemptForSessions, calls)
+
+	// Other errors are not retried
+	calls = 0
+	err = cloudProvider.WithSession(context.Background(), logger, func(session provider.Session) error {
+		calls++
+		return errors.New("volume not found")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestGetRefreshTime(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	cloudProvider := &IBMCloudStorageProvider{SessionTTL: 10 * time.Minute}
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	testCases := []struct {
+		testCaseName       string
+		contextCredentials provider.ContextCredentials
+		expectedRefreshAt  time.Time
+	}{
+		{
+			testCaseName:       "Access token expiry",
+			contextCredentials: provider.ContextCredentials{AuthType: provider.IAMAccessToken, Credential: newTestToken(expiry)},
+			expectedRefreshAt:  expiry.Add(-sessionRefreshMargin),
+		},
+		{
+			testCaseName:       "Access token without expiry",
+			contextCredentials: provider.ContextCredentials{AuthType: provider.IAMAccessToken, Credential: "opaque-token"},
+			expectedRefreshAt:  time.Now().Add(10 * time.Minute),
+		},
+		{
+			testCaseName:       "API key",
+			contextCredentials: provider.ContextCredentials{AuthType: provider.IAMAPIKey, Credential: "api-key"},
+			expectedRefreshAt:  time.Now().Add(10 * time.Minute),
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			refreshAt := cloudProvider.getRefreshTime(testcase.contextCredentials, logger)
+			assert.WithinDuration(t, testcase.expectedRefreshAt, refreshAt, 5*time.Second)
+		})
+	}
+}
+
+func TestIsAuthError(t *testing.T) {
+	assert.True(t, IsAuthError(authError))
+	assert.True(t, IsAuthError(&authError))
+	assert.True(t, IsAuthError(fmt.Errorf("update volume: %w", authError)))
+	assert.False(t, IsAuthError(provider.Error{Fault: provider.Fault{ReasonCode: "ErrorVolumeNotFound"}}))
+	assert.False(t, IsAuthError(errors.New("unauthorised")))
+	assert.False(t, IsAuthError(nil))
+}
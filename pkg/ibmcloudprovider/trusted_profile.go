@@ -0,0 +1,194 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/IBM/ibm-csi-common/pkg/iamtoken"
+	"github.com/IBM/ibmcloud-volume-interface/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+const (
+	// APIKeyAuthType authenticates with the API key of slclient.toml or of the credential source
+	APIKeyAuthType = "api-key"
+
+	// TrustedProfileAuthType authenticates as an IAM trusted profile with the projected service account token
+	TrustedProfileAuthType = "trusted-profile"
+
+	// DefaultCRTokenFilePath is where the projected service account token is mounted unless cr_token_file_path is set
+	DefaultCRTokenFilePath = "/var/run/secrets/tokens/sa-token"
+
+	// DefaultTokenExchangeURL is the IAM endpoint used if the token exchange URL is not set in slclient.toml
+	DefaultTokenExchangeURL = iamtoken.DefaultTokenExchangeURL
+
+	// crTokenGrantType is the IAM grant type exchanging a compute resource token for a trusted profile token
+	crTokenGrantType = "urn:ibm:params:oauth:grant-type:cr-token"
+
+	iamRequestTimeout = 30 * time.Second
+)
+
+// AuthConfig is the IAM authentication settings of the vpc section of slclient.toml, next to g2_api_key.
+// They are read separately as config.VPCProviderConfig does not have them.
+type AuthConfig struct {
+	// IAMAuthType is api-key, the default, or trusted-profile
+	IAMAuthType string `toml:"iam_auth_type"`
+	// IAMProfileID is the trusted profile to authenticate as
+	IAMProfileID string `toml:"iam_profile_id"`
+	// CRTokenFilePath is the projected service account token exchanged for the trusted profile token
+	CRTokenFilePath string `toml:"cr_token_file_path"`
+}
+
+// ParseAuthConfig reads the IAM authentication settings of slclient.toml, applying the defaults
+func ParseAuthConfig(data string) (*AuthConfig, error) {
+	conf := struct {
+		VPC AuthConfig
+	}{}
+	if _, err := toml.Decode(data, &conf); err != nil {
+		return nil, err
+	}
+	auth := conf.VPC
+	if auth.IAMAuthType == "" {
+		auth.IAMAuthType = APIKeyAuthType
+	}
+	if auth.CRTokenFilePath == "" {
+		auth.CRTokenFilePath = DefaultCRTokenFilePath
+	}
+	return &auth, nil
+}
+
+// IsTrustedProfile ...
+func (auth *AuthConfig) IsTrustedProfile() bool {
+	return auth != nil && auth.IAMAuthType == TrustedProfileAuthType
+}
+
+// AccessTokenSource provides the IAM access tokens used to open provider sessions instead of an API key
+type AccessTokenSource interface {
+	// GetAccessToken returns a valid IAM access token
+	GetAccessToken(ctx context.Context, logger *zap.Logger) (string, error)
+}
+
+// TrustedProfileTokenSource exchanges the compute resource token, i.e the projected service account token,
+// for IAM access tokens of a trusted profile. Tokens are cached until shortly before they expire. The token
+// file is read on every exchange as kubelet rotates it.
+type TrustedProfileTokenSource struct {
+	TokenURL        string
+	ProfileID       string
+	CRTokenFilePath string
+	HTTPClient      *http.Client
+
+	mutex       sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+	// generation is incremented by Invalidate, tokens exchanged before are not cached
+	generation uint64
+}
+
+var _ AccessTokenSource = &TrustedProfileTokenSource{}
+var _ Invalidator = &TrustedProfileTokenSource{}
+
+// NewTrustedProfileTokenSource returns a source exchanging the token at crTokenFilePath on the IAM endpoint tokenExchangeURL
+func NewTrustedProfileTokenSource(tokenExchangeURL string, profileID string, crTokenFilePath string) *TrustedProfileTokenSource {
+	return &TrustedProfileTokenSource{
+		TokenURL:        iamtoken.TokenURL(tokenExchangeURL),
+		ProfileID:       profileID,
+		CRTokenFilePath: crTokenFilePath,
+		HTTPClient:      &http.Client{Timeout: iamRequestTimeout},
+	}
+}
+
+// GetAccessToken returns the cached token, a new one is exchanged if it is missing or about to expire.
+// IAM is called without holding the mutex, so a slow exchange does not block the cached token.
+func (source *TrustedProfileTokenSource) GetAccessToken(ctx context.Context, logger *zap.Logger) (string, error) {
+	source.mutex.Lock()
+	// Same margin as the session refresh, so a refreshed session never gets the expiring token again
+	if source.accessToken != "" && time.Now().Before(source.expiresAt.Add(-sessionRefreshMargin)) {
+		accessToken := source.accessToken
+		source.mutex.Unlock()
+		return accessToken, nil
+	}
+	generation := source.generation
+	source.mutex.Unlock()
+
+	accessToken, expiresAt, err := source.exchange(ctx, logger)
+	if err != nil {
+		return "", err
+	}
+	source.store(accessToken, expiresAt, generation)
+	logger.Info("Exchanged compute resource token for trusted profile token", zap.String("profileID", source.ProfileID), zap.Time("expiresAt", expiresAt))
+	return accessToken, nil
+}
+
+// Invalidate drops the cached token, the next GetAccessToken exchanges a new one
+func (source *TrustedProfileTokenSource) Invalidate() {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	source.accessToken, source.expiresAt = "", time.Time{}
+	source.generation++
+}
+
+// store caches the token exchanged at the given generation, unless it was invalidated since
+func (source *TrustedProfileTokenSource) store(accessToken string, expiresAt time.Time, generation uint64) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	if generation != source.generation {
+		return
+	}
+	source.accessToken, source.expiresAt = accessToken, expiresAt
+}
+
+// exchange requests a new access token from IAM. IAM rejections are ErrorFailedTokenExchange provider
+// errors, so opening the session is retried with a token read again from the file.
+func (source *TrustedProfileTokenSource) exchange(ctx context.Context, logger *zap.Logger) (string, time.Time, error) {
+	crToken, err := os.ReadFile(filepath.Clean(source.CRTokenFilePath))
+	if err != nil {
+		logger.Error("Failed to read compute resource token", zap.String("path", source.CRTokenFilePath), zap.Error(err))
+		return "", time.Time{}, err
+	}
+
+	form := url.Values{
+		"grant_type": {crTokenGrantType},
+		"cr_token":   {strings.TrimSpace(string(crToken))},
+		"profile_id": {source.ProfileID},
+	}
+	return iamtoken.Request(ctx, source.HTTPClient, source.TokenURL, form, logger)
+}
+
+// getTokenExchangeURL returns the IAM endpoint of the enabled provider, the bluemix IAM URL for IKS and
+// the one of the VPC provider type otherwise
+func getTokenExchangeURL(conf *config.Config) string {
+	if conf.IKS != nil && conf.IKS.Enabled && conf.Bluemix != nil && conf.Bluemix.IamURL != "" {
+		return conf.Bluemix.IamURL
+	}
+	if conf.VPC == nil {
+		return ""
+	}
+	if conf.VPC.VPCBlockProviderType == g2ProviderType {
+		return conf.VPC.G2TokenExchangeURL
+	}
+	return conf.VPC.TokenExchangeURL
+}
@@ -0,0 +1,259 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/ibmcloudprovider/fakevpcserver"
+	"github.com/IBM/ibm-csi-common/pkg/messages"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestParseAuthConfig(t *testing.T) {
+	testCases := []struct {
+		testCaseName     string
+		settings         string
+		expectedAuth     AuthConfig
+		expectedFindings []string
+	}{
+		{
+			testCaseName: "API key by default",
+			expectedAuth: AuthConfig{IAMAuthType: APIKeyAuthType, CRTokenFilePath: DefaultCRTokenFilePath},
+		},
+		{
+			testCaseName: "Trusted profile",
+			settings:     `iam_auth_type = "trusted-profile"` + "\n" + `iam_profile_id = "Profile-1"` + "\n" + `cr_token_file_path = "/token"`,
+			expectedAuth: AuthConfig{IAMAuthType: TrustedProfileAuthType, IAMProfileID: "Profile-1", CRTokenFilePath: "/token"},
+		},
+		{
+			testCaseName:     "Trusted profile without profile",
+			settings:         `iam_auth_type = "trusted-profile"`,
+			expectedAuth:     AuthConfig{IAMAuthType: TrustedProfileAuthType, CRTokenFilePath: DefaultCRTokenFilePath},
+			expectedFindings: []string{messages.MissingTrustedProfile},
+		},
+		{
+			testCaseName:     "Unknown type",
+			settings:         `iam_auth_type = "password"`,
+			expectedAuth:     AuthConfig{IAMAuthType: "password", CRTokenFilePath: DefaultCRTokenFilePath},
+			expectedFindings: []string{messages.InvalidAuthType},
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			auth, err := ParseAuthConfig(strings.Replace(readFixtureConfig(t), "[vpc]", "[vpc]\n"+testcase.settings, 1))
+			assert.Nil(t, err)
+			assert.Equal(t, testcase.expectedAuth, *auth)
+			var codes []string
+			for _, finding := range ValidateAuth(auth) {
+				codes = append(codes, finding.Code)
+				assert.NotContains(t, finding.Description, "%!")
+			}
+			assert.Equal(t, testcase.expectedFindings, codes)
+		})
+	}
+}
+
+func TestTrustedProfileTokenSource(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	server := fakevpcserver.NewServer()
+	defer server.Close()
+	server.CRToken = "sa-token"
+	// The token is refreshed shortly after it is issued, expiries have a second precision
+	server.TokenTTL = sessionRefreshMargin + 2*time.Second
+	tokenPath := filepath.Join(t.TempDir(), "sa-token")
+	assert.Nil(t, os.WriteFile(tokenPath, []byte("sa-token\n"), 0600))
+
+	source := NewTrustedProfileTokenSource(server.URL+"/", fakevpcserver.DefaultProfileID, tokenPath)
+	accessToken, err := source.GetAccessToken(context.Background(), logger)
+	assert.Nil(t, err)
+	expiry, err := getTokenExpiry(accessToken)
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now().Add(server.TokenTTL), expiry, 2*time.Second)
+	cached, err := source.GetAccessToken(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, accessToken, cached)
+	assert.Equal(t, 1, server.RequestCount(fakevpcserver.RouteIAMToken))
+
+	time.Sleep(2100 * time.Millisecond)
+	refreshed, err := source.GetAccessToken(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.NotEqual(t, accessToken, refreshed)
+	assert.Equal(t, 2, server.RequestCount(fakevpcserver.RouteIAMToken))
+
+	// Invalidated token is exchanged again
+	source.Invalidate()
+	exchanged, err := source.GetAccessToken(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.NotEqual(t, refreshed, exchanged)
+	assert.Equal(t, 3, server.RequestCount(fakevpcserver.RouteIAMToken))
+
+	// Rejected tokens are authentication errors, so opening the session is retried
+	testCases := []struct {
+		testCaseName string
+		source       *TrustedProfileTokenSource
+		expectedAuth bool
+	}{
+		{
+			testCaseName: "Unknown profile",
+			source:       NewTrustedProfileTokenSource(server.URL, "Profile-unknown", tokenPath),
+			expectedAuth: true,
+		},
+		{
+			testCaseName: "IAM unavailable",
+			source:       NewTrustedProfileTokenSource("http://127.0.0.1:1", fakevpcserver.DefaultProfileID, tokenPath),
+			expectedAuth: true,
+		},
+		{
+			testCaseName: "Token file missing",
+			source:       NewTrustedProfileTokenSource(server.URL, fakevpcserver.DefaultProfileID, filepath.Join(t.TempDir(), "missing")),
+		},
+	}
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			_, err := testcase.source.GetAccessToken(context.Background(), logger)
+			assert.NotNil(t, err)
+			assert.Equal(t, testcase.expectedAuth, IsAuthError(err))
+		})
+	}
+	assert.Equal(t, DefaultTokenExchangeURL+"/identity/token", NewTrustedProfileTokenSource("", "Profile-1", tokenPath).TokenURL)
+}
+
+func TestTrustedProfileTokenSourceSlowExchange(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	server := fakevpcserver.NewServer()
+	defer server.Close()
+	server.CRToken = "sa-token"
+	server.SetLatency(fakevpcserver.RouteIAMToken, time.Second)
+	tokenPath := filepath.Join(t.TempDir(), "sa-token")
+	assert.Nil(t, os.WriteFile(tokenPath, []byte("sa-token\n"), 0600))
+	source := NewTrustedProfileTokenSource(server.URL, fakevpcserver.DefaultProfileID, tokenPath)
+
+	exchanged := make(chan error)
+	go func() {
+		_, err := source.GetAccessToken(context.Background(), logger)
+		exchanged <- err
+	}()
+	assert.Eventually(t, func() bool { return server.RequestCount(fakevpcserver.RouteIAMToken) == 1 }, time.Second, 10*time.Millisecond)
+
+	// Neither Invalidate nor other callers wait for the pending exchange
+	start := time.Now()
+	source.Invalidate()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := source.GetAccessToken(ctx, logger)
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// The token exchanged before Invalidate is returned but not cached
+	assert.Nil(t, <-exchanged)
+	server.SetLatency(fakevpcserver.RouteIAMToken, 0)
+	_, err = source.GetAccessToken(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, server.RequestCount(fakevpcserver.RouteIAMToken))
+}
+
+func TestProviderWithTrustedProfile(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	server := fakevpcserver.NewServer()
+	defer server.Close()
+	tokenPath := filepath.Join(t.TempDir(), "sa-token")
+	assert.Nil(t, os.WriteFile(tokenPath, []byte("sa-token"), 0600))
+
+	// Trusted profile replaces the API key
+	configPath := setupConfigDir(t)
+	trustedProfileConfig := strings.NewReplacer(
+		`g2_token_exchange_endpoint_url = "https://iam.stage1.bluemix.net"`, `g2_token_exchange_endpoint_url = "`+server.URL+`"`,
+		"[vpc]", "[vpc]\n  iam_auth_type = \"trusted-profile\"\n  iam_profile_id = \""+fakevpcserver.DefaultProfileID+"\"\n  cr_token_file_path = \""+tokenPath+"\"",
+	).Replace(readFixtureConfigWithoutAPIKey(t))
+	writeFile(t, configPath, trustedProfileConfig)
+	prov := newTestVolumeProvider(provider.ContextCredentials{})
+	cloudProvider, err := NewIBMCloudStorageProvider(configPath, prov, logger)
+	assert.Nil(t, err)
+
+	session, err := cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.NotNil(t, session)
+	assert.Equal(t, 0, prov.ContextCredentialsFactoryCallCount())
+	_, contextCredentials, _ := prov.OpenSessionArgsForCall(0)
+	assert.Equal(t, provider.IAMAccessToken, contextCredentials.AuthType)
+	assert.Equal(t, "t242f140687cd68a8e037b26680e0f23", contextCredentials.IAMAccountID)
+	expiry, err := getTokenExpiry(contextCredentials.Credential)
+	assert.Nil(t, err)
+	assert.WithinDuration(t, expiry.Add(-sessionRefreshMargin), cloudProvider.refreshAt, time.Second)
+
+	// Switching back to the API key on reload, which requires it again
+	writeFile(t, configPath, readFixtureConfigWithoutAPIKey(t))
+	reloaded, err := cloudProvider.ReloadConfig(logger)
+	assert.NotNil(t, err)
+	assert.False(t, reloaded)
+	writeFile(t, configPath, readFixtureConfig(t))
+	reloaded, err = cloudProvider.ReloadConfig(logger)
+	assert.Nil(t, err)
+	assert.True(t, reloaded)
+	assert.Nil(t, cloudProvider.getAccessTokenSource())
+
+	// Profile is required
+	writeFile(t, configPath, strings.Replace(trustedProfileConfig, fakevpcserver.DefaultProfileID, "", 1))
+	_, err = NewIBMCloudStorageProvider(configPath, prov, logger)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), messages.MissingTrustedProfile)
+}
+
+func TestTrustedProfileTokenRejected(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	server := fakevpcserver.NewServer()
+	defer server.Close()
+	tokenPath := filepath.Join(t.TempDir(), "sa-token")
+	assert.Nil(t, os.WriteFile(tokenPath, []byte("sa-token"), 0600))
+	configPath := setupConfigDir(t)
+	writeFile(t, configPath, strings.NewReplacer(
+		`g2_token_exchange_endpoint_url = "https://iam.stage1.bluemix.net"`, `g2_token_exchange_endpoint_url = "`+server.URL+`"`,
+		"[vpc]", "[vpc]\n  iam_auth_type = \"trusted-profile\"\n  iam_profile_id = \""+fakevpcserver.DefaultProfileID+"\"\n  cr_token_file_path = \""+tokenPath+"\"",
+	).Replace(readFixtureConfigWithoutAPIKey(t)))
+	cloudProvider, err := NewIBMCloudStorageProvider(configPath, &fakeVPCProvider{server: server}, logger)
+	assert.Nil(t, err)
+
+	// First token is rejected by VPC, the retry exchanges a second one instead of reusing the cached token
+	capacity := 10
+	err = cloudProvider.WithSession(context.Background(), logger, func(session provider.Session) error {
+		if server.RequestCount(fakevpcserver.RouteIAMToken) == 1 {
+			server.ExpireTokens()
+		}
+		_, err := session.CreateVolume(provider.Volume{Capacity: &capacity, Az: "us-south-1"})
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, server.RequestCount(fakevpcserver.RouteIAMToken))
+	assert.Equal(t, 2, server.RequestCount(fakevpcserver.RouteCreateVolume))
+}
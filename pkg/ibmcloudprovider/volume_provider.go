@@ -0,0 +1,302 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/messages"
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/IBM/ibmcloud-volume-interface/config"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/provider/local"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+const (
+	// g2ProviderType is the provider_type of VPC gen2 in slclient.toml
+	g2ProviderType = "g2"
+)
+
+// IBMCloudStorageProvider Provider
+type IBMCloudStorageProvider struct {
+	ProviderName string
+
+	// ProviderConfig and ClusterInfo are replaced on ReloadConfig, use GetConfig and GetClusterID to read them
+	ProviderConfig *config.Config
+	ClusterInfo    *utils.ClusterInfo
+
+	// SessionTTL is how long a session is reused if its token expiry is unknown, DefaultSessionTTL if zero
+	SessionTTL time.Duration
+
+	// ConfigReloadDelay is how long WatchConfig waits for the files to settle, DefaultConfigReloadDelay if zero
+	ConfigReloadDelay time.Duration
+
+	credentialSource CredentialSource
+	tokenSource      AccessTokenSource
+
+	// volumeProvider opens the sessions of the enabled VPC or IKS provider
+	volumeProvider local.Provider
+
+	configPath   string
+	configMutex  sync.RWMutex
+	configHash   string
+	rejectedHash string
+
+	sessionMutex sync.Mutex
+	session      provider.Session
+	refreshAt    time.Time
+	refresh      *sessionRefresh
+	// sessionEpoch is incremented whenever the cached session is reset by a configuration reload
+	sessionEpoch uint64
+}
+
+var _ CloudProviderInterface = &IBMCloudStorageProvider{}
+
+// providerFiles is the parsed content of slclient.toml and the cluster info
+type providerFiles struct {
+	conf         *config.Config
+	auth         *AuthConfig
+	providerName string
+	clusterInfo  *utils.ClusterInfo
+	// hash of the raw content of both files
+	hash string
+}
+
+// NewIBMCloudStorageProvider reads the slclient.toml at configPath and the cluster info from the SECRET_CONFIG_PATH directory.
+// The sessions are opened by volumeProvider, the local.Provider of the VPC or IKS provider enabled in slclient.toml.
+func NewIBMCloudStorageProvider(configPath string, volumeProvider local.Provider, logger *zap.Logger) (*IBMCloudStorageProvider, error) {
+	return NewIBMCloudStorageProviderWithCredentialSource(configPath, volumeProvider, nil, logger)
+}
+
+// NewIBMCloudStorageProviderWithCredentialSource is NewIBMCloudStorageProvider reading the API key from
+// credentialSource, the API key of slclient.toml is used if it is nil
+func NewIBMCloudStorageProviderWithCredentialSource(configPath string, volumeProvider local.Provider, credentialSource CredentialSource, logger *zap.Logger) (*IBMCloudStorageProvider, error) {
+	logger.Info("NewIBMCloudStorageProvider-Reading provider configuration...", zap.String("configPath", configPath))
+	if volumeProvider == nil {
+		return nil, errors.New("volume provider is required")
+	}
+	files, err := readProviderFiles(configPath, credentialSource == nil, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudProvider := &IBMCloudStorageProvider{
+		ProviderName:   files.providerName,
+		ProviderConfig: files.conf,
+		ClusterInfo:    files.clusterInfo,
+		configPath:     configPath,
+		configHash:     files.hash,
+		tokenSource:    files.newAccessTokenSource(),
+		volumeProvider: volumeProvider,
+	}
+	if identifier, ok := credentialSource.(ProviderIdentifier); ok {
+		identifier.SetProvider(files.providerName, files.clusterInfo.ClusterID)
+	}
+	cloudProvider.credentialSource = credentialSource
+	logger.Info("Successfully read provider configuration", zap.String("providerName", files.providerName), zap.String("clusterID", files.clusterInfo.ClusterID), zap.String("iamAuthType", files.auth.IAMAuthType))
+	return cloudProvider, nil
+}
+
+// readProviderFiles reads and validates the slclient.toml at configPath and the cluster info, the API key
+// is only required if apiKeyInConfig is set and no trusted profile is used
+func readProviderFiles(configPath string, apiKeyInConfig bool, logger *zap.Logger) (*providerFiles, error) {
+	data, err := os.ReadFile(filepath.Clean(configPath))
+	if err != nil {
+		logger.Error("Failed to read provider configuration", zap.Error(err))
+		return nil, err
+	}
+	clusterInfoPath := utils.GetClusterInfoPath(utils.GetConfigDir())
+	clusterInfoData, err := os.ReadFile(filepath.Clean(clusterInfoPath))
+	if err != nil {
+		logger.Error("Failed to read cluster info", zap.String("path", clusterInfoPath), zap.Error(err))
+		return nil, err
+	}
+	hash := sha256.New()
+	_, _ = hash.Write(data)
+	_, _ = hash.Write(clusterInfoData)
+	files := &providerFiles{hash: hex.EncodeToString(hash.Sum(nil))}
+
+	if files.conf, err = config.ParseConfig(logger, string(data)); err != nil {
+		return files, err
+	}
+	if files.auth, err = ParseAuthConfig(string(data)); err != nil {
+		return files, err
+	}
+	findings := append(Validate(files.conf), ValidateAuth(files.auth)...)
+	if !apiKeyInConfig || files.auth.IsTrustedProfile() {
+		findings = findings.Without(messages.MissingAPIKey)
+	}
+	for _, finding := range findings {
+		logger.Warn("Provider configuration finding", zap.String("field", finding.Field), zap.String("severity", finding.Severity), zap.Error(finding.Message))
+	}
+	if findings.HasErrors() {
+		return files, findings.Err()
+	}
+	if files.providerName, err = getProviderName(files.conf); err != nil {
+		logger.Error("No volume provider enabled", zap.Error(err))
+		return files, err
+	}
+
+	files.clusterInfo = &utils.ClusterInfo{}
+	if err = json.Unmarshal(clusterInfoData, files.clusterInfo); err != nil {
+		logger.Error("Failed to parse cluster info", zap.String("path", clusterInfoPath), zap.Error(err))
+		return files, err
+	}
+	if files.clusterInfo.ClusterID == "" {
+		return files, fmt.Errorf("Cluster ID missing in cluster info %s", clusterInfoPath)
+	}
+	return files, nil
+}
+
+// newAccessTokenSource returns the trusted profile token source, nil if the API key is used
+func (files *providerFiles) newAccessTokenSource() AccessTokenSource {
+	if !files.auth.IsTrustedProfile() {
+		return nil
+	}
+	return NewTrustedProfileTokenSource(getTokenExchangeURL(files.conf), files.auth.IAMProfileID, files.auth.CRTokenFilePath)
+}
+
+// getProviderName returns the name of the enabled provider, IKS takes precedence as it fronts VPC
+func getProviderName(conf *config.Config) (string, error) {
+	if conf.IKS != nil && conf.IKS.Enabled {
+		if conf.IKS.IKSBlockProviderName == "" {
+			return "", errors.New("iks_block_provider_name is not set")
+		}
+		return conf.IKS.IKSBlockProviderName, nil
+	}
+	if conf.VPC != nil && conf.VPC.Enabled {
+		if conf.VPC.VPCBlockProviderName == "" {
+			return "", errors.New("vpc_block_provider_name is not set")
+		}
+		return conf.VPC.VPCBlockProviderName, nil
+	}
+	return "", errors.New("Neither VPC nor IKS provider is enabled in the configuration")
+}
+
+// getAPIKey returns the API key of the enabled provider
+func getAPIKey(conf *config.Config) string {
+	if conf.IKS != nil && conf.IKS.Enabled {
+		if conf.Bluemix != nil {
+			return conf.Bluemix.IamAPIKey
+		}
+		return ""
+	}
+	if conf.VPC.VPCBlockProviderType == g2ProviderType && conf.VPC.G2APIKey != "" {
+		return conf.VPC.G2APIKey
+	}
+	return conf.VPC.APIKey
+}
+
+// openSession opens a new session of the enabled provider, authenticated with the trusted profile token
+// if configured or else with the IAM API key
+func (icp *IBMCloudStorageProvider) openSession(ctx context.Context, logger *zap.Logger) (provider.Session, provider.ContextCredentials, error) {
+	prov := icp.volumeProvider
+	if prov == nil {
+		return nil, provider.ContextCredentials{}, fmt.Errorf("Provider '%s' is not initialized", icp.ProviderName)
+	}
+	contextCredentials, err := icp.getContextCredentials(ctx, prov, logger)
+	if err != nil {
+		return nil, provider.ContextCredentials{}, err
+	}
+	session, err := prov.OpenSession(ctx, contextCredentials, logger)
+	if err != nil {
+		logger.Error("Failed to open provider session", zap.String("providerName", icp.ProviderName), zap.Error(err))
+		return nil, contextCredentials, err
+	}
+	logger.Info("Successfully opened provider session", zap.String("providerName", icp.ProviderName))
+	return session, contextCredentials, nil
+}
+
+// getContextCredentials returns the credentials of a new session
+func (icp *IBMCloudStorageProvider) getContextCredentials(ctx context.Context, prov local.Provider, logger *zap.Logger) (provider.ContextCredentials, error) {
+	if tokenSource := icp.getAccessTokenSource(); tokenSource != nil {
+		accessToken, err := tokenSource.GetAccessToken(ctx, logger)
+		if err != nil {
+			logger.Error("Failed to get trusted profile access token", zap.String("providerName", icp.ProviderName), zap.Error(err))
+			return provider.ContextCredentials{}, err
+		}
+		return provider.ContextCredentials{
+			AuthType:     provider.IAMAccessToken,
+			IAMAccountID: icp.GetAccountID(),
+			Credential:   accessToken,
+		}, nil
+	}
+
+	ccf, err := prov.ContextCredentialsFactory(nil)
+	if err != nil {
+		logger.Error("Failed to get context credentials factory", zap.String("providerName", icp.ProviderName), zap.Error(err))
+		return provider.ContextCredentials{}, err
+	}
+	apiKey, err := icp.getCredentialSource().GetAPIKey(ctx, logger)
+	if err != nil {
+		logger.Error("Failed to get API key", zap.String("providerName", icp.ProviderName), zap.Error(err))
+		return provider.ContextCredentials{}, err
+	}
+	contextCredentials, err := ccf.ForIAMAPIKey(icp.GetAccountID(), apiKey, logger)
+	if err != nil {
+		logger.Error("Failed to generate context credentials", zap.String("providerName", icp.ProviderName), zap.Error(err))
+		return provider.ContextCredentials{}, err
+	}
+	return contextCredentials, nil
+}
+
+// getAccessTokenSource returns the trusted profile token source, nil if the API key is used
+func (icp *IBMCloudStorageProvider) getAccessTokenSource() AccessTokenSource {
+	icp.configMutex.RLock()
+	defer icp.configMutex.RUnlock()
+	return icp.tokenSource
+}
+
+// getCredentialSource returns the source of the API key, slclient.toml unless another one was given
+func (icp *IBMCloudStorageProvider) getCredentialSource() CredentialSource {
+	if icp.credentialSource == nil {
+		return NewConfigCredentialSource(icp.GetConfig)
+	}
+	return icp.credentialSource
+}
+
+// GetConfig ...
+func (icp *IBMCloudStorageProvider) GetConfig() *config.Config {
+	icp.configMutex.RLock()
+	defer icp.configMutex.RUnlock()
+	return icp.ProviderConfig
+}
+
+// GetAccountID ...
+func (icp *IBMCloudStorageProvider) GetAccountID() string {
+	icp.configMutex.RLock()
+	defer icp.configMutex.RUnlock()
+	return icp.ClusterInfo.AccountID
+}
+
+// GetClusterID ...
+func (icp *IBMCloudStorageProvider) GetClusterID() string {
+	icp.configMutex.RLock()
+	defer icp.configMutex.RUnlock()
+	return icp.ClusterInfo.ClusterID
+}
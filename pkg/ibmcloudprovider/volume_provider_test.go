@@ -0,0 +1,319 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ibmcloudprovider ...
+package ibmcloudprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IBM/ibm-csi-common/pkg/iamtoken"
+	"github.com/IBM/ibm-csi-common/pkg/ibmcloudprovider/fakevpcserver"
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/IBM/ibmcloud-volume-interface/config"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider"
+	"github.com/IBM/ibmcloud-volume-interface/lib/provider/fake"
+	util "github.com/IBM/ibmcloud-volume-interface/lib/utils"
+	"github.com/IBM/ibmcloud-volume-interface/lib/utils/reasoncode"
+	"github.com/IBM/ibmcloud-volume-interface/provider/local"
+	"github.com/IBM/ibmcloud-volume-interface/provider/local/fakes"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+var testFixtures = filepath.Join("..", "..", "test-fixtures")
+
+func TestNewIBMCloudStorageProvider(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	testCases := []struct {
+		testCaseName         string
+		configPath           string
+		secretConfigPath     string
+		expectedProviderName string
+		expectedClusterID    string
+		expectedErr          bool
+	}{
+		{
+			testCaseName:         "VPC provider enabled",
+			configPath:           filepath.Join(testFixtures, "slconfig.toml"),
+			secretConfigPath:     filepath.Join(testFixtures, "valid"),
+			expectedProviderName: "vpc",
+			expectedClusterID:    "blhl930d0ruuc29rd523",
+		},
+		{
+			testCaseName:     "Providers disabled",
+			configPath:       filepath.Join(testFixtures, "provider-disabled.toml"),
+			secretConfigPath: filepath.Join(testFixtures, "valid"),
+			expectedErr:      true,
+		},
+		{
+			testCaseName:     "Config file missing",
+			configPath:       filepath.Join(testFixtures, "slclient.toml"),
+			secretConfigPath: filepath.Join(testFixtures, "valid"),
+			expectedErr:      true,
+		},
+		{
+			testCaseName:     "Invalid cluster info",
+			configPath:       filepath.Join(testFixtures, "slconfig.toml"),
+			secretConfigPath: filepath.Join(testFixtures, "invalid"),
+			expectedErr:      true,
+		},
+		{
+			testCaseName:     "Cluster info missing",
+			configPath:       filepath.Join(testFixtures, "slconfig.toml"),
+			secretConfigPath: testFixtures,
+			expectedErr:      true,
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			t.Setenv(utils.SecretConfigPathEnv, testcase.secretConfigPath)
+			cloudProvider, err := NewIBMCloudStorageProvider(testcase.configPath, &fakes.Provider{}, logger)
+			if testcase.expectedErr {
+				assert.NotNil(t, err)
+				assert.Nil(t, cloudProvider)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testcase.expectedProviderName, cloudProvider.ProviderName)
+			assert.Equal(t, testcase.expectedClusterID, cloudProvider.GetClusterID())
+			assert.NotNil(t, cloudProvider.GetConfig().VPC)
+		})
+	}
+}
+
+func TestGetProviderName(t *testing.T) {
+	testCases := []struct {
+		testCaseName         string
+		conf                 *config.Config
+		expectedProviderName string
+		expectedErr          bool
+	}{
+		{
+			testCaseName:         "VPC enabled",
+			conf:                 &config.Config{VPC: &config.VPCProviderConfig{Enabled: true, VPCBlockProviderName: "vpc"}},
+			expectedProviderName: "vpc",
+		},
+		{
+			testCaseName: "IKS takes precedence",
+			conf: &config.Config{
+				VPC: &config.VPCProviderConfig{Enabled: true, VPCBlockProviderName: "vpc"},
+				IKS: &config.IKSConfig{Enabled: true, IKSBlockProviderName: "iks-vpc-classic"},
+			},
+			expectedProviderName: "iks-vpc-classic",
+		},
+		{
+			testCaseName: "Provider name missing",
+			conf:         &config.Config{VPC: &config.VPCProviderConfig{Enabled: true}},
+			expectedErr:  true,
+		},
+		{
+			testCaseName: "Nothing enabled",
+			conf:         &config.Config{},
+			expectedErr:  true,
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			providerName, err := getProviderName(testcase.conf)
+			if testcase.expectedErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testcase.expectedProviderName, providerName)
+		})
+	}
+}
+
+func TestGetProviderSession(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	t.Setenv(utils.SecretConfigPathEnv, filepath.Join(testFixtures, "valid"))
+	// Volume provider is required
+	_, err := NewIBMCloudStorageProvider(filepath.Join(testFixtures, "slconfig.toml"), nil, logger)
+	assert.NotNil(t, err)
+
+	ccf := &fakes.ContextCredentialsFactory{}
+	ccf.ForIAMAPIKeyReturns(provider.ContextCredentials{AuthType: provider.IAMAPIKey, IAMAccountID: "t242f140687cd68a8e037b26680e0f23"}, nil)
+	prov := &fakes.Provider{}
+	prov.ContextCredentialsFactoryReturns(ccf, nil)
+	prov.OpenSessionReturns(&fake.FakeSession{}, nil)
+	cloudProvider, err := NewIBMCloudStorageProvider(filepath.Join(testFixtures, "slconfig.toml"), prov, logger)
+	assert.Nil(t, err)
+
+	session, err := cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.NotNil(t, session)
+	accountID, apiKey, _ := ccf.ForIAMAPIKeyArgsForCall(0)
+	assert.Equal(t, "t242f140687cd68a8e037b26680e0f23", accountID)
+	assert.Equal(t, "api-key", apiKey)
+	_, contextCredentials, _ := prov.OpenSessionArgsForCall(0)
+	assert.Equal(t, provider.IAMAPIKey, contextCredentials.AuthType)
+
+	// Session open failure
+	cloudProvider.InvalidateSession(session)
+	prov.OpenSessionReturns(nil, errors.New("session failed"))
+	session, err = cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.NotNil(t, err)
+	assert.Nil(t, session)
+
+	// Credentials failure
+	ccf.ForIAMAPIKeyReturns(provider.ContextCredentials{}, errors.New("credentials failed"))
+	_, err = cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.NotNil(t, err)
+}
+
+func TestProviderSessionWithFakeVPC(t *testing.T) {
+	logger, teardown := GetTestLogger(t)
+	defer teardown()
+
+	server := fakevpcserver.NewServer()
+	defer server.Close()
+	configPath := setupConfigDir(t)
+	writeFile(t, configPath, strings.Replace(readFixtureConfig(t), `g2_api_key = "api-key"`, `g2_api_key = "`+fakevpcserver.DefaultAPIKey+`"`, 1))
+	cloudProvider, err := NewIBMCloudStorageProvider(configPath, &fakeVPCProvider{server: server}, logger)
+	assert.Nil(t, err)
+
+	session, err := cloudProvider.GetProviderSession(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, server.RequestCount(fakevpcserver.RouteIAMToken))
+
+	capacity, name := 10, "pvc-e2e"
+	volume, err := session.CreateVolume(provider.Volume{Name: &name, Capacity: &capacity, Az: "us-south-1"})
+	assert.Nil(t, err)
+	found, err := session.GetVolume(volume.VolumeID)
+	assert.Nil(t, err)
+	assert.Equal(t, name, *found.Name)
+
+	// Rejected tokens open a new session
+	server.ExpireTokens()
+	err = cloudProvider.WithSession(context.Background(), logger, func(session provider.Session) error {
+		return session.DeleteVolume(volume)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, server.RequestCount(fakevpcserver.RouteIAMToken))
+	_, exists := server.Volume(volume.VolumeID)
+	assert.False(t, exists)
+}
+
+// fakeVPCProvider opens sessions creating, getting and deleting volumes of the fake VPC server with the
+// access token exchanged for the API key
+type fakeVPCProvider struct {
+	server *fakevpcserver.Server
+}
+
+// OpenSession ...
+func (prov *fakeVPCProvider) OpenSession(ctx context.Context, contextCredentials provider.ContextCredentials, logger *zap.Logger) (provider.Session, error) {
+	accessToken := contextCredentials.Credential
+	if contextCredentials.AuthType == provider.IAMAPIKey {
+		var err error
+		if accessToken, _, err = iamtoken.ExchangeAPIKey(ctx, nil, prov.server.URL, contextCredentials.Credential, logger); err != nil {
+			return nil, err
+		}
+	}
+	return &fakeVPCSession{FakeSession: &fake.FakeSession{}, ctx: ctx, url: prov.server.URL, accessToken: accessToken}, nil
+}
+
+// ContextCredentialsFactory ...
+func (prov *fakeVPCProvider) ContextCredentialsFactory(datacenter *string) (local.ContextCredentialsFactory, error) {
+	return &fakes.ContextCredentialsFactory{ForIAMAPIKeyStub: func(iamAccountID, iamAPIKey string, logger *zap.Logger) (provider.ContextCredentials, error) {
+		return provider.ContextCredentials{AuthType: provider.IAMAPIKey, IAMAccountID: iamAccountID, Credential: iamAPIKey}, nil
+	}}, nil
+}
+
+// fakeVPCSession ...
+type fakeVPCSession struct {
+	*fake.FakeSession
+	ctx         context.Context
+	url         string
+	accessToken string
+}
+
+// CreateVolume ...
+func (session *fakeVPCSession) CreateVolume(volumeRequest provider.Volume) (*provider.Volume, error) {
+	request := &fakevpcserver.VolumeRequest{Capacity: int64(*volumeRequest.Capacity), Zone: &fakevpcserver.Reference{Name: volumeRequest.Az}}
+	if volumeRequest.Name != nil {
+		request.Name = *volumeRequest.Name
+	}
+	volume := &fakevpcserver.Volume{}
+	if err := session.do(http.MethodPost, "/v1/volumes", request, volume); err != nil {
+		return nil, err
+	}
+	return toTestVolume(volume), nil
+}
+
+// GetVolume ...
+func (session *fakeVPCSession) GetVolume(id string) (*provider.Volume, error) {
+	volume := &fakevpcserver.Volume{}
+	if err := session.do(http.MethodGet, "/v1/volumes/"+id, nil, volume); err != nil {
+		return nil, err
+	}
+	return toTestVolume(volume), nil
+}
+
+// DeleteVolume ...
+func (session *fakeVPCSession) DeleteVolume(volume *provider.Volume) error {
+	return session.do(http.MethodDelete, "/v1/volumes/"+volume.VolumeID, nil, nil)
+}
+
+// do sends the request with the context of the session, rejected tokens are ErrorUnauthorised provider errors
+func (session *fakeVPCSession) do(method string, path string, body interface{}, response interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(session.ctx, method, session.url+path, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+session.accessToken)
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return util.NewError(reasoncode.ErrorUnauthorised, "access token rejected")
+	case resp.StatusCode >= http.StatusBadRequest:
+		return fmt.Errorf("%s %s failed with status %d", method, path, resp.StatusCode)
+	case response != nil:
+		return json.NewDecoder(resp.Body).Decode(response)
+	}
+	return nil
+}
+
+// toTestVolume ...
+func toTestVolume(volume *fakevpcserver.Volume) *provider.Volume {
+	capacity := int(volume.Capacity)
+	return &provider.Volume{VolumeID: volume.ID, Name: &volume.Name, Capacity: &capacity}
+}
@@ -341,6 +341,72 @@ var messagesEn = map[string]Message{
 		Type:        codes.FailedPrecondition,
 		Action:      "Please check if the property 'vpc_subnet_ids' contains valid subnetIds. Please check 'kubectl get configmap ibm-cloud-provider-data -n kube-system -o yaml'.Please check 'BackendError' tag for more details",
 	},
+	NoProviderEnabled: {
+		Code:        NoProviderEnabled,
+		Description: "Neither the VPC nor the IKS provider is enabled in the storage configuration",
+		Type:        codes.FailedPrecondition,
+		Action:      "Please set 'vpc_enabled' or 'iks_enabled' to true in slclient.toml of the 'storage-secret-store' secret",
+	},
+	MissingProviderName: {
+		Code:        MissingProviderName,
+		Description: "The provider name '%s' is not set in the storage configuration",
+		Type:        codes.FailedPrecondition,
+		Action:      "Please set the block provider name of the enabled provider in slclient.toml of the 'storage-secret-store' secret",
+	},
+	InvalidProviderType: {
+		Code:        InvalidProviderType,
+		Description: "The provider type '%s' in the storage configuration is not supported",
+		Type:        codes.FailedPrecondition,
+		Action:      "Please set 'provider_type' to 'g2' or 'gc' in slclient.toml of the 'storage-secret-store' secret",
+	},
+	MissingAPIKey: {
+		Code:        MissingAPIKey,
+		Description: "The API key '%s' is not set in the storage configuration",
+		Type:        codes.FailedPrecondition,
+		Action:      "Please set a valid IBM Cloud API key in slclient.toml of the 'storage-secret-store' secret. Run 'ibmcloud ks api-key info --cluster <cluster>' to verify the API key of the cluster",
+	},
+	MissingEndpointURL: {
+		Code:        MissingEndpointURL,
+		Description: "The endpoint URL '%s' is not set in the storage configuration",
+		Type:        codes.FailedPrecondition,
+		Action:      "Please set the VPC endpoint URL of the cluster region in slclient.toml of the 'storage-secret-store' secret",
+	},
+	InvalidEndpointURL: {
+		Code:        InvalidEndpointURL,
+		Description: "The endpoint URL '%s' value '%s' in the storage configuration is not a valid http or https URL",
+		Type:        codes.FailedPrecondition,
+		Action:      "Please correct the endpoint URL in slclient.toml of the 'storage-secret-store' secret, i.e 'https://us-south.iaas.cloud.ibm.com'",
+	},
+	InvalidAPITimeout: {
+		Code:        InvalidAPITimeout,
+		Description: "The API timeout 'vpc_api_timeout' value '%s' in the storage configuration is not a positive duration",
+		Type:        codes.FailedPrecondition,
+		Action:      "Please set 'vpc_api_timeout' to a duration with unit i.e '120s' in slclient.toml of the 'storage-secret-store' secret",
+	},
+	InvalidAPIVersion: {
+		Code:        InvalidAPIVersion,
+		Description: "The API version '%s' value '%s' in the storage configuration is not a date",
+		Type:        codes.FailedPrecondition,
+		Action:      "Please set the API version in the YYYY-MM-DD format i.e '2020-07-02' in slclient.toml of the 'storage-secret-store' secret",
+	},
+	InvalidRetryConfig: {
+		Code:        InvalidRetryConfig,
+		Description: "The retry setting '%s' value '%d' in the storage configuration is negative",
+		Type:        codes.FailedPrecondition,
+		Action:      "Please set the retry settings to zero or positive values in slclient.toml of the 'storage-secret-store' secret",
+	},
+	InvalidAuthType: {
+		Code:        InvalidAuthType,
+		Description: "The IAM authentication type '%s' in the storage configuration is not supported",
+		Type:        codes.FailedPrecondition,
+		Action:      "Please set iam_auth_type to 'api-key' or 'trusted-profile' in slclient.toml of the 'storage-secret-store' secret",
+	},
+	MissingTrustedProfile: {
+		Code:        MissingTrustedProfile,
+		Description: "The trusted profile '%s' is not set in the storage configuration",
+		Type:        codes.FailedPrecondition,
+		Action:      "Please set iam_profile_id to the ID of an IAM trusted profile trusting the cluster service account in slclient.toml of the 'storage-secret-store' secret",
+	},
 }
 
 // InitMessages ...
@@ -176,4 +176,37 @@ const (
 
 	// SubnetFindFailed ...
 	SubnetFindFailed = "SubnetFindFailed"
+
+	// NoProviderEnabled ...
+	NoProviderEnabled = "NoProviderEnabled"
+
+	// MissingProviderName ...
+	MissingProviderName = "MissingProviderName"
+
+	// InvalidProviderType ...
+	InvalidProviderType = "InvalidProviderType"
+
+	// MissingAPIKey ...
+	MissingAPIKey = "MissingAPIKey"
+
+	// MissingEndpointURL ...
+	MissingEndpointURL = "MissingEndpointURL"
+
+	// InvalidEndpointURL ...
+	InvalidEndpointURL = "InvalidEndpointURL"
+
+	// InvalidAPITimeout ...
+	InvalidAPITimeout = "InvalidAPITimeout"
+
+	// InvalidAPIVersion ...
+	InvalidAPIVersion = "InvalidAPIVersion"
+
+	// InvalidRetryConfig ...
+	InvalidRetryConfig = "InvalidRetryConfig"
+
+	// InvalidAuthType ...
+	InvalidAuthType = "InvalidAuthType"
+
+	// MissingTrustedProfile ...
+	MissingTrustedProfile = "MissingTrustedProfile"
 )
@@ -0,0 +1,94 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+)
+
+// AccountIDSource is where the account ID of a node was read from
+type AccountIDSource string
+
+const (
+	// AccountIDFromProviderID account ID is part of node.Spec.ProviderID, managed and IPI clusters
+	AccountIDFromProviderID AccountIDSource = "provider-id"
+
+	// AccountIDFromLabel account ID is set as node label
+	AccountIDFromLabel AccountIDSource = "label"
+
+	// AccountIDFromAnnotation account ID is set as node annotation
+	AccountIDFromAnnotation AccountIDSource = "annotation"
+
+	// AccountIDFromClusterInfo account ID is read from the cluster info file
+	AccountIDFromClusterInfo AccountIDSource = "cluster-info"
+
+	// AccountIDFromEnv account ID is read from the IBMCLOUD_ACCOUNT_ID environment variable
+	AccountIDFromEnv AccountIDSource = "env"
+
+	// AccountIDFromCRN account ID is part of the instance CRN read from the VPC instance metadata service
+	AccountIDFromCRN AccountIDSource = "instance-crn"
+)
+
+// accountIDRegex account IDs are alphanumeric
+var accountIDRegex = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// validateAccountID checks the account ID read from any of the sources
+func validateAccountID(accountID string, source AccountIDSource) error {
+	if !accountIDRegex.MatchString(accountID) {
+		return fmt.Errorf("Invalid account ID '%s' found in %s, account ID must be alphanumeric", accountID, source)
+	}
+	return nil
+}
+
+// resolveSatelliteAccountID finds the account ID of a satellite (UPI) node. The sources are read in below order
+// and the first one which is set wins:
+//  1. node label ibm-cloud.kubernetes.io/account-id
+//  2. node annotation ibm-cloud.kubernetes.io/account-id
+//  3. account_id in the cluster info file
+//  4. IBMCLOUD_ACCOUNT_ID environment variable
+//
+// An empty account ID is returned if none of the sources are set.
+func resolveSatelliteAccountID(node *v1.Node, clusterInfoPath string, logger *zap.Logger) (string, AccountIDSource, error) {
+	if accountID := node.Labels[utils.AccountIDLabel]; accountID != "" {
+		return accountID, AccountIDFromLabel, validateAccountID(accountID, AccountIDFromLabel)
+	}
+	if accountID := node.Annotations[utils.AccountIDLabel]; accountID != "" {
+		return accountID, AccountIDFromAnnotation, validateAccountID(accountID, AccountIDFromAnnotation)
+	}
+
+	clusterInfo, err := utils.ReadClusterInfo(clusterInfoPath)
+	if err != nil {
+		// cluster info is optional for satellite nodes
+		if !os.IsNotExist(err) {
+			logger.Warn("Unable to read account ID from cluster info", zap.String("path", clusterInfoPath), zap.Error(err))
+		}
+	} else if clusterInfo.AccountID != "" {
+		return clusterInfo.AccountID, AccountIDFromClusterInfo, validateAccountID(clusterInfo.AccountID, AccountIDFromClusterInfo)
+	}
+
+	if accountID := os.Getenv(utils.AccountIDEnv); accountID != "" {
+		return accountID, AccountIDFromEnv, validateAccountID(accountID, AccountIDFromEnv)
+	}
+	return "", "", nil
+}
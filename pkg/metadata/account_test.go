@@ -0,0 +1,143 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const fixtureAccountID = "t242f140687cd68a8e037b26680e0f23"
+
+func TestSatelliteAccountID(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	validClusterInfo := utils.GetClusterInfoPath(filepath.Join("..", "..", "test-fixtures", "valid"))
+	invalidClusterInfo := utils.GetClusterInfoPath(filepath.Join("..", "..", "test-fixtures", "invalid"))
+	missingClusterInfo := utils.GetClusterInfoPath(filepath.Join("..", "..", "test-fixtures", "missing"))
+
+	testCases := []struct {
+		testCaseName      string
+		labels            map[string]string
+		annotations       map[string]string
+		clusterInfoPath   string
+		env               string
+		expectedAccountID string
+		expectedErr       bool
+	}{
+		{
+			testCaseName:      "Label wins over all other sources",
+			labels:            map[string]string{utils.AccountIDLabel: "labelaccount"},
+			annotations:       map[string]string{utils.AccountIDLabel: "annotationaccount"},
+			clusterInfoPath:   validClusterInfo,
+			env:               "envaccount",
+			expectedAccountID: "labelaccount",
+		},
+		{
+			testCaseName:      "Annotation wins over cluster info and env",
+			annotations:       map[string]string{utils.AccountIDLabel: "annotationaccount"},
+			clusterInfoPath:   validClusterInfo,
+			env:               "envaccount",
+			expectedAccountID: "annotationaccount",
+		},
+		{
+			testCaseName:      "Cluster info wins over env",
+			clusterInfoPath:   validClusterInfo,
+			env:               "envaccount",
+			expectedAccountID: fixtureAccountID,
+		},
+		{
+			testCaseName:      "Unparsable cluster info falls back to env",
+			clusterInfoPath:   invalidClusterInfo,
+			env:               "envaccount",
+			expectedAccountID: "envaccount",
+		},
+		{
+			testCaseName:      "Missing cluster info falls back to env",
+			clusterInfoPath:   missingClusterInfo,
+			env:               "envaccount",
+			expectedAccountID: "envaccount",
+		},
+		{
+			testCaseName:      "No source is set",
+			clusterInfoPath:   missingClusterInfo,
+			expectedAccountID: "",
+		},
+		{
+			testCaseName:    "Invalid account ID in label",
+			labels:          map[string]string{utils.AccountIDLabel: "invalid_account"},
+			clusterInfoPath: validClusterInfo,
+			expectedErr:     true,
+		},
+		{
+			testCaseName:    "Invalid account ID in env",
+			clusterInfoPath: missingClusterInfo,
+			env:             "invalid account",
+			expectedErr:     true,
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			t.Setenv(utils.AccountIDEnv, testcase.env)
+			labels := map[string]string{
+				utils.NodeZoneLabel:       "myzone",
+				utils.NodeRegionLabel:     "myregion",
+				utils.MachineTypeLabel:    utils.UPI,
+				utils.NodeInstanceIDLabel: "myinstanceid",
+			}
+			for key, value := range testcase.labels {
+				labels[key] = value
+			}
+			clientset := fake.NewSimpleClientset(&v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: labels, Annotations: testcase.annotations},
+			})
+			nodeInfo := NodeInfoManager{NodeName: "mynode", KubeClient: clientset, ClusterInfoPath: testcase.clusterInfoPath}
+			nodeMeta, err := nodeInfo.NewNodeMetadata(logger)
+			if testcase.expectedErr {
+				assert.NotNil(t, err)
+				assert.Nil(t, nodeMeta)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "myinstanceid", nodeMeta.GetWorkerID())
+			assert.Equal(t, testcase.expectedAccountID, nodeMeta.GetAccountID())
+		})
+	}
+}
+
+func TestProviderIDAccountIDValidation(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	clientset := fake.NewSimpleClientset(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: map[string]string{utils.NodeZoneLabel: "myzone", utils.NodeRegionLabel: "myregion"}},
+		Spec:       v1.NodeSpec{ProviderID: "ibm://invalid-account///myclusterid/myworkerid"},
+	})
+	nodeInfo := NodeInfoManager{NodeName: "mynode", KubeClient: clientset}
+	nodeMeta, err := nodeInfo.NewNodeMetadata(logger)
+	assert.NotNil(t, err)
+	assert.Nil(t, nodeMeta)
+}
@@ -0,0 +1,78 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxAttachableVolumes is the number of data volumes, boot volume excluded, attachable to an instance
+// whose profile is not part of the attach limit table
+const DefaultMaxAttachableVolumes int64 = 12
+
+// profileAttachLimits is the built-in table of data volume attach limits keyed by instance profile.
+// NodeInfoManager.AttachLimits entries take precedence over this table.
+var profileAttachLimits = map[string]int64{
+	"bx2-2x8":   12,
+	"bx2-4x16":  12,
+	"bx2-8x32":  12,
+	"bx2-16x64": 12,
+	"cx2-2x4":   12,
+	"cx2-4x8":   12,
+	"cx2-8x16":  12,
+	"mx2-2x16":  12,
+	"mx2-4x32":  12,
+	"mx2-8x64":  12,
+}
+
+// normalizeProfile converts worker flavors (bx2.4x16) to VPC profile names (bx2-4x16)
+func normalizeProfile(profile string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(profile)), ".", "-")
+}
+
+// NormalizeAttachLimits returns the attach limit overrides keyed by VPC profile name. Profiles given twice,
+// i.e as worker flavor and as profile name, and limits which are not positive are rejected.
+func NormalizeAttachLimits(overrides map[string]int64) (map[string]int64, error) {
+	normalized := make(map[string]int64, len(overrides))
+	for profile, limit := range overrides {
+		if limit <= 0 {
+			return nil, fmt.Errorf("Invalid attach limit %d of instance profile '%s', the limit must be positive", limit, profile)
+		}
+		key := normalizeProfile(profile)
+		if _, ok := normalized[key]; ok {
+			return nil, fmt.Errorf("Attach limit of instance profile '%s' is set more than once", key)
+		}
+		normalized[key] = limit
+	}
+	return normalized, nil
+}
+
+// GetMaxAttachableVolumes returns the number of data volumes attachable to an instance of the given profile.
+// The overrides, normalized by NormalizeAttachLimits, are looked up first, then the built-in table,
+// DefaultMaxAttachableVolumes if the profile is unknown.
+func GetMaxAttachableVolumes(profile string, overrides map[string]int64) int64 {
+	profile = normalizeProfile(profile)
+	if limit, ok := overrides[profile]; ok {
+		return limit
+	}
+	if limit, ok := profileAttachLimits[profile]; ok {
+		return limit
+	}
+	return DefaultMaxAttachableVolumes
+}
@@ -0,0 +1,88 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"testing"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetMaxAttachableVolumes(t *testing.T) {
+	testCases := []struct {
+		testCaseName  string
+		profile       string
+		overrides     map[string]int64
+		expectedLimit int64
+		expectedErr   bool
+	}{
+		{testCaseName: "Profile without override", profile: "bx2-4x16", overrides: map[string]int64{"mx2-8x64": 8}, expectedLimit: 12},
+		{testCaseName: "Profile not in table", profile: "gx3-16x80x1l4", expectedLimit: DefaultMaxAttachableVolumes},
+		{testCaseName: "Empty profile", profile: "", expectedLimit: DefaultMaxAttachableVolumes},
+		{testCaseName: "Override", profile: "bx2-4x16", overrides: map[string]int64{"bx2-4x16": 4}, expectedLimit: 4},
+		{testCaseName: "Override in worker flavor format", profile: "BX2.4x16", overrides: map[string]int64{"bx2-4x16": 4}, expectedLimit: 4},
+		{testCaseName: "Override of flavor in worker format", profile: "bx2-4x16", overrides: map[string]int64{"bx2.4x16": 4}, expectedLimit: 4},
+		{testCaseName: "Override of profile not in table", profile: "gx3-16x80x1l4", overrides: map[string]int64{"gx3-16x80x1l4": 6}, expectedLimit: 6},
+		{testCaseName: "Invalid override", profile: "bx2-4x16", overrides: map[string]int64{"bx2-4x16": 0}, expectedErr: true},
+		{testCaseName: "Duplicate override", profile: "bx2-4x16", overrides: map[string]int64{"bx2-4x16": 4, "bx2.4x16": 8}, expectedErr: true},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			overrides, err := NormalizeAttachLimits(testcase.overrides)
+			if testcase.expectedErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testcase.expectedLimit, GetMaxAttachableVolumes(testcase.profile, overrides))
+		})
+	}
+}
+
+func TestNewNodeMetadataExtendedFields(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	clientset := fake.NewSimpleClientset(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: map[string]string{
+			utils.TopologyZoneLabel:   "myzone",
+			utils.TopologyRegionLabel: "myregion",
+			utils.InstanceTypeLabel:   "mx2.8x64",
+			utils.VPCIDLabel:          "myvpcid",
+			utils.WorkerPoolLabel:     "default",
+		}},
+		Spec: v1.NodeSpec{ProviderID: testProviderID},
+	})
+	nodeInfo := NodeInfoManager{NodeName: "mynode", KubeClient: clientset, AttachLimits: map[string]int64{"mx2-8x64": 8}}
+	nodeMeta, err := nodeInfo.NewNodeMetadata(logger)
+	assert.Nil(t, err)
+	assert.Equal(t, "mx2.8x64", nodeMeta.GetInstanceProfile())
+	assert.Equal(t, "myvpcid", nodeMeta.GetVPCID())
+	assert.Equal(t, "default", nodeMeta.GetWorkerPool())
+	assert.Equal(t, int64(8), nodeMeta.GetMaxAttachableVolumes())
+
+	// Duplicate overrides are rejected
+	nodeInfo.AttachLimits["mx2.8x64"] = 4
+	_, err = nodeInfo.NewNodeMetadata(logger)
+	assert.NotNil(t, err)
+}
@@ -2,6 +2,7 @@
 package fake
 
 import (
+	"context"
 	"sync"
 
 	"github.com/IBM/ibm-csi-common/pkg/metadata"
@@ -22,6 +23,20 @@ type FakeNodeInfo struct {
 		result1 metadata.NodeMetadata
 		result2 error
 	}
+	NewNodeMetadataWithContextStub        func(context.Context, *zap.Logger) (metadata.NodeMetadata, error)
+	newNodeMetadataWithContextMutex       sync.RWMutex
+	newNodeMetadataWithContextArgsForCall []struct {
+		arg1 context.Context
+		arg2 *zap.Logger
+	}
+	newNodeMetadataWithContextReturns struct {
+		result1 metadata.NodeMetadata
+		result2 error
+	}
+	newNodeMetadataWithContextReturnsOnCall map[int]struct {
+		result1 metadata.NodeMetadata
+		result2 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -90,11 +105,78 @@ func (fake *FakeNodeInfo) NewNodeMetadataReturnsOnCall(i int, result1 metadata.N
 	}{result1, result2}
 }
 
+func (fake *FakeNodeInfo) NewNodeMetadataWithContext(arg1 context.Context, arg2 *zap.Logger) (metadata.NodeMetadata, error) {
+	fake.newNodeMetadataWithContextMutex.Lock()
+	ret, specificReturn := fake.newNodeMetadataWithContextReturnsOnCall[len(fake.newNodeMetadataWithContextArgsForCall)]
+	fake.newNodeMetadataWithContextArgsForCall = append(fake.newNodeMetadataWithContextArgsForCall, struct {
+		arg1 context.Context
+		arg2 *zap.Logger
+	}{arg1, arg2})
+	stub := fake.NewNodeMetadataWithContextStub
+	fakeReturns := fake.newNodeMetadataWithContextReturns
+	fake.recordInvocation("NewNodeMetadataWithContext", []interface{}{arg1, arg2})
+	fake.newNodeMetadataWithContextMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeNodeInfo) NewNodeMetadataWithContextCallCount() int {
+	fake.newNodeMetadataWithContextMutex.RLock()
+	defer fake.newNodeMetadataWithContextMutex.RUnlock()
+	return len(fake.newNodeMetadataWithContextArgsForCall)
+}
+
+func (fake *FakeNodeInfo) NewNodeMetadataWithContextCalls(stub func(context.Context, *zap.Logger) (metadata.NodeMetadata, error)) {
+	fake.newNodeMetadataWithContextMutex.Lock()
+	defer fake.newNodeMetadataWithContextMutex.Unlock()
+	fake.NewNodeMetadataWithContextStub = stub
+}
+
+func (fake *FakeNodeInfo) NewNodeMetadataWithContextArgsForCall(i int) (context.Context, *zap.Logger) {
+	fake.newNodeMetadataWithContextMutex.RLock()
+	defer fake.newNodeMetadataWithContextMutex.RUnlock()
+	argsForCall := fake.newNodeMetadataWithContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeNodeInfo) NewNodeMetadataWithContextReturns(result1 metadata.NodeMetadata, result2 error) {
+	fake.newNodeMetadataWithContextMutex.Lock()
+	defer fake.newNodeMetadataWithContextMutex.Unlock()
+	fake.NewNodeMetadataWithContextStub = nil
+	fake.newNodeMetadataWithContextReturns = struct {
+		result1 metadata.NodeMetadata
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeNodeInfo) NewNodeMetadataWithContextReturnsOnCall(i int, result1 metadata.NodeMetadata, result2 error) {
+	fake.newNodeMetadataWithContextMutex.Lock()
+	defer fake.newNodeMetadataWithContextMutex.Unlock()
+	fake.NewNodeMetadataWithContextStub = nil
+	if fake.newNodeMetadataWithContextReturnsOnCall == nil {
+		fake.newNodeMetadataWithContextReturnsOnCall = make(map[int]struct {
+			result1 metadata.NodeMetadata
+			result2 error
+		})
+	}
+	fake.newNodeMetadataWithContextReturnsOnCall[i] = struct {
+		result1 metadata.NodeMetadata
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeNodeInfo) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
 	fake.newNodeMetadataMutex.RLock()
 	defer fake.newNodeMetadataMutex.RUnlock()
+	fake.newNodeMetadataWithContextMutex.RLock()
+	defer fake.newNodeMetadataWithContextMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
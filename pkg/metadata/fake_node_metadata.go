@@ -16,6 +16,26 @@ type FakeNodeMetadata struct {
 	getAccountIDReturnsOnCall map[int]struct {
 		result1 string
 	}
+	GetInstanceProfileStub        func() string
+	getInstanceProfileMutex       sync.RWMutex
+	getInstanceProfileArgsForCall []struct {
+	}
+	getInstanceProfileReturns struct {
+		result1 string
+	}
+	getInstanceProfileReturnsOnCall map[int]struct {
+		result1 string
+	}
+	GetMaxAttachableVolumesStub        func() int64
+	getMaxAttachableVolumesMutex       sync.RWMutex
+	getMaxAttachableVolumesArgsForCall []struct {
+	}
+	getMaxAttachableVolumesReturns struct {
+		result1 int64
+	}
+	getMaxAttachableVolumesReturnsOnCall map[int]struct {
+		result1 int64
+	}
 	GetRegionStub        func() string
 	getRegionMutex       sync.RWMutex
 	getRegionArgsForCall []struct {
@@ -26,6 +46,16 @@ type FakeNodeMetadata struct {
 	getRegionReturnsOnCall map[int]struct {
 		result1 string
 	}
+	GetVPCIDStub        func() string
+	getVPCIDMutex       sync.RWMutex
+	getVPCIDArgsForCall []struct {
+	}
+	getVPCIDReturns struct {
+		result1 string
+	}
+	getVPCIDReturnsOnCall map[int]struct {
+		result1 string
+	}
 	GetWorkerIDStub        func() string
 	getWorkerIDMutex       sync.RWMutex
 	getWorkerIDArgsForCall []struct {
@@ -36,6 +66,16 @@ type FakeNodeMetadata struct {
 	getWorkerIDReturnsOnCall map[int]struct {
 		result1 string
 	}
+	GetWorkerPoolStub        func() string
+	getWorkerPoolMutex       sync.RWMutex
+	getWorkerPoolArgsForCall []struct {
+	}
+	getWorkerPoolReturns struct {
+		result1 string
+	}
+	getWorkerPoolReturnsOnCall map[int]struct {
+		result1 string
+	}
 	GetZoneStub        func() string
 	getZoneMutex       sync.RWMutex
 	getZoneArgsForCall []struct {
@@ -103,6 +143,112 @@ func (fake *FakeNodeMetadata) GetAccountIDReturnsOnCall(i int, result1 string) {
 	}{result1}
 }
 
+func (fake *FakeNodeMetadata) GetInstanceProfile() string {
+	fake.getInstanceProfileMutex.Lock()
+	ret, specificReturn := fake.getInstanceProfileReturnsOnCall[len(fake.getInstanceProfileArgsForCall)]
+	fake.getInstanceProfileArgsForCall = append(fake.getInstanceProfileArgsForCall, struct {
+	}{})
+	stub := fake.GetInstanceProfileStub
+	fakeReturns := fake.getInstanceProfileReturns
+	fake.recordInvocation("GetInstanceProfile", []interface{}{})
+	fake.getInstanceProfileMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeNodeMetadata) GetInstanceProfileCallCount() int {
+	fake.getInstanceProfileMutex.RLock()
+	defer fake.getInstanceProfileMutex.RUnlock()
+	return len(fake.getInstanceProfileArgsForCall)
+}
+
+func (fake *FakeNodeMetadata) GetInstanceProfileCalls(stub func() string) {
+	fake.getInstanceProfileMutex.Lock()
+	defer fake.getInstanceProfileMutex.Unlock()
+	fake.GetInstanceProfileStub = stub
+}
+
+func (fake *FakeNodeMetadata) GetInstanceProfileReturns(result1 string) {
+	fake.getInstanceProfileMutex.Lock()
+	defer fake.getInstanceProfileMutex.Unlock()
+	fake.GetInstanceProfileStub = nil
+	fake.getInstanceProfileReturns = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *FakeNodeMetadata) GetInstanceProfileReturnsOnCall(i int, result1 string) {
+	fake.getInstanceProfileMutex.Lock()
+	defer fake.getInstanceProfileMutex.Unlock()
+	fake.GetInstanceProfileStub = nil
+	if fake.getInstanceProfileReturnsOnCall == nil {
+		fake.getInstanceProfileReturnsOnCall = make(map[int]struct {
+			result1 string
+		})
+	}
+	fake.getInstanceProfileReturnsOnCall[i] = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *FakeNodeMetadata) GetMaxAttachableVolumes() int64 {
+	fake.getMaxAttachableVolumesMutex.Lock()
+	ret, specificReturn := fake.getMaxAttachableVolumesReturnsOnCall[len(fake.getMaxAttachableVolumesArgsForCall)]
+	fake.getMaxAttachableVolumesArgsForCall = append(fake.getMaxAttachableVolumesArgsForCall, struct {
+	}{})
+	stub := fake.GetMaxAttachableVolumesStub
+	fakeReturns := fake.getMaxAttachableVolumesReturns
+	fake.recordInvocation("GetMaxAttachableVolumes", []interface{}{})
+	fake.getMaxAttachableVolumesMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeNodeMetadata) GetMaxAttachableVolumesCallCount() int {
+	fake.getMaxAttachableVolumesMutex.RLock()
+	defer fake.getMaxAttachableVolumesMutex.RUnlock()
+	return len(fake.getMaxAttachableVolumesArgsForCall)
+}
+
+func (fake *FakeNodeMetadata) GetMaxAttachableVolumesCalls(stub func() int64) {
+	fake.getMaxAttachableVolumesMutex.Lock()
+	defer fake.getMaxAttachableVolumesMutex.Unlock()
+	fake.GetMaxAttachableVolumesStub = stub
+}
+
+func (fake *FakeNodeMetadata) GetMaxAttachableVolumesReturns(result1 int64) {
+	fake.getMaxAttachableVolumesMutex.Lock()
+	defer fake.getMaxAttachableVolumesMutex.Unlock()
+	fake.GetMaxAttachableVolumesStub = nil
+	fake.getMaxAttachableVolumesReturns = struct {
+		result1 int64
+	}{result1}
+}
+
+func (fake *FakeNodeMetadata) GetMaxAttachableVolumesReturnsOnCall(i int, result1 int64) {
+	fake.getMaxAttachableVolumesMutex.Lock()
+	defer fake.getMaxAttachableVolumesMutex.Unlock()
+	fake.GetMaxAttachableVolumesStub = nil
+	if fake.getMaxAttachableVolumesReturnsOnCall == nil {
+		fake.getMaxAttachableVolumesReturnsOnCall = make(map[int]struct {
+			result1 int64
+		})
+	}
+	fake.getMaxAttachableVolumesReturnsOnCall[i] = struct {
+		result1 int64
+	}{result1}
+}
+
 func (fake *FakeNodeMetadata) GetRegion() string {
 	fake.getRegionMutex.Lock()
 	ret, specificReturn := fake.getRegionReturnsOnCall[len(fake.getRegionArgsForCall)]
@@ -156,6 +302,59 @@ func (fake *FakeNodeMetadata) GetRegionReturnsOnCall(i int, result1 string) {
 	}{result1}
 }
 
+func (fake *FakeNodeMetadata) GetVPCID() string {
+	fake.getVPCIDMutex.Lock()
+	ret, specificReturn := fake.getVPCIDReturnsOnCall[len(fake.getVPCIDArgsForCall)]
+	fake.getVPCIDArgsForCall = append(fake.getVPCIDArgsForCall, struct {
+	}{})
+	stub := fake.GetVPCIDStub
+	fakeReturns := fake.getVPCIDReturns
+	fake.recordInvocation("GetVPCID", []interface{}{})
+	fake.getVPCIDMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeNodeMetadata) GetVPCIDCallCount() int {
+	fake.getVPCIDMutex.RLock()
+	defer fake.getVPCIDMutex.RUnlock()
+	return len(fake.getVPCIDArgsForCall)
+}
+
+func (fake *FakeNodeMetadata) GetVPCIDCalls(stub func() string) {
+	fake.getVPCIDMutex.Lock()
+	defer fake.getVPCIDMutex.Unlock()
+	fake.GetVPCIDStub = stub
+}
+
+func (fake *FakeNodeMetadata) GetVPCIDReturns(result1 string) {
+	fake.getVPCIDMutex.Lock()
+	defer fake.getVPCIDMutex.Unlock()
+	fake.GetVPCIDStub = nil
+	fake.getVPCIDReturns = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *FakeNodeMetadata) GetVPCIDReturnsOnCall(i int, result1 string) {
+	fake.getVPCIDMutex.Lock()
+	defer fake.getVPCIDMutex.Unlock()
+	fake.GetVPCIDStub = nil
+	if fake.getVPCIDReturnsOnCall == nil {
+		fake.getVPCIDReturnsOnCall = make(map[int]struct {
+			result1 string
+		})
+	}
+	fake.getVPCIDReturnsOnCall[i] = struct {
+		result1 string
+	}{result1}
+}
+
 func (fake *FakeNodeMetadata) GetWorkerID() string {
 	fake.getWorkerIDMutex.Lock()
 	ret, specificReturn := fake.getWorkerIDReturnsOnCall[len(fake.getWorkerIDArgsForCall)]
@@ -209,6 +408,59 @@ func (fake *FakeNodeMetadata) GetWorkerIDReturnsOnCall(i int, result1 string) {
 	}{result1}
 }
 
+func (fake *FakeNodeMetadata) GetWorkerPool() string {
+	fake.getWorkerPoolMutex.Lock()
+	ret, specificReturn := fake.getWorkerPoolReturnsOnCall[len(fake.getWorkerPoolArgsForCall)]
+	fake.getWorkerPoolArgsForCall = append(fake.getWorkerPoolArgsForCall, struct {
+	}{})
+	stub := fake.GetWorkerPoolStub
+	fakeReturns := fake.getWorkerPoolReturns
+	fake.recordInvocation("GetWorkerPool", []interface{}{})
+	fake.getWorkerPoolMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeNodeMetadata) GetWorkerPoolCallCount() int {
+	fake.getWorkerPoolMutex.RLock()
+	defer fake.getWorkerPoolMutex.RUnlock()
+	return len(fake.getWorkerPoolArgsForCall)
+}
+
+func (fake *FakeNodeMetadata) GetWorkerPoolCalls(stub func() string) {
+	fake.getWorkerPoolMutex.Lock()
+	defer fake.getWorkerPoolMutex.Unlock()
+	fake.GetWorkerPoolStub = stub
+}
+
+func (fake *FakeNodeMetadata) GetWorkerPoolReturns(result1 string) {
+	fake.getWorkerPoolMutex.Lock()
+	defer fake.getWorkerPoolMutex.Unlock()
+	fake.GetWorkerPoolStub = nil
+	fake.getWorkerPoolReturns = struct {
+		result1 string
+	}{result1}
+}
+
+func (fake *FakeNodeMetadata) GetWorkerPoolReturnsOnCall(i int, result1 string) {
+	fake.getWorkerPoolMutex.Lock()
+	defer fake.getWorkerPoolMutex.Unlock()
+	fake.GetWorkerPoolStub = nil
+	if fake.getWorkerPoolReturnsOnCall == nil {
+		fake.getWorkerPoolReturnsOnCall = make(map[int]struct {
+			result1 string
+		})
+	}
+	fake.getWorkerPoolReturnsOnCall[i] = struct {
+		result1 string
+	}{result1}
+}
+
 func (fake *FakeNodeMetadata) GetZone() string {
 	fake.getZoneMutex.Lock()
 	ret, specificReturn := fake.getZoneReturnsOnCall[len(fake.getZoneArgsForCall)]
@@ -267,10 +519,18 @@ func (fake *FakeNodeMetadata) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.getAccountIDMutex.RLock()
 	defer fake.getAccountIDMutex.RUnlock()
+	fake.getInstanceProfileMutex.RLock()
+	defer fake.getInstanceProfileMutex.RUnlock()
+	fake.getMaxAttachableVolumesMutex.RLock()
+	defer fake.getMaxAttachableVolumesMutex.RUnlock()
 	fake.getRegionMutex.RLock()
 	defer fake.getRegionMutex.RUnlock()
+	fake.getVPCIDMutex.RLock()
+	defer fake.getVPCIDMutex.RUnlock()
 	fake.getWorkerIDMutex.RLock()
 	defer fake.getWorkerIDMutex.RUnlock()
+	fake.getWorkerPoolMutex.RLock()
+	defer fake.getWorkerPoolMutex.RUnlock()
 	fake.getZoneMutex.RLock()
 	defer fake.getZoneMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
@@ -22,9 +22,13 @@ import "go.uber.org/zap"
 // InitMetadata ...
 func InitMetadata(nodeName string, logger *zap.Logger) (NodeMetadata, error) {
 	return &nodeMetadataManager{
-		zone:     "testzone",
-		region:   "testregion",
-		workerID: "testworkerid",
-		accountID: "testaccountid",
+		zone:                 "testzone",
+		region:               "testregion",
+		workerID:             "testworkerid",
+		accountID:            "testaccountid",
+		instanceProfile:      "bx2-4x16",
+		vpcID:                "testvpcid",
+		workerPool:           "testworkerpool",
+		maxAttachableVolumes: DefaultMaxAttachableVolumes,
 	}, nil
 }
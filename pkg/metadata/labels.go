@@ -0,0 +1,153 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+)
+
+// LabelFamily identifies a set of well known node topology labels
+type LabelFamily string
+
+const (
+	// TopologyLabelFamily GA topology.kubernetes.io/* labels
+	TopologyLabelFamily LabelFamily = "topology"
+
+	// FailureDomainLabelFamily deprecated failure-domain.beta.kubernetes.io/* labels
+	FailureDomainLabelFamily LabelFamily = "failure-domain"
+)
+
+const (
+	// zoneKey logical name of the zone topology key
+	zoneKey = "zone"
+	// regionKey logical name of the region topology key
+	regionKey = "region"
+)
+
+// DefaultLabelPrecedence is used when NodeInfoManager has no LabelPrecedence configured.
+// GA labels win over the deprecated ones, which are still read for older clusters.
+var DefaultLabelPrecedence = []LabelFamily{TopologyLabelFamily, FailureDomainLabelFamily}
+
+// labelFamilies maps every family to its zone and region label keys
+var labelFamilies = map[LabelFamily]map[string]string{
+	TopologyLabelFamily: {
+		zoneKey:   utils.TopologyZoneLabel,
+		regionKey: utils.TopologyRegionLabel,
+	},
+	FailureDomainLabelFamily: {
+		zoneKey:   utils.NodeZoneLabel,
+		regionKey: utils.NodeRegionLabel,
+	},
+}
+
+// MissingLabelError is returned when none of the node labels for a topology key are set
+type MissingLabelError struct {
+	// Key is the logical topology key, i.e zone or region
+	Key string
+	// Labels are the node labels which were looked up, in precedence order
+	Labels []string
+}
+
+// Error ...
+func (e *MissingLabelError) Error() string {
+	return fmt.Sprintf("Required node label for %s is missing, none of [%s] is set", e.Key, strings.Join(e.Labels, ", "))
+}
+
+// LabelConflict describes two label families reporting different values for the same topology key
+type LabelConflict struct {
+	// Key is the logical topology key, i.e zone or region
+	Key string
+	// Label and Value are the ones which were selected as per the precedence
+	Label string
+	Value string
+	// ConflictingLabel and ConflictingValue are the ones which were ignored
+	ConflictingLabel string
+	ConflictingValue string
+}
+
+// String ...
+func (c LabelConflict) String() string {
+	return fmt.Sprintf("%s: %s=%q conflicts with %s=%q", c.Key, c.Label, c.Value, c.ConflictingLabel, c.ConflictingValue)
+}
+
+// TopologyLabels is the zone and region resolved from node labels
+type TopologyLabels struct {
+	Zone      string
+	Region    string
+	Conflicts []LabelConflict
+}
+
+// ResolveTopologyLabels reads the zone and region from node labels as per the given precedence.
+// The first family in the precedence which has a non empty value wins, any other family having a different
+// value is reported as a conflict. DefaultLabelPrecedence is used if precedence is empty.
+func ResolveTopologyLabels(nodeLabels map[string]string, precedence []LabelFamily) (*TopologyLabels, error) {
+	if len(precedence) == 0 {
+		precedence = DefaultLabelPrecedence
+	}
+	for _, family := range precedence {
+		if _, ok := labelFamilies[family]; !ok {
+			return nil, fmt.Errorf("Unknown node label family '%s'", family)
+		}
+	}
+
+	topology := &TopologyLabels{}
+	var err error
+	topology.Zone, err = resolveLabel(nodeLabels, precedence, zoneKey, &topology.Conflicts)
+	if err != nil {
+		return nil, err
+	}
+	topology.Region, err = resolveLabel(nodeLabels, precedence, regionKey, &topology.Conflicts)
+	if err != nil {
+		return nil, err
+	}
+	return topology, nil
+}
+
+// resolveLabel returns the value of the first label set for the key and records conflicting values
+func resolveLabel(nodeLabels map[string]string, precedence []LabelFamily, key string, conflicts *[]LabelConflict) (string, error) {
+	var selectedLabel, selectedValue string
+	lookedUp := make([]string, 0, len(precedence))
+	for _, family := range precedence {
+		label := labelFamilies[family][key]
+		lookedUp = append(lookedUp, label)
+		value := nodeLabels[label]
+		if len(value) == 0 {
+			continue
+		}
+		if len(selectedValue) == 0 {
+			selectedLabel, selectedValue = label, value
+			continue
+		}
+		if value != selectedValue {
+			*conflicts = append(*conflicts, LabelConflict{
+				Key:              key,
+				Label:            selectedLabel,
+				Value:            selectedValue,
+				ConflictingLabel: label,
+				ConflictingValue: value,
+			})
+		}
+	}
+	if len(selectedValue) == 0 {
+		return "", &MissingLabelError{Key: key, Labels: lookedUp}
+	}
+	return selectedValue, nil
+}
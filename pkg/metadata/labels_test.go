@@ -0,0 +1,176 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"testing"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testProviderID = "ibm://testaccountid///testclusterid/testworkerid"
+
+func TestResolveTopologyLabels(t *testing.T) {
+	testCases := []struct {
+		testCaseName      string
+		labels            map[string]string
+		precedence        []LabelFamily
+		expectedZone      string
+		expectedRegion    string
+		expectedConflicts int
+		expectedMissing   string
+		expectedErr       bool
+	}{
+		{
+			testCaseName:   "Only failure-domain labels",
+			labels:         map[string]string{utils.NodeZoneLabel: "us-south-1", utils.NodeRegionLabel: "us-south"},
+			expectedZone:   "us-south-1",
+			expectedRegion: "us-south",
+		},
+		{
+			testCaseName:   "Only topology labels",
+			labels:         map[string]string{utils.TopologyZoneLabel: "us-south-2", utils.TopologyRegionLabel: "us-south"},
+			expectedZone:   "us-south-2",
+			expectedRegion: "us-south",
+		},
+		{
+			testCaseName:   "Mixed label families",
+			labels:         map[string]string{utils.TopologyZoneLabel: "us-south-2", utils.NodeRegionLabel: "us-south"},
+			expectedZone:   "us-south-2",
+			expectedRegion: "us-south",
+		},
+		{
+			testCaseName:      "Conflict, default precedence prefers topology labels",
+			labels:            map[string]string{utils.TopologyZoneLabel: "us-south-2", utils.NodeZoneLabel: "us-south-1", utils.TopologyRegionLabel: "us-south", utils.NodeRegionLabel: "us-south"},
+			expectedZone:      "us-south-2",
+			expectedRegion:    "us-south",
+			expectedConflicts: 1,
+		},
+		{
+			testCaseName:      "Conflict, failure-domain labels preferred",
+			labels:            map[string]string{utils.TopologyZoneLabel: "us-south-2", utils.NodeZoneLabel: "us-south-1", utils.TopologyRegionLabel: "us-east", utils.NodeRegionLabel: "us-south"},
+			precedence:        []LabelFamily{FailureDomainLabelFamily, TopologyLabelFamily},
+			expectedZone:      "us-south-1",
+			expectedRegion:    "us-south",
+			expectedConflicts: 2,
+		},
+		{
+			testCaseName:    "Zone label missing",
+			labels:          map[string]string{utils.TopologyRegionLabel: "us-south"},
+			expectedMissing: zoneKey,
+		},
+		{
+			testCaseName:    "Region label missing",
+			labels:          map[string]string{utils.NodeZoneLabel: "us-south-1"},
+			expectedMissing: regionKey,
+		},
+		{
+			testCaseName:    "Only topology labels are read",
+			labels:          map[string]string{utils.NodeZoneLabel: "us-south-1", utils.NodeRegionLabel: "us-south"},
+			precedence:      []LabelFamily{TopologyLabelFamily},
+			expectedMissing: zoneKey,
+		},
+		{
+			testCaseName: "Unknown label family",
+			labels:       map[string]string{utils.NodeZoneLabel: "us-south-1", utils.NodeRegionLabel: "us-south"},
+			precedence:   []LabelFamily{"unknown"},
+			expectedErr:  true,
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			topology, err := ResolveTopologyLabels(testcase.labels, testcase.precedence)
+			if testcase.expectedMissing != "" {
+				missingErr, ok := err.(*MissingLabelError)
+				assert.True(t, ok)
+				assert.Equal(t, testcase.expectedMissing, missingErr.Key)
+				assert.Nil(t, topology)
+				return
+			}
+			if testcase.expectedErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testcase.expectedZone, topology.Zone)
+			assert.Equal(t, testcase.expectedRegion, topology.Region)
+			assert.Equal(t, testcase.expectedConflicts, len(topology.Conflicts))
+		})
+	}
+}
+
+func TestNewNodeMetadataTopologyLabels(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	testCases := []struct {
+		testCaseName    string
+		labels          map[string]string
+		precedence      []LabelFamily
+		expectedZone    string
+		expectedRegion  string
+		expectedMissing string
+	}{
+		{
+			testCaseName:   "Topology labels only",
+			labels:         map[string]string{utils.TopologyZoneLabel: "us-south-3", utils.TopologyRegionLabel: "us-south"},
+			expectedZone:   "us-south-3",
+			expectedRegion: "us-south",
+		},
+		{
+			testCaseName:   "Conflicting labels with failure-domain precedence",
+			labels:         map[string]string{utils.TopologyZoneLabel: "us-south-3", utils.TopologyRegionLabel: "us-south", utils.NodeZoneLabel: "us-south-1", utils.NodeRegionLabel: "us-south"},
+			precedence:     []LabelFamily{FailureDomainLabelFamily, TopologyLabelFamily},
+			expectedZone:   "us-south-1",
+			expectedRegion: "us-south",
+		},
+		{
+			testCaseName:    "Region labels missing",
+			labels:          map[string]string{utils.TopologyZoneLabel: "us-south-3"},
+			expectedMissing: regionKey,
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(&v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: testcase.labels},
+				Spec:       v1.NodeSpec{ProviderID: testProviderID},
+			})
+			nodeInfo := NodeInfoManager{NodeName: "mynode", KubeClient: clientset, LabelPrecedence: testcase.precedence}
+			nodeMeta, err := nodeInfo.NewNodeMetadata(logger)
+			if testcase.expectedMissing != "" {
+				missingErr, ok := err.(*MissingLabelError)
+				assert.True(t, ok)
+				assert.Equal(t, testcase.expectedMissing, missingErr.Key)
+				assert.Nil(t, nodeMeta)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testcase.expectedZone, nodeMeta.GetZone())
+			assert.Equal(t, testcase.expectedRegion, nodeMeta.GetRegion())
+			assert.Equal(t, "testworkerid", nodeMeta.GetWorkerID())
+			assert.Equal(t, "testaccountid", nodeMeta.GetAccountID())
+		})
+	}
+}
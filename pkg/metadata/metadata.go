@@ -20,13 +20,17 @@ package metadata
 import (
 	"context"
 	"fmt"
-	"strings"
+	"time"
 
+	"github.com/IBM/ibm-csi-common/pkg/metrics"
 	"github.com/IBM/ibm-csi-common/pkg/utils"
 	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 // NodeMetadata is a fakeable interface exposing necessary data
@@ -42,71 +46,273 @@ type NodeMetadata interface {
 
 	// GetAccountID ... get node's account ID
 	GetAccountID() string
+
+	// GetInstanceProfile ... get node's instance profile i.e bx2-4x16
+	GetInstanceProfile() string
+
+	// GetVPCID ... get node's VPC ID
+	GetVPCID() string
+
+	// GetWorkerPool ... get node's worker pool name
+	GetWorkerPool() string
+
+	// GetMaxAttachableVolumes ... get maximum number of data volumes attachable to the node
+	GetMaxAttachableVolumes() int64
 }
 
 type nodeMetadataManager struct {
-	zone     string
-	region   string
-	workerID string
-	accountID string
+	zone                 string
+	region               string
+	workerID             string
+	accountID            string
+	instanceProfile      string
+	vpcID                string
+	workerPool           string
+	maxAttachableVolumes int64
 }
 
 // NodeInfo ...
+//
 //go:generate counterfeiter -o fake/fake_node_info.go --fake-name FakeNodeInfo . NodeInfo
 type NodeInfo interface {
 	NewNodeMetadata(logger *zap.Logger) (NodeMetadata, error)
+
+	// NewNodeMetadataWithContext ... retries until ctx is done
+	NewNodeMetadataWithContext(ctx context.Context, logger *zap.Logger) (NodeMetadata, error)
+}
+
+// DefaultLookupTimeout is how long NewNodeMetadata retries the node lookup
+const DefaultLookupTimeout = time.Minute
+
+// DefaultBackoff is the retry backoff of node lookups, ~45 seconds in total
+var DefaultBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.5,
+	Steps:    8,
+	Cap:      15 * time.Second,
 }
 
+// KubeClientFactory creates the kubernetes client used to read the node object
+type KubeClientFactory func() (kubernetes.Interface, error)
+
 // NodeInfoManager ...
 type NodeInfoManager struct {
 	NodeName string
+
+	// KubeClient is used to read the node object, if nil a client is created using ClientFactory
+	KubeClient kubernetes.Interface
+
+	// ClientFactory creates the client if KubeClient is nil, if both are nil the client is built using Master and KubeConfig
+	ClientFactory KubeClientFactory
+
+	// Master and KubeConfig are used to build the client config when running out of cluster.
+	// In-cluster config is used if both are empty
+	Master     string
+	KubeConfig string
+
+	// WaitTimeout is how long the watched node metadata blocks GetWorkerID callers, DefaultWaitTimeout if zero
+	WaitTimeout time.Duration
+
+	// AttachLimits overrides the built-in attach limit table, keyed by instance profile or worker flavor
+	AttachLimits map[string]int64
+
+	// ClusterInfoPath is the cluster info file used to find the account ID of satellite nodes.
+	// Defaults to cluster_info/cluster-config.json in the SECRET_CONFIG_PATH directory
+	ClusterInfoPath string
+
+	// LabelPrecedence is the order in which zone and region label families are read, DefaultLabelPrecedence if empty
+	LabelPrecedence []LabelFamily
+
+	// Backoff is the retry backoff of node lookups, DefaultBackoff if nil
+	Backoff *wait.Backoff
+
+	// CachePath is the file where the node metadata is saved after a successful lookup, and read from
+	// when the API server is unreachable. The cache is disabled if empty
+	CachePath string
 }
 
 var _ NodeMetadata = &nodeMetadataManager{}
 
-// NewNodeMetadata ...
+// NewNodeMetadata retries the node lookup for up to DefaultLookupTimeout
 func (nodeManager *NodeInfoManager) NewNodeMetadata(logger *zap.Logger) (NodeMetadata, error) {
-	config, err := rest.InClusterConfig()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultLookupTimeout)
+	defer cancel()
+	return nodeManager.NewNodeMetadataWithContext(ctx, logger)
+}
+
+// NewNodeMetadataWithContext reads the node object, transient API server errors are retried with
+// exponential backoff until ctx is done. If the API server stays unreachable, the node metadata
+// saved in CachePath by the last successful lookup is returned.
+func (nodeManager *NodeInfoManager) NewNodeMetadataWithContext(ctx context.Context, logger *zap.Logger) (NodeMetadata, error) {
+	clientset, err := nodeManager.getKubeClient()
 	if err != nil {
+		logger.Error("Failed to create kubernetes client", zap.Error(err))
+		metrics.RegisterNodeMetadataLookup(metrics.NodeMetadataFailed)
 		return nil, err
 	}
-	// creates the clientset
-	clientset, err := kubernetes.NewForConfig(config)
+
+	return nodeManager.newNodeMetadata(ctx, clientset, logger)
+}
+
+// getKubeClient returns the injected client or creates a new one
+func (nodeManager *NodeInfoManager) getKubeClient() (kubernetes.Interface, error) {
+	if nodeManager.KubeClient != nil {
+		return nodeManager.KubeClient, nil
+	}
+	if nodeManager.ClientFactory != nil {
+		return nodeManager.ClientFactory()
+	}
+	return NewKubeClient(nodeManager.Master, nodeManager.KubeConfig)
+}
+
+// NewKubeClient creates a kubernetes client from master URL and kubeconfig path, same as the PV watcher does.
+// In-cluster config is used if both are empty.
+func NewKubeClient(master string, kubeConfig string) (kubernetes.Interface, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags(master, kubeConfig)
 	if err != nil {
 		return nil, err
 	}
+	// creates the clientset
+	return kubernetes.NewForConfig(restConfig)
+}
 
-	node, err := clientset.CoreV1().Nodes().Get(context.Background(), nodeManager.NodeName, metav1.GetOptions{})
+// newNodeMetadata reads the node object using the given client and builds the node metadata from it
+func (nodeManager *NodeInfoManager) newNodeMetadata(ctx context.Context, clientset kubernetes.Interface, logger *zap.Logger) (NodeMetadata, error) {
+	node, err := nodeManager.getNode(ctx, clientset, logger)
 	if err != nil {
+		if !isRetriableError(err) {
+			metrics.RegisterNodeMetadataLookup(metrics.NodeMetadataFailed)
+			return nil, err
+		}
+		cached, updatedAt, cacheErr := nodeManager.loadCache()
+		if cacheErr != nil {
+			logger.Error("Failed to get node and no usable node metadata cache", zap.String("node", nodeManager.NodeName), zap.Error(err), zap.NamedError("cacheError", cacheErr))
+			metrics.RegisterNodeMetadataLookup(metrics.NodeMetadataFailed)
+			return nil, err
+		}
+		logger.Warn("API server unreachable, using cached node metadata", zap.String("node", nodeManager.NodeName),
+			zap.String("path", nodeManager.CachePath), zap.Time("updatedAt", updatedAt), zap.Error(err))
+		metrics.RegisterNodeMetadataLookup(metrics.NodeMetadataCached)
+		return cached, nil
+	}
+
+	nodeMetadata, err := nodeManager.buildNodeMetadata(node, logger)
+	if err != nil {
+		metrics.RegisterNodeMetadataLookup(metrics.NodeMetadataFailed)
 		return nil, err
 	}
+	nodeManager.saveCache(nodeMetadata, logger)
+	metrics.RegisterNodeMetadataLookup(metrics.NodeMetadataLive)
+	return nodeMetadata, nil
+}
+
+// getNode gets the node object, retrying transient errors with backoff until ctx is done or the steps are exhausted
+func (nodeManager *NodeInfoManager) getNode(ctx context.Context, clientset kubernetes.Interface, logger *zap.Logger) (*v1.Node, error) {
+	backoff := DefaultBackoff
+	if nodeManager.Backoff != nil {
+		backoff = *nodeManager.Backoff
+	}
 
-	nodeLabels := node.ObjectMeta.Labels
-	if len(nodeLabels[utils.NodeRegionLabel]) == 0 || len(nodeLabels[utils.NodeZoneLabel]) == 0 {
-		errorMsg := fmt.Errorf("One or few required node label(s) is/are missing [%s, %s]. Node Labels Found = [#%v]", utils.NodeRegionLabel, utils.NodeZoneLabel, nodeLabels) //nolint:golint
-		return nil, errorMsg
+	var node *v1.Node
+	var lastErr error
+	attempt := 0
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		attempt++
+		node, lastErr = clientset.CoreV1().Nodes().Get(ctx, nodeManager.NodeName, metav1.GetOptions{})
+		if lastErr == nil {
+			return true, nil
+		}
+		if !isRetriableError(lastErr) {
+			return false, lastErr
+		}
+		logger.Warn("Failed to get node, retrying", zap.String("node", nodeManager.NodeName), zap.Int("attempt", attempt), zap.Error(lastErr))
+		metrics.RegisterNodeMetadataRetry()
+		return false, nil
+	})
+	if err == nil {
+		return node, nil
+	}
+	if lastErr == nil {
+		// ctx was done before the first attempt
+		lastErr = err
 	}
+	return nil, fmt.Errorf("Failed to get node %s after %d attempts: %w", nodeManager.NodeName, attempt, lastErr)
+}
 
-	var workerID, accountID string
+// isRetriableError API server blips i.e connection errors, timeouts, throttling and server errors are retried
+func isRetriableError(err error) bool {
+	return !(apierrors.IsNotFound(err) || apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) ||
+		apierrors.IsBadRequest(err) || apierrors.IsInvalid(err) || apierrors.IsMethodNotSupported(err))
+}
+
+// buildNodeMetadata builds the node metadata from node labels and provider ID.
+// Along with the error, the partially filled metadata is returned so that the watcher can keep what it has.
+func (nodeManager *NodeInfoManager) buildNodeMetadata(node *v1.Node, logger *zap.Logger) (*nodeMetadataManager, error) {
+	nodeMetadata := &nodeMetadataManager{}
+	nodeLabels := node.ObjectMeta.Labels
+	topology, err := ResolveTopologyLabels(nodeLabels, nodeManager.LabelPrecedence)
+	if err != nil {
+		logger.Error("Unable to resolve node topology labels", zap.String("node", node.Name), zap.Reflect("labels", nodeLabels), zap.Error(err))
+		return nodeMetadata, err
+	}
+	for _, conflict := range topology.Conflicts {
+		logger.Warn("Conflicting node topology labels", zap.String("node", node.Name), zap.String("conflict", conflict.String()))
+	}
+	nodeMetadata.zone = topology.Zone
+	nodeMetadata.region = topology.Region
+	nodeMetadata.instanceProfile = nodeLabels[utils.InstanceTypeLabel]
+	nodeMetadata.vpcID = nodeLabels[utils.VPCIDLabel]
+	nodeMetadata.workerPool = nodeLabels[utils.WorkerPoolLabel]
+	attachLimits, err := NormalizeAttachLimits(nodeManager.AttachLimits)
+	if err != nil {
+		logger.Error("Invalid attach limit overrides", zap.Reflect("attachLimits", nodeManager.AttachLimits), zap.Error(err))
+		return nodeMetadata, err
+	}
+	nodeMetadata.maxAttachableVolumes = GetMaxAttachableVolumes(nodeMetadata.instanceProfile, attachLimits)
 
 	// If the cluster is satellite, the machine-type label equals to UPI
 	if nodeLabels[utils.MachineTypeLabel] == utils.UPI {
 		// For a satellite cluster, workerID is fetched from vpc-instance-id node label, which is updated by the vpc-node-label-updater (init container)
-		workerID = nodeLabels[utils.NodeInstanceIDLabel]
+		nodeMetadata.workerID = nodeLabels[utils.NodeInstanceIDLabel]
+
+		clusterInfoPath := nodeManager.ClusterInfoPath
+		if clusterInfoPath == "" {
+			clusterInfoPath = utils.GetClusterInfoPath(utils.GetConfigDir())
+		}
+		accountID, source, err := resolveSatelliteAccountID(node, clusterInfoPath, logger)
+		if err != nil {
+			return nodeMetadata, err
+		}
+		if accountID == "" {
+			logger.Warn("Account ID not found for satellite node", zap.String("node", node.Name))
+		} else {
+			logger.Info("Account ID resolved for satellite node", zap.String("node", node.Name), zap.String("source", string(source)))
+		}
+		nodeMetadata.accountID = accountID
 	} else {
 		// For managed and IPI cluster, workerID and accountID is fetched from the ProviderID in node spec.
-		workerID, accountID = fetchInstanceAndAccountID(node.Spec.ProviderID)
-		if workerID == "" {
-			return nil, fmt.Errorf("Unable to fetch instance ID from node provider ID - %s", node.Spec.ProviderID)
+		providerID, err := ParseProviderID(node.Spec.ProviderID)
+		if err != nil {
+			// Keep accepting the provider IDs of the historical parsing rules, which did not validate the account ID
+			workerID, accountID := fetchInstanceAndAccountID(node.Spec.ProviderID)
+			if workerID == "" {
+				return nodeMetadata, fmt.Errorf("Unable to fetch instance ID from node provider ID - %v", err)
+			}
+			logger.Warn("Unexpected node provider ID format", zap.String("node", node.Name), zap.Error(err))
+			nodeMetadata.workerID, nodeMetadata.accountID = workerID, accountID
+			return nodeMetadata, nil
+		}
+		if err = providerID.CheckTopology(); err != nil {
+			logger.Warn("Inconsistent region and zone in node provider ID", zap.String("node", node.Name), zap.Error(err))
 		}
+		if err = validateAccountID(providerID.AccountID, AccountIDFromProviderID); err != nil {
+			return nodeMetadata, err
+		}
+		nodeMetadata.workerID, nodeMetadata.accountID = providerID.InstanceID, providerID.AccountID
 	}
 
-	return &nodeMetadataManager{
-		zone:     nodeLabels[utils.NodeZoneLabel],
-		region:   nodeLabels[utils.NodeRegionLabel],
-		workerID: workerID,
-		accountID: accountID,
-	}, nil
+	return nodeMetadata, nil
 }
 
 func (manager *nodeMetadataManager) GetZone() string {
@@ -125,12 +331,18 @@ func (manager *nodeMetadataManager) GetAccountID() string {
 	return manager.accountID
 }
 
-// fetchInstanceAndAccountID fetches instance and account ID from the provider ID in node spec.
-func fetchInstanceAndAccountID(providerID string) (string, string) {
-	s := strings.Split(providerID, "/")
-	if len(s) != 7 {
-		return "", ""
-	}
+func (manager *nodeMetadataManager) GetInstanceProfile() string {
+	return manager.instanceProfile
+}
+
+func (manager *nodeMetadataManager) GetVPCID() string {
+	return manager.vpcID
+}
+
+func (manager *nodeMetadataManager) GetWorkerPool() string {
+	return manager.workerPool
+}
 
-	return s[6], s[2]
+func (manager *nodeMetadataManager) GetMaxAttachableVolumes() int64 {
+	return manager.maxAttachableVolumes
 }
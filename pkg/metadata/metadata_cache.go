@@ -0,0 +1,123 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// nodeMetadataCache is the on-disk format of the node metadata cache
+type nodeMetadataCache struct {
+	NodeName             string    `json:"node_name"`
+	Zone                 string    `json:"zone"`
+	Region               string    `json:"region"`
+	WorkerID             string    `json:"worker_id"`
+	AccountID            string    `json:"account_id"`
+	InstanceProfile      string    `json:"instance_profile,omitempty"`
+	VPCID                string    `json:"vpc_id,omitempty"`
+	WorkerPool           string    `json:"worker_pool,omitempty"`
+	MaxAttachableVolumes int64     `json:"max_attachable_volumes"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+// saveCache writes the node metadata to CachePath. The file is replaced atomically so that
+// a crash while writing never leaves a truncated cache behind. Failures are only logged.
+func (nodeManager *NodeInfoManager) saveCache(nodeMetadata *nodeMetadataManager, logger *zap.Logger) {
+	if nodeManager.CachePath == "" {
+		return
+	}
+	cache := nodeMetadataCache{
+		NodeName:             nodeManager.NodeName,
+		Zone:                 nodeMetadata.zone,
+		Region:               nodeMetadata.region,
+		WorkerID:             nodeMetadata.workerID,
+		AccountID:            nodeMetadata.accountID,
+		InstanceProfile:      nodeMetadata.instanceProfile,
+		VPCID:                nodeMetadata.vpcID,
+		WorkerPool:           nodeMetadata.workerPool,
+		MaxAttachableVolumes: nodeMetadata.maxAttachableVolumes,
+		UpdatedAt:            time.Now().UTC(),
+	}
+	if err := writeCacheFile(nodeManager.CachePath, &cache); err != nil {
+		logger.Warn("Failed to save node metadata cache", zap.String("path", nodeManager.CachePath), zap.Error(err))
+		return
+	}
+	logger.Info("Saved node metadata cache", zap.String("path", nodeManager.CachePath))
+}
+
+// writeCacheFile ...
+func writeCacheFile(path string, cache *nodeMetadataCache) error {
+	content, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name()) // no-op once renamed
+	if _, err = tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// loadCache reads the node metadata saved by the last successful lookup of this node
+func (nodeManager *NodeInfoManager) loadCache() (*nodeMetadataManager, time.Time, error) {
+	if nodeManager.CachePath == "" {
+		return nil, time.Time{}, fmt.Errorf("Node metadata cache is not configured")
+	}
+	content, err := os.ReadFile(nodeManager.CachePath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	cache := nodeMetadataCache{}
+	if err = json.Unmarshal(content, &cache); err != nil {
+		return nil, time.Time{}, fmt.Errorf("Invalid node metadata cache %s: %v", nodeManager.CachePath, err)
+	}
+	if cache.NodeName != nodeManager.NodeName {
+		return nil, time.Time{}, fmt.Errorf("Node metadata cache %s belongs to node '%s'", nodeManager.CachePath, cache.NodeName)
+	}
+	if cache.WorkerID == "" {
+		return nil, time.Time{}, fmt.Errorf("Worker ID missing in node metadata cache %s", nodeManager.CachePath)
+	}
+	return &nodeMetadataManager{
+		zone:                 cache.Zone,
+		region:               cache.Region,
+		workerID:             cache.WorkerID,
+		accountID:            cache.AccountID,
+		instanceProfile:      cache.InstanceProfile,
+		vpcID:                cache.VPCID,
+		workerPool:           cache.WorkerPool,
+		maxAttachableVolumes: cache.MaxAttachableVolumes,
+	}, cache.UpdatedAt, nil
+}
@@ -0,0 +1,347 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/metrics"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// DefaultMetadataServiceEndpoint is the link local endpoint of the VPC instance metadata service
+	DefaultMetadataServiceEndpoint = "http://api.metadata.cloud.ibm.com"
+
+	// metadataServiceVersion is the API version sent to the metadata service
+	metadataServiceVersion = "2022-03-01"
+	// metadataTokenPath is used to exchange the instance identity token
+	metadataTokenPath = "/instance_identity/v1/token"
+	// metadataInstancePath is used to read the instance details
+	metadataInstancePath = "/metadata/v1/instance"
+	// metadataTokenExpiry instance identity token expiry in seconds, the token is used only once
+	metadataTokenExpiry = 300
+	// metadataServiceTimeout http timeout of metadata service calls
+	metadataServiceTimeout = 30 * time.Second
+
+	// DefaultMetadataServiceLookupTimeout is how long the metadata service is retried before node labels are used
+	DefaultMetadataServiceLookupTimeout = 10 * time.Second
+)
+
+// MetadataServiceEnabled ...
+var MetadataServiceEnabled = flag.Bool("metadata_service_enabled", false, "Read node metadata from the VPC instance metadata service instead of node labels")
+
+// MetadataServiceNodeInfo reads node metadata from the VPC instance metadata service.
+// Node labels are read through the embedded NodeInfoManager if the metadata service is disabled.
+type MetadataServiceNodeInfo struct {
+	NodeInfoManager
+
+	// Enabled selects the metadata service, node labels are used if false
+	Enabled bool
+
+	// Endpoint of the metadata service, DefaultMetadataServiceEndpoint if empty
+	Endpoint string
+
+	// HTTPClient used to call the metadata service, a client with metadataServiceTimeout if nil
+	HTTPClient *http.Client
+
+	// LookupTimeout is how long the metadata service is retried, DefaultMetadataServiceLookupTimeout if zero.
+	// It is capped to half of the time left before the caller's deadline, the rest is left to the node labels.
+	LookupTimeout time.Duration
+}
+
+var _ NodeInfo = &MetadataServiceNodeInfo{}
+
+// NewNodeInfo returns the NodeInfo selected by the metadata_service_enabled flag
+func NewNodeInfo(nodeName string) NodeInfo {
+	return &MetadataServiceNodeInfo{
+		NodeInfoManager: NodeInfoManager{NodeName: nodeName},
+		Enabled:         *MetadataServiceEnabled,
+	}
+}
+
+// metadataToken is the instance identity token response
+type metadataToken struct {
+	AccessToken string `json:"access_token"`
+}
+
+// metadataInstance is the subset of the instance metadata used by the driver
+type metadataInstance struct {
+	ID   string `json:"id"`
+	CRN  string `json:"crn"`
+	Zone struct {
+		Name string `json:"name"`
+	} `json:"zone"`
+	Profile struct {
+		Name string `json:"name"`
+	} `json:"profile"`
+	VPC struct {
+		ID string `json:"id"`
+	} `json:"vpc"`
+}
+
+// NewNodeMetadata reads the instance metadata for up to LookupTimeout, node labels are used if the metadata service fails
+func (metadataService *MetadataServiceNodeInfo) NewNodeMetadata(logger *zap.Logger) (NodeMetadata, error) {
+	if !metadataService.Enabled {
+		return metadataService.NodeInfoManager.NewNodeMetadata(logger)
+	}
+	instance, err := metadataService.lookupInstance(context.Background(), logger)
+	if err != nil {
+		metadataService.fallbackToNodeLabels(err, logger)
+		return metadataService.NodeInfoManager.NewNodeMetadata(logger)
+	}
+	return metadataService.nodeMetadataFromInstance(instance, logger)
+}
+
+// NewNodeMetadataWithContext reads the instance metadata, transient metadata service errors are retried with
+// the node lookup backoff for up to LookupTimeout. If the metadata service fails or cannot be reached at all,
+// i.e it is not enabled for the worker node, node labels are read with what is left of ctx.
+func (metadataService *MetadataServiceNodeInfo) NewNodeMetadataWithContext(ctx context.Context, logger *zap.Logger) (NodeMetadata, error) {
+	if !metadataService.Enabled {
+		return metadataService.NodeInfoManager.NewNodeMetadataWithContext(ctx, logger)
+	}
+	instance, err := metadataService.lookupInstance(ctx, logger)
+	if err != nil {
+		metadataService.fallbackToNodeLabels(err, logger)
+		return metadataService.NodeInfoManager.NewNodeMetadataWithContext(ctx, logger)
+	}
+	return metadataService.nodeMetadataFromInstance(instance, logger)
+}
+
+// fallbackToNodeLabels ...
+func (metadataService *MetadataServiceNodeInfo) fallbackToNodeLabels(err error, logger *zap.Logger) {
+	logger.Warn("Failed to read instance metadata, metadata service might not be enabled for the worker node. Falling back to node labels",
+		zap.String("endpoint", metadataService.getEndpoint()), zap.String("node", metadataService.NodeName), zap.Error(err))
+	metrics.RegisterNodeMetadataServiceFallback()
+}
+
+// lookupInstance exchanges an instance identity token and reads the instance metadata with it, retrying transient
+// errors with backoff until the lookup timeout elapsed, ctx is done or the steps are exhausted
+func (metadataService *MetadataServiceNodeInfo) lookupInstance(ctx context.Context, logger *zap.Logger) (*metadataInstance, error) {
+	ctx, cancel := context.WithTimeout(ctx, metadataService.getLookupTimeout(ctx))
+	defer cancel()
+	backoff := DefaultBackoff
+	if metadataService.Backoff != nil {
+		backoff = *metadataService.Backoff
+	}
+
+	logger.Info("Reading node metadata from VPC instance metadata service", zap.String("endpoint", metadataService.getEndpoint()))
+	var instance *metadataInstance
+	var lastErr error
+	attempt := 0
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		attempt++
+		var token string
+		if token, lastErr = metadataService.getToken(ctx); lastErr != nil {
+			lastErr = fmt.Errorf("Unable to get instance identity token: %w", lastErr)
+		} else if instance, lastErr = metadataService.getInstance(ctx, token); lastErr != nil {
+			lastErr = fmt.Errorf("Unable to get instance metadata: %w", lastErr)
+		}
+		if lastErr == nil {
+			return true, nil
+		}
+		if !isRetriableMetadataServiceError(lastErr) {
+			return false, lastErr
+		}
+		logger.Warn("Failed to read instance metadata, retrying", zap.Int("attempt", attempt), zap.Error(lastErr))
+		return false, nil
+	})
+	if err == nil {
+		return instance, nil
+	}
+	if lastErr == nil {
+		// ctx was done before the first attempt
+		lastErr = err
+	}
+	return nil, fmt.Errorf("Failed to read instance metadata after %d attempts: %w", attempt, lastErr)
+}
+
+// nodeMetadataFromInstance ...
+func (metadataService *MetadataServiceNodeInfo) nodeMetadataFromInstance(instance *metadataInstance, logger *zap.Logger) (NodeMetadata, error) {
+	accountID, err := accountIDFromCRN(instance.CRN)
+	if err != nil {
+		return nil, err
+	}
+	if len(instance.ID) == 0 || len(instance.Zone.Name) == 0 {
+		return nil, fmt.Errorf("Instance ID or zone missing in instance metadata - %+v", instance)
+	}
+	attachLimits, err := NormalizeAttachLimits(metadataService.AttachLimits)
+	if err != nil {
+		return nil, err
+	}
+	nodeMetadata := &nodeMetadataManager{
+		zone:                 instance.Zone.Name,
+		region:               regionFromZone(instance.Zone.Name),
+		workerID:             instance.ID,
+		accountID:            accountID,
+		instanceProfile:      instance.Profile.Name,
+		vpcID:                instance.VPC.ID,
+		maxAttachableVolumes: GetMaxAttachableVolumes(instance.Profile.Name, attachLimits),
+	}
+	logger.Info("Node metadata read from VPC instance metadata service", zap.Reflect("metadata", *nodeMetadata))
+	return nodeMetadata, nil
+}
+
+// getLookupTimeout returns LookupTimeout, capped to half of the time left before the deadline of ctx
+func (metadataService *MetadataServiceNodeInfo) getLookupTimeout(ctx context.Context) time.Duration {
+	timeout := metadataService.LookupTimeout
+	if timeout <= 0 {
+		timeout = DefaultMetadataServiceLookupTimeout
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline) / 2; left < timeout {
+			timeout = left
+		}
+	}
+	return timeout
+}
+
+// getEndpoint ...
+func (metadataService *MetadataServiceNodeInfo) getEndpoint() string {
+	if metadataService.Endpoint != "" {
+		return strings.TrimSuffix(metadataService.Endpoint, "/")
+	}
+	return DefaultMetadataServiceEndpoint
+}
+
+// getHTTPClient ...
+func (metadataService *MetadataServiceNodeInfo) getHTTPClient() *http.Client {
+	if metadataService.HTTPClient != nil {
+		return metadataService.HTTPClient
+	}
+	return &http.Client{Timeout: metadataServiceTimeout}
+}
+
+// getToken exchanges an instance identity token
+func (metadataService *MetadataServiceNodeInfo) getToken(ctx context.Context) (string, error) {
+	payload, err := json.Marshal(map[string]int{"expires_in": metadataTokenExpiry})
+	if err != nil {
+		return "", err
+	}
+	url := fmt.Sprintf("%s%s?version=%s", metadataService.getEndpoint(), metadataTokenPath, metadataServiceVersion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "ibm")
+	req.Header.Set("Content-Type", "application/json")
+
+	token := &metadataToken{}
+	if err = metadataService.do(req, token); err != nil {
+		return "", err
+	}
+	if len(token.AccessToken) == 0 {
+		return "", errors.New("Empty access token in metadata service response")
+	}
+	return token.AccessToken, nil
+}
+
+// getInstance reads the instance details using the identity token
+func (metadataService *MetadataServiceNodeInfo) getInstance(ctx context.Context, token string) (*metadataInstance, error) {
+	url := fmt.Sprintf("%s%s?version=%s", metadataService.getEndpoint(), metadataInstancePath, metadataServiceVersion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	instance := &metadataInstance{}
+	if err = metadataService.do(req, instance); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+// do sends the request and decodes the json response
+func (metadataService *MetadataServiceNodeInfo) do(req *http.Request, response interface{}) error {
+	resp, err := metadataService.getHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return &metadataServiceError{method: req.Method, path: req.URL.Path, statusCode: resp.StatusCode, body: string(body)}
+	}
+	return json.Unmarshal(body, response)
+}
+
+// metadataServiceError is the error of a metadata service request answered with an error status
+type metadataServiceError struct {
+	method     string
+	path       string
+	statusCode int
+	body       string
+}
+
+// Error ...
+func (e *metadataServiceError) Error() string {
+	return fmt.Sprintf("Metadata service request %s %s failed with ResponseCode: %v, Body: %s", e.method, e.path, e.statusCode, e.body)
+}
+
+// isRetriableMetadataServiceError throttling, server errors and dropped connections are retried. DNS and dial
+// errors are not, the metadata service is not enabled for the worker node if it cannot be reached at all.
+func isRetriableMetadataServiceError(err error) bool {
+	var serviceErr *metadataServiceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.statusCode == http.StatusTooManyRequests || serviceErr.statusCode >= http.StatusInternalServerError
+	}
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	if errors.As(err, &dnsErr) || (errors.As(err, &opErr) && opErr.Op == "dial") {
+		return false
+	}
+	var syntaxErr *json.SyntaxError
+	return !errors.As(err, &syntaxErr)
+}
+
+// accountIDFromCRN reads the account ID from an instance CRN i.e crn:v1:bluemix:public:is:us-south-1:a/<account-id>::instance:<id>
+func accountIDFromCRN(crn string) (string, error) {
+	segments := strings.Split(crn, ":")
+	if len(segments) < 7 || !strings.HasPrefix(segments[6], "a/") {
+		return "", fmt.Errorf("Unable to fetch account ID from instance CRN - %s", crn)
+	}
+	accountID := strings.TrimPrefix(segments[6], "a/")
+	if err := validateAccountID(accountID, AccountIDFromCRN); err != nil {
+		return "", err
+	}
+	return accountID, nil
+}
+
+// regionFromZone returns the region of a VPC zone i.e us-south for us-south-1
+func regionFromZone(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
@@ -0,0 +1,232 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testInstanceID    = "0717_6b3c1c2f-8a7e-4b2b-9a8e-2f2f8d4c9b10"
+	testInstanceToken = "test-instance-token"
+)
+
+// newMetadataServer starts a stand-in of the VPC instance metadata service
+func newMetadataServer(t *testing.T, tokenStatus int, instanceCRN string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(metadataTokenPath, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "ibm", r.Header.Get("Metadata-Flavor"))
+		assert.Equal(t, metadataServiceVersion, r.URL.Query().Get("version"))
+		if tokenStatus != http.StatusOK {
+			w.WriteHeader(tokenStatus)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"forbidden"}]}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": testInstanceToken})
+	})
+	mux.HandleFunc(metadataInstancePath, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		if r.Header.Get("Authorization") != "Bearer "+testInstanceToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{
+			"id": "` + testInstanceID + `",
+			"crn": "` + instanceCRN + `",
+			"zone": {"name": "us-south-2"},
+			"profile": {"name": "bx2-4x16"},
+			"vpc": {"id": "r006-testvpcid"}
+		}`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestMetadataServiceNodeInfo(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	validCRN := "crn:v1:bluemix:public:is:us-south-2:a/myaccountid::instance:" + testInstanceID
+	testCases := []struct {
+		testCaseName string
+		tokenStatus  int
+		instanceCRN  string
+		expectedErr  bool
+	}{
+		{testCaseName: "Instance metadata read", tokenStatus: http.StatusOK, instanceCRN: validCRN},
+		{testCaseName: "CRN without account", tokenStatus: http.StatusOK, instanceCRN: "crn:v1:bluemix:public:is:us-south-2", expectedErr: true},
+		{testCaseName: "CRN with invalid account", tokenStatus: http.StatusOK, instanceCRN: "crn:v1:bluemix:public:is:us-south-2:a/my-account::instance:id", expectedErr: true},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			server := newMetadataServer(t, testcase.tokenStatus, testcase.instanceCRN)
+			defer server.Close()
+
+			nodeInfo := &MetadataServiceNodeInfo{Enabled: true, Endpoint: server.URL, HTTPClient: server.Client()}
+			nodeMeta, err := nodeInfo.NewNodeMetadata(logger)
+			if testcase.expectedErr {
+				assert.NotNil(t, err)
+				assert.Nil(t, nodeMeta)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "us-south-2", nodeMeta.GetZone())
+			assert.Equal(t, "us-south", nodeMeta.GetRegion())
+			assert.Equal(t, testInstanceID, nodeMeta.GetWorkerID())
+			assert.Equal(t, "myaccountid", nodeMeta.GetAccountID())
+			assert.Equal(t, "bx2-4x16", nodeMeta.GetInstanceProfile())
+			assert.Equal(t, "r006-testvpcid", nodeMeta.GetVPCID())
+			assert.Equal(t, int64(12), nodeMeta.GetMaxAttachableVolumes())
+		})
+	}
+}
+
+func TestMetadataServiceFallback(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	unreachable := newMetadataServer(t, http.StatusOK, "")
+	unreachable.Close()
+	forbidden := newMetadataServer(t, http.StatusForbidden, "")
+	defer forbidden.Close()
+	testCases := []struct {
+		testCaseName string
+		endpoint     string
+	}{
+		{testCaseName: "Token exchange failure", endpoint: forbidden.URL},
+		{testCaseName: "Metadata service unreachable", endpoint: unreachable.URL},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(&v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: map[string]string{utils.NodeZoneLabel: "myzone", utils.NodeRegionLabel: "myregion"}},
+				Spec:       v1.NodeSpec{ProviderID: testProviderID},
+			})
+			nodeInfo := &MetadataServiceNodeInfo{
+				NodeInfoManager: NodeInfoManager{NodeName: "mynode", KubeClient: clientset, Backoff: testBackoff},
+				Enabled:         true,
+				Endpoint:        testcase.endpoint,
+			}
+			nodeMeta, err := nodeInfo.NewNodeMetadataWithContext(context.Background(), logger)
+			assert.Nil(t, err)
+			assert.Equal(t, "myzone", nodeMeta.GetZone())
+			assert.Equal(t, "myregion", nodeMeta.GetRegion())
+			assert.Equal(t, "testworkerid", nodeMeta.GetWorkerID())
+		})
+	}
+}
+
+func TestMetadataServiceFallbackWithDeadline(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	unreachable := newMetadataServer(t, http.StatusOK, "")
+	unreachable.Close()
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hanging.Close()
+	defer close(release)
+	testCases := []struct {
+		testCaseName string
+		endpoint     string
+		maxDuration  time.Duration
+	}{
+		// Dial errors fall back immediately instead of retrying with DefaultBackoff
+		{testCaseName: "Metadata service unreachable", endpoint: unreachable.URL, maxDuration: time.Second},
+		// The lookup only takes half of the time left, the node labels are read with the other half
+		{testCaseName: "Metadata service not answering", endpoint: hanging.URL, maxDuration: 2 * time.Second},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(&v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: map[string]string{utils.NodeZoneLabel: "myzone", utils.NodeRegionLabel: "myregion"}},
+				Spec:       v1.NodeSpec{ProviderID: testProviderID},
+			})
+			nodeInfo := &MetadataServiceNodeInfo{
+				NodeInfoManager: NodeInfoManager{NodeName: "mynode", KubeClient: clientset},
+				Enabled:         true,
+				Endpoint:        testcase.endpoint,
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			start := time.Now()
+			nodeMeta, err := nodeInfo.NewNodeMetadataWithContext(ctx, logger)
+			assert.Nil(t, err)
+			assert.Less(t, time.Since(start), testcase.maxDuration)
+			assert.Equal(t, "myzone", nodeMeta.GetZone())
+			assert.Equal(t, "testworkerid", nodeMeta.GetWorkerID())
+		})
+	}
+}
+
+func TestMetadataServiceRetry(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	server := newMetadataServer(t, http.StatusOK, "crn:v1:bluemix:public:is:us-south-2:a/myaccountid::instance:"+testInstanceID)
+	defer server.Close()
+	attempts := 0
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	nodeInfo := &MetadataServiceNodeInfo{NodeInfoManager: NodeInfoManager{Backoff: testBackoff}, Enabled: true, Endpoint: flaky.URL}
+	nodeMeta, err := nodeInfo.NewNodeMetadataWithContext(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, testInstanceID, nodeMeta.GetWorkerID())
+	assert.Equal(t, 4, attempts)
+}
+
+func TestMetadataServiceDisabled(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	clientset := fake.NewSimpleClientset(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: map[string]string{utils.NodeZoneLabel: "myzone", utils.NodeRegionLabel: "myregion"}},
+		Spec:       v1.NodeSpec{ProviderID: testProviderID},
+	})
+	nodeInfo := NewNodeInfo("mynode").(*MetadataServiceNodeInfo)
+	assert.False(t, nodeInfo.Enabled)
+	nodeInfo.KubeClient = clientset
+	nodeMeta, err := nodeInfo.NewNodeMetadata(logger)
+	assert.Nil(t, err)
+	assert.Equal(t, "myzone", nodeMeta.GetZone())
+	assert.Equal(t, "testworkerid", nodeMeta.GetWorkerID())
+}
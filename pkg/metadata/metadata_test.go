@@ -18,12 +18,41 @@
 package metadata
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/IBM/ibm-csi-common/pkg/utils"
 	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
+// testBackoff keeps the retry tests fast
+var testBackoff = &wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 4}
+
+// newFailingClient returns a client whose first failures node gets fail with a connection error
+func newFailingClient(node *v1.Node, failures int) (*fake.Clientset, *int) {
+	clientset := fake.NewSimpleClientset(node)
+	calls := 0
+	clientset.PrependReactor("get", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		if calls <= failures {
+			return true, nil, errors.New("dial tcp 172.21.0.1:443: connect: connection refused")
+		}
+		return false, nil, nil
+	})
+	return clientset, &calls
+}
+
 func TestNewNodeMetadata(t *testing.T) {
 	// Creating test logger
 	logger, teardown := utils.GetTestLogger(t)
@@ -42,6 +71,159 @@ func TestNewNodeMetadata(t *testing.T) {
 	assert.Equal(t, "myworkerid", nodeMetadata.GetWorkerID())
 }
 
+func TestNewNodeMetadataWithClient(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	zoneLabels := map[string]string{utils.NodeZoneLabel: "myzone", utils.NodeRegionLabel: "myregion"}
+	testCases := []struct {
+		testCaseName      string
+		node              *v1.Node
+		expectedZone      string
+		expectedRegion    string
+		expectedWorkerID  string
+		expectedAccountID string
+		expectedErr       bool
+	}{
+		{
+			testCaseName: "Managed cluster node",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: zoneLabels},
+				Spec:       v1.NodeSpec{ProviderID: "ibm://myaccountid///myclusterid/myworkerid"},
+			},
+			expectedZone:      "myzone",
+			expectedRegion:    "myregion",
+			expectedWorkerID:  "myworkerid",
+			expectedAccountID: "myaccountid",
+		},
+		{
+			testCaseName: "Satellite cluster node",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: map[string]string{
+					utils.NodeZoneLabel:       "myzone",
+					utils.NodeRegionLabel:     "myregion",
+					utils.MachineTypeLabel:    utils.UPI,
+					utils.NodeInstanceIDLabel: "myinstanceid",
+				}},
+			},
+			expectedZone:     "myzone",
+			expectedRegion:   "myregion",
+			expectedWorkerID: "myinstanceid",
+		},
+		{
+			testCaseName: "Zone not in region of provider ID",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: zoneLabels},
+				Spec:       v1.NodeSpec{ProviderID: "ibm://myaccountid/us-east/us-south-1/myclusterid/myworkerid"},
+			},
+			expectedZone:      "myzone",
+			expectedRegion:    "myregion",
+			expectedWorkerID:  "myworkerid",
+			expectedAccountID: "myaccountid",
+		},
+		{
+			// Rejected by ParseProviderID, accepted by the historical parsing rules
+			testCaseName: "Provider ID without cluster ID",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: zoneLabels},
+				Spec:       v1.NodeSpec{ProviderID: "ibm://myaccountid////myworkerid"},
+			},
+			expectedZone:      "myzone",
+			expectedRegion:    "myregion",
+			expectedWorkerID:  "myworkerid",
+			expectedAccountID: "myaccountid",
+		},
+		{
+			// The historical parsing rules did not validate the account ID
+			testCaseName: "Provider ID without account ID",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: zoneLabels},
+				Spec:       v1.NodeSpec{ProviderID: "ibm://////myworkerid"},
+			},
+			expectedZone:     "myzone",
+			expectedRegion:   "myregion",
+			expectedWorkerID: "myworkerid",
+		},
+		{
+			testCaseName: "Provider ID with non alphanumeric account ID",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: zoneLabels},
+				Spec:       v1.NodeSpec{ProviderID: "ibm://my.account.id////myworkerid"},
+			},
+			expectedZone:      "myzone",
+			expectedRegion:    "myregion",
+			expectedWorkerID:  "myworkerid",
+			expectedAccountID: "my.account.id",
+		},
+		{
+			testCaseName: "Invalid provider ID",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: zoneLabels},
+				Spec:       v1.NodeSpec{ProviderID: "ibm://myaccountid/myworkerid"},
+			},
+			expectedErr: true,
+		},
+		{
+			testCaseName: "Node not found",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "othernode", Labels: zoneLabels},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			nodeInfo := NodeInfoManager{NodeName: "mynode", KubeClient: fake.NewSimpleClientset(testcase.node)}
+			nodeMeta, err := nodeInfo.NewNodeMetadata(logger)
+			if testcase.expectedErr {
+				assert.NotNil(t, err)
+				assert.Nil(t, nodeMeta)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testcase.expectedZone, nodeMeta.GetZone())
+			assert.Equal(t, testcase.expectedRegion, nodeMeta.GetRegion())
+			assert.Equal(t, testcase.expectedWorkerID, nodeMeta.GetWorkerID())
+			assert.Equal(t, testcase.expectedAccountID, nodeMeta.GetAccountID())
+		})
+	}
+}
+
+func TestNewNodeMetadataClientFactory(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: map[string]string{utils.TopologyZoneLabel: "myzone", utils.TopologyRegionLabel: "myregion"}},
+		Spec:       v1.NodeSpec{ProviderID: "ibm://myaccountid///myclusterid/myworkerid"},
+	}
+	nodeInfo := NodeInfoManager{NodeName: "mynode", ClientFactory: func() (kubernetes.Interface, error) {
+		return fake.NewSimpleClientset(node), nil
+	}}
+	nodeMeta, err := nodeInfo.NewNodeMetadata(logger)
+	assert.Nil(t, err)
+	assert.Equal(t, "myzone", nodeMeta.GetZone())
+
+	nodeInfo.ClientFactory = func() (kubernetes.Interface, error) {
+		return nil, errors.New("client creation failed")
+	}
+	nodeMeta, err = nodeInfo.NewNodeMetadata(logger)
+	assert.NotNil(t, err)
+	assert.Nil(t, nodeMeta)
+}
+
+func TestNewNodeMetadataKubeConfig(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	// kubeconfig path which does not exist
+	nodeInfo := NodeInfoManager{NodeName: "mynode", KubeConfig: "/invalid/kubeconfig"}
+	nodeMeta, err := nodeInfo.NewNodeMetadata(logger)
+	assert.NotNil(t, err)
+	assert.Nil(t, nodeMeta)
+}
+
 func TestGetZone(t *testing.T) {
 	fakeNodeData := FakeNodeMetadata{}
 	fakeNodeData.GetRegionReturns("testregion")
@@ -68,3 +250,123 @@ func TestGetWorkerID(t *testing.T) {
 
 	assert.Equal(t, "testworkerid", fakeNodeData.GetWorkerID())
 }
+
+func TestGetExtendedFields(t *testing.T) {
+	fakeNodeData := FakeNodeMetadata{}
+	fakeNodeData.GetInstanceProfileReturns("bx2-4x16")
+	fakeNodeData.GetVPCIDReturns("testvpcid")
+	fakeNodeData.GetWorkerPoolReturns("testworkerpool")
+	fakeNodeData.GetMaxAttachableVolumesReturns(12)
+
+	assert.Equal(t, "bx2-4x16", fakeNodeData.GetInstanceProfile())
+	assert.Equal(t, "testvpcid", fakeNodeData.GetVPCID())
+	assert.Equal(t, "testworkerpool", fakeNodeData.GetWorkerPool())
+	assert.Equal(t, int64(12), fakeNodeData.GetMaxAttachableVolumes())
+
+	nodeMetadata, err := InitMetadata("mynode", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultMaxAttachableVolumes, nodeMetadata.GetMaxAttachableVolumes())
+}
+
+func TestNewNodeMetadataRetry(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: map[string]string{utils.NodeZoneLabel: "myzone", utils.NodeRegionLabel: "myregion"}},
+		Spec:       v1.NodeSpec{ProviderID: testProviderID},
+	}
+	testCases := []struct {
+		testCaseName  string
+		failures      int
+		expectedCalls int
+		expectedErr   bool
+	}{
+		{testCaseName: "First attempt succeeds", failures: 0, expectedCalls: 1},
+		{testCaseName: "Succeeds after transient errors", failures: 3, expectedCalls: 4},
+		{testCaseName: "Retries exhausted", failures: 10, expectedCalls: 4, expectedErr: true},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			clientset, calls := newFailingClient(node, testcase.failures)
+			nodeInfo := NodeInfoManager{NodeName: "mynode", KubeClient: clientset, Backoff: testBackoff}
+			nodeMeta, err := nodeInfo.NewNodeMetadataWithContext(context.Background(), logger)
+			assert.Equal(t, testcase.expectedCalls, *calls)
+			if testcase.expectedErr {
+				assert.NotNil(t, err)
+				assert.Nil(t, nodeMeta)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "testworkerid", nodeMeta.GetWorkerID())
+		})
+	}
+
+	// Node not found is not retried
+	clientset := fake.NewSimpleClientset()
+	nodeInfo := NodeInfoManager{NodeName: "mynode", KubeClient: clientset, Backoff: testBackoff}
+	_, err := nodeInfo.NewNodeMetadataWithContext(context.Background(), logger)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(clientset.Actions()))
+
+	// Cancelled context stops the retries
+	clientset, _ = newFailingClient(node, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	nodeInfo = NodeInfoManager{NodeName: "mynode", KubeClient: clientset}
+	_, err = nodeInfo.NewNodeMetadataWithContext(ctx, logger)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNewNodeMetadataCache(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	cachePath := filepath.Join(t.TempDir(), "cache", "node-metadata.json")
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: map[string]string{
+			utils.NodeZoneLabel:     "myzone",
+			utils.NodeRegionLabel:   "myregion",
+			utils.InstanceTypeLabel: "bx2.4x16",
+		}},
+		Spec: v1.NodeSpec{ProviderID: testProviderID},
+	}
+
+	// API server unreachable and no cache yet
+	clientset, _ := newFailingClient(node, 10)
+	nodeInfo := NodeInfoManager{NodeName: "mynode", KubeClient: clientset, Backoff: testBackoff, CachePath: cachePath}
+	nodeMeta, err := nodeInfo.NewNodeMetadataWithContext(context.Background(), logger)
+	assert.NotNil(t, err)
+	assert.Nil(t, nodeMeta)
+
+	// Successful lookup saves the cache
+	nodeInfo.KubeClient = fake.NewSimpleClientset(node)
+	live, err := nodeInfo.NewNodeMetadataWithContext(context.Background(), logger)
+	assert.Nil(t, err)
+	_, err = os.Stat(cachePath)
+	assert.Nil(t, err)
+
+	// API server unreachable, cached metadata is used
+	nodeInfo.KubeClient, _ = newFailingClient(node, 10)
+	cached, err := nodeInfo.NewNodeMetadataWithContext(context.Background(), logger)
+	assert.Nil(t, err)
+	assert.Equal(t, live, cached)
+
+	// Cache of another node is ignored
+	clientset, _ = newFailingClient(node, 10)
+	otherNodeInfo := NodeInfoManager{NodeName: "othernode", KubeClient: clientset, Backoff: testBackoff, CachePath: cachePath}
+	_, err = otherNodeInfo.NewNodeMetadataWithContext(context.Background(), logger)
+	assert.NotNil(t, err)
+
+	// Corrupted cache is ignored
+	assert.Nil(t, os.WriteFile(cachePath, []byte("{invalid"), 0600))
+	nodeInfo.KubeClient, _ = newFailingClient(node, 10)
+	_, err = nodeInfo.NewNodeMetadataWithContext(context.Background(), logger)
+	assert.NotNil(t, err)
+
+	// Node not found does not fall back to the cache
+	nodeInfo.KubeClient = fake.NewSimpleClientset()
+	_, err = nodeInfo.NewNodeMetadataWithContext(context.Background(), logger)
+	assert.NotNil(t, err)
+}
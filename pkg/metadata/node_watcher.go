@@ -0,0 +1,243 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultWaitTimeout is how long GetWorkerID waits for the required node labels to appear
+const DefaultWaitTimeout = 2 * time.Minute
+
+// NodeMetadataWatcher is a NodeMetadata which is kept up to date by watching the node object.
+// Every node update replaces the whole snapshot, so zone, region, worker ID and account ID are always read consistently.
+type NodeMetadataWatcher struct {
+	nodeManager NodeInfoManager
+	nodeName    string
+	waitTimeout time.Duration
+	logger      *zap.Logger
+
+	mutex       sync.RWMutex
+	current     *nodeMetadataManager
+	ready       chan struct{}
+	isReady     bool
+	subscribers map[int]chan NodeMetadata
+	nextID      int
+}
+
+var _ NodeMetadata = &NodeMetadataWatcher{}
+
+// WatchNodeMetadata starts watching the node object and returns once the informer cache is synced.
+// The watch is stopped when ctx is cancelled.
+func (nodeManager *NodeInfoManager) WatchNodeMetadata(ctx context.Context, logger *zap.Logger) (*NodeMetadataWatcher, error) {
+	clientset, err := nodeManager.getKubeClient()
+	if err != nil {
+		logger.Error("Failed to create kubernetes client", zap.Error(err))
+		return nil, err
+	}
+
+	waitTimeout := nodeManager.WaitTimeout
+	if waitTimeout == 0 {
+		waitTimeout = DefaultWaitTimeout
+	}
+	watcher := &NodeMetadataWatcher{
+		nodeManager: *nodeManager,
+		nodeName:    nodeManager.NodeName,
+		waitTimeout: waitTimeout,
+		logger:      logger,
+		current:     &nodeMetadataManager{},
+		ready:       make(chan struct{}),
+		subscribers: map[int]chan NodeMetadata{},
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", nodeManager.NodeName).String()
+	}))
+	informer := factory.Core().V1().Nodes().Informer()
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: watcher.onUpdate,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			watcher.onUpdate(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			logger.Warn("Node object deleted, keeping last known node metadata", zap.String("node", watcher.nodeName))
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return nil, errors.New("Failed to sync node informer cache")
+	}
+	go func() {
+		<-ctx.Done()
+		factory.Shutdown()
+		watcher.closeSubscribers()
+	}()
+	logger.Info("Started watching node metadata", zap.String("node", watcher.nodeName))
+	return watcher, nil
+}
+
+// onUpdate rebuilds the node metadata snapshot and notifies the subscribers
+func (watcher *NodeMetadataWatcher) onUpdate(obj interface{}) {
+	node, ok := obj.(*v1.Node)
+	if !ok || node.Name != watcher.nodeName {
+		return
+	}
+	nodeMetadata, err := watcher.nodeManager.buildNodeMetadata(node, watcher.logger)
+	complete := err == nil && nodeMetadata.workerID != ""
+
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	if !complete && watcher.isReady {
+		// Never replace complete metadata by partial one
+		watcher.logger.Warn("Ignoring incomplete node metadata update", zap.String("node", watcher.nodeName), zap.Error(err))
+		return
+	}
+	if *nodeMetadata == *watcher.current {
+		return
+	}
+	watcher.current = nodeMetadata
+	if complete && !watcher.isReady {
+		watcher.isReady = true
+		close(watcher.ready)
+	}
+	watcher.logger.Info("Node metadata updated", zap.String("node", watcher.nodeName), zap.Reflect("metadata", *nodeMetadata), zap.Bool("complete", complete))
+	for _, subscriber := range watcher.subscribers {
+		notify(subscriber, nodeMetadata)
+	}
+}
+
+// notify sends the latest metadata, dropping the previous one if the subscriber has not read it yet
+func notify(subscriber chan NodeMetadata, nodeMetadata NodeMetadata) {
+	select {
+	case <-subscriber:
+	default:
+	}
+	subscriber <- nodeMetadata
+}
+
+// Subscribe returns a channel which receives a NodeMetadata snapshot on every change, and a function to unsubscribe.
+// Only the latest snapshot is kept if the subscriber is slow. The channel is closed when the watch stops.
+func (watcher *NodeMetadataWatcher) Subscribe() (<-chan NodeMetadata, func()) {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	id := watcher.nextID
+	watcher.nextID++
+	subscriber := make(chan NodeMetadata, 1)
+	if watcher.subscribers == nil {
+		close(subscriber)
+		return subscriber, func() {}
+	}
+	watcher.subscribers[id] = subscriber
+
+	unsubscribe := func() {
+		watcher.mutex.Lock()
+		defer watcher.mutex.Unlock()
+		if ch, ok := watcher.subscribers[id]; ok {
+			delete(watcher.subscribers, id)
+			close(ch)
+		}
+	}
+	return subscriber, unsubscribe
+}
+
+// closeSubscribers closes all the subscriber channels once the watch is stopped
+func (watcher *NodeMetadataWatcher) closeSubscribers() {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	for _, subscriber := range watcher.subscribers {
+		close(subscriber)
+	}
+	watcher.subscribers = nil
+}
+
+// snapshot returns the current node metadata
+func (watcher *NodeMetadataWatcher) snapshot() *nodeMetadataManager {
+	watcher.mutex.RLock()
+	defer watcher.mutex.RUnlock()
+	return watcher.current
+}
+
+// WaitForWorkerID blocks until the node has all the required labels or ctx is done
+func (watcher *NodeMetadataWatcher) WaitForWorkerID(ctx context.Context) (string, error) {
+	select {
+	case <-watcher.ready:
+		return watcher.snapshot().workerID, nil
+	case <-ctx.Done():
+		return watcher.snapshot().workerID, ctx.Err()
+	}
+}
+
+// GetZone ...
+func (watcher *NodeMetadataWatcher) GetZone() string {
+	return watcher.snapshot().zone
+}
+
+// GetRegion ...
+func (watcher *NodeMetadataWatcher) GetRegion() string {
+	return watcher.snapshot().region
+}
+
+// GetWorkerID waits up to the configured timeout for the worker ID to be available
+func (watcher *NodeMetadataWatcher) GetWorkerID() string {
+	ctx, cancel := context.WithTimeout(context.Background(), watcher.waitTimeout)
+	defer cancel()
+	workerID, err := watcher.WaitForWorkerID(ctx)
+	if err != nil {
+		watcher.logger.Warn("Timed out waiting for node worker ID", zap.String("node", watcher.nodeName), zap.Duration("timeout", watcher.waitTimeout))
+	}
+	return workerID
+}
+
+// GetAccountID ...
+func (watcher *NodeMetadataWatcher) GetAccountID() string {
+	return watcher.snapshot().accountID
+}
+
+// GetInstanceProfile ...
+func (watcher *NodeMetadataWatcher) GetInstanceProfile() string {
+	return watcher.snapshot().instanceProfile
+}
+
+// GetVPCID ...
+func (watcher *NodeMetadataWatcher) GetVPCID() string {
+	return watcher.snapshot().vpcID
+}
+
+// GetWorkerPool ...
+func (watcher *NodeMetadataWatcher) GetWorkerPool() string {
+	return watcher.snapshot().workerPool
+}
+
+// GetMaxAttachableVolumes ...
+func (watcher *NodeMetadataWatcher) GetMaxAttachableVolumes() int64 {
+	return watcher.snapshot().maxAttachableVolumes
+}
@@ -0,0 +1,126 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWatchNodeMetadata(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	// Satellite node on which the vpc-node-label-updater has not yet set the instance ID
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "mynode", Labels: map[string]string{
+			utils.TopologyZoneLabel:   "myzone",
+			utils.TopologyRegionLabel: "myregion",
+			utils.MachineTypeLabel:    utils.UPI,
+		}},
+	}
+	clientset := fake.NewSimpleClientset(node)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nodeInfo := NodeInfoManager{NodeName: "mynode", KubeClient: clientset, WaitTimeout: 100 * time.Millisecond}
+	watcher, err := nodeInfo.WatchNodeMetadata(ctx, logger)
+	assert.Nil(t, err)
+	assert.Equal(t, "myzone", watcher.GetZone())
+	assert.Equal(t, "myregion", watcher.GetRegion())
+
+	// worker ID is not yet available
+	assert.Equal(t, "", watcher.GetWorkerID())
+
+	updates, unsubscribe := watcher.Subscribe()
+	defer unsubscribe()
+
+	workerIDCh := make(chan string)
+	go func() {
+		workerID, _ := watcher.WaitForWorkerID(ctx)
+		workerIDCh <- workerID
+	}()
+
+	node = node.DeepCopy()
+	node.Labels[utils.NodeInstanceIDLabel] = "myinstanceid"
+	_, err = clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+	assert.Nil(t, err)
+
+	select {
+	case workerID := <-workerIDCh:
+		assert.Equal(t, "myinstanceid", workerID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for worker ID")
+	}
+	assert.Equal(t, "myinstanceid", watcher.GetWorkerID())
+
+	select {
+	case update := <-updates:
+		assert.Equal(t, "myinstanceid", update.GetWorkerID())
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for node metadata update")
+	}
+
+	// zone change is propagated
+	node = node.DeepCopy()
+	node.Labels[utils.TopologyZoneLabel] = "newzone"
+	_, err = clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+	assert.Nil(t, err)
+	select {
+	case update := <-updates:
+		assert.Equal(t, "newzone", update.GetZone())
+		assert.Equal(t, "myinstanceid", update.GetWorkerID())
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for node metadata update")
+	}
+	assert.Equal(t, "newzone", watcher.GetZone())
+
+	// removing a required label does not replace complete metadata
+	node = node.DeepCopy()
+	delete(node.Labels, utils.NodeInstanceIDLabel)
+	_, err = clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+	assert.Nil(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, "myinstanceid", watcher.GetWorkerID())
+
+	// subscriber channel is closed when the watch stops
+	cancel()
+	select {
+	case _, ok := <-updates:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for subscriber channel to be closed")
+	}
+}
+
+func TestWatchNodeMetadataClientError(t *testing.T) {
+	logger, teardown := utils.GetTestLogger(t)
+	defer teardown()
+
+	nodeInfo := NodeInfoManager{NodeName: "mynode", KubeConfig: "/invalid/kubeconfig"}
+	watcher, err := nodeInfo.WatchNodeMetadata(context.Background(), logger)
+	assert.NotNil(t, err)
+	assert.Nil(t, watcher)
+}
@@ -0,0 +1,156 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ProviderIDType is the kind of IBM cloud node a provider ID belongs to
+type ProviderIDType string
+
+const (
+	// ProviderIDTypeVPC managed VPC gen2 worker, ibm://<account-id>/<region>/<zone>/<cluster-id>/<instance-id>
+	ProviderIDTypeVPC ProviderIDType = "vpc"
+
+	// ProviderIDTypeClassic managed classic worker, ibm://<account-id>///<cluster-id>/<worker-id>
+	ProviderIDTypeClassic ProviderIDType = "classic"
+
+	// ProviderIDTypeSatellite satellite host, ibm://<account-id>///<cluster-id>/sat-<host-id>
+	ProviderIDTypeSatellite ProviderIDType = "satellite"
+
+	// ProviderIDTypeIPI openshift IPI worker, ibm://<account-id>///<cluster-id>/<vpc-instance-id>
+	ProviderIDTypeIPI ProviderIDType = "ipi"
+)
+
+const (
+	// providerIDScheme is the scheme of all IBM cloud provider IDs
+	providerIDScheme = "ibm://"
+
+	// satelliteWorkerPrefix is the prefix of satellite host worker IDs
+	satelliteWorkerPrefix = "sat-"
+
+	// providerIDSegments is the number of segments after the scheme, account/region/zone/cluster/instance
+	providerIDSegments = 5
+)
+
+// vpcInstanceIDRegex matches VPC instance IDs i.e <zone-code>_<uuid>
+var vpcInstanceIDRegex = regexp.MustCompile(`^[0-9a-z]{4}_[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// ProviderID is the parsed form of node.Spec.ProviderID
+type ProviderID struct {
+	Type       ProviderIDType
+	AccountID  string
+	Region     string
+	Zone       string
+	ClusterID  string
+	InstanceID string
+}
+
+// ProviderIDParseError is returned when a provider ID does not match any known layout
+type ProviderIDParseError struct {
+	ProviderID string
+	Reason     string
+}
+
+// Error ...
+func (e *ProviderIDParseError) Error() string {
+	return fmt.Sprintf("Invalid provider ID '%s': %s", e.ProviderID, e.Reason)
+}
+
+// ParseProviderID parses the provider ID of VPC gen2, classic, satellite and openshift IPI nodes
+func ParseProviderID(providerID string) (*ProviderID, error) {
+	if len(providerID) == 0 {
+		return nil, &ProviderIDParseError{ProviderID: providerID, Reason: "provider ID is empty"}
+	}
+	if !strings.HasPrefix(providerID, providerIDScheme) {
+		return nil, &ProviderIDParseError{ProviderID: providerID, Reason: fmt.Sprintf("expected '%s' scheme", providerIDScheme)}
+	}
+
+	segments := strings.Split(strings.TrimPrefix(providerID, providerIDScheme), "/")
+	if len(segments) != providerIDSegments {
+		return nil, &ProviderIDParseError{ProviderID: providerID, Reason: fmt.Sprintf("expected %d path segments, found %d", providerIDSegments, len(segments))}
+	}
+	parsed := &ProviderID{
+		AccountID:  segments[0],
+		Region:     segments[1],
+		Zone:       segments[2],
+		ClusterID:  segments[3],
+		InstanceID: segments[4],
+	}
+
+	switch {
+	case len(parsed.AccountID) == 0:
+		return nil, &ProviderIDParseError{ProviderID: providerID, Reason: "account ID is empty"}
+	case len(parsed.ClusterID) == 0:
+		return nil, &ProviderIDParseError{ProviderID: providerID, Reason: "cluster ID is empty"}
+	case len(parsed.InstanceID) == 0:
+		return nil, &ProviderIDParseError{ProviderID: providerID, Reason: "instance ID is empty"}
+	}
+	for _, segment := range segments {
+		if strings.TrimSpace(segment) != segment {
+			return nil, &ProviderIDParseError{ProviderID: providerID, Reason: fmt.Sprintf("segment '%s' contains white spaces", segment)}
+		}
+	}
+
+	switch {
+	case len(parsed.Region) > 0 || len(parsed.Zone) > 0:
+		// Only VPC gen2 workers carry the region and zone, their consistency is checked by CheckTopology
+		parsed.Type = ProviderIDTypeVPC
+	case strings.HasPrefix(parsed.InstanceID, satelliteWorkerPrefix):
+		parsed.Type = ProviderIDTypeSatellite
+	case vpcInstanceIDRegex.MatchString(parsed.InstanceID):
+		parsed.Type = ProviderIDTypeIPI
+	default:
+		parsed.Type = ProviderIDTypeClassic
+	}
+	return parsed, nil
+}
+
+// CheckTopology checks the region and zone of a VPC provider ID are set together and the zone is in the region.
+// It is not part of ParseProviderID as such provider IDs were accepted before, callers only warn about it.
+func (p *ProviderID) CheckTopology() error {
+	if p.Type != ProviderIDTypeVPC {
+		return nil
+	}
+	if len(p.Region) == 0 || len(p.Zone) == 0 {
+		return &ProviderIDParseError{ProviderID: p.String(), Reason: "region and zone must be set together"}
+	}
+	if !strings.HasPrefix(p.Zone, p.Region+"-") {
+		return &ProviderIDParseError{ProviderID: p.String(), Reason: fmt.Sprintf("zone '%s' is not in region '%s'", p.Zone, p.Region)}
+	}
+	return nil
+}
+
+// fetchInstanceAndAccountID fetches instance and account ID from the provider ID in node spec. These are the
+// historical parsing rules, used for the provider IDs ParseProviderID rejects.
+func fetchInstanceAndAccountID(providerID string) (string, string) {
+	s := strings.Split(providerID, "/")
+	if len(s) != 7 {
+		return "", ""
+	}
+
+	return s[6], s[2]
+}
+
+// String returns the provider ID in the node spec format
+func (p *ProviderID) String() string {
+	return providerIDScheme + strings.Join([]string{p.AccountID, p.Region, p.Zone, p.ClusterID, p.InstanceID}, "/")
+}
@@ -0,0 +1,135 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metadata ...
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProviderID(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		providerID   string
+		expected     *ProviderID
+		expectedErr  bool
+	}{
+		{
+			testCaseName: "VPC gen2 worker",
+			providerID:   "ibm://myaccountid/us-south/us-south-1/myclusterid/0717_6b3c1c2f-8a7e-4b2b-9a8e-2f2f8d4c9b10",
+			expected: &ProviderID{Type: ProviderIDTypeVPC, AccountID: "myaccountid", Region: "us-south", Zone: "us-south-1",
+				ClusterID: "myclusterid", InstanceID: "0717_6b3c1c2f-8a7e-4b2b-9a8e-2f2f8d4c9b10"},
+		},
+		{
+			testCaseName: "Classic worker",
+			providerID:   "ibm://myaccountid///myclusterid/kube-myclusterid-default-00000123",
+			expected:     &ProviderID{Type: ProviderIDTypeClassic, AccountID: "myaccountid", ClusterID: "myclusterid", InstanceID: "kube-myclusterid-default-00000123"},
+		},
+		{
+			testCaseName: "Satellite host",
+			providerID:   "ibm://myaccountid///myclusterid/sat-virtualser-4d7fa07cd3446b1f9d8131420f7011175a8c1e14",
+			expected:     &ProviderID{Type: ProviderIDTypeSatellite, AccountID: "myaccountid", ClusterID: "myclusterid", InstanceID: "sat-virtualser-4d7fa07cd3446b1f9d8131420f7011175a8c1e14"},
+		},
+		{
+			testCaseName: "IPI worker",
+			providerID:   "ibm://myaccountid///myclusterid/0717_6b3c1c2f-8a7e-4b2b-9a8e-2f2f8d4c9b10",
+			expected:     &ProviderID{Type: ProviderIDTypeIPI, AccountID: "myaccountid", ClusterID: "myclusterid", InstanceID: "0717_6b3c1c2f-8a7e-4b2b-9a8e-2f2f8d4c9b10"},
+		},
+		{testCaseName: "Empty provider ID", providerID: "", expectedErr: true},
+		{testCaseName: "Wrong scheme", providerID: "aws://myaccountid///myclusterid/myworkerid", expectedErr: true},
+		{testCaseName: "Too few segments", providerID: "ibm://myaccountid//myclusterid/myworkerid", expectedErr: true},
+		{testCaseName: "Too many segments", providerID: "ibm://myaccountid///myclusterid/myworkerid/extra", expectedErr: true},
+		{testCaseName: "Empty account ID", providerID: "ibm:////myclusterid/myworkerid", expectedErr: true},
+		{testCaseName: "Empty cluster ID", providerID: "ibm://myaccountid////myworkerid", expectedErr: true},
+		{testCaseName: "Empty instance ID", providerID: "ibm://myaccountid///myclusterid/", expectedErr: true},
+		{
+			testCaseName: "Zone not in region",
+			providerID:   "ibm://myaccountid/us-east/us-south-1/myclusterid/myworkerid",
+			expected:     &ProviderID{Type: ProviderIDTypeVPC, AccountID: "myaccountid", Region: "us-east", Zone: "us-south-1", ClusterID: "myclusterid", InstanceID: "myworkerid"},
+		},
+		{testCaseName: "White space in segment", providerID: "ibm://myaccountid/// myclusterid/myworkerid", expectedErr: true},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			providerID, err := ParseProviderID(testcase.providerID)
+			if testcase.expectedErr {
+				_, ok := err.(*ProviderIDParseError)
+				assert.True(t, ok)
+				assert.Nil(t, providerID)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testcase.expected, providerID)
+			assert.Equal(t, testcase.providerID, providerID.String())
+		})
+	}
+}
+
+func TestCheckTopology(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		providerID   string
+		expectedErr  bool
+	}{
+		{testCaseName: "Zone in region", providerID: "ibm://myaccountid/us-south/us-south-1/myclusterid/myworkerid"},
+		{testCaseName: "Classic worker", providerID: "ibm://myaccountid///myclusterid/myworkerid"},
+		{testCaseName: "Region without zone", providerID: "ibm://myaccountid/us-south//myclusterid/myworkerid", expectedErr: true},
+		{testCaseName: "Zone without region", providerID: "ibm://myaccountid//us-south-1/myclusterid/myworkerid", expectedErr: true},
+		{testCaseName: "Zone not in region", providerID: "ibm://myaccountid/us-east/us-south-1/myclusterid/myworkerid", expectedErr: true},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			providerID, err := ParseProviderID(testcase.providerID)
+			assert.Nil(t, err)
+			assert.Equal(t, testcase.expectedErr, providerID.CheckTopology() != nil)
+		})
+	}
+}
+
+func FuzzParseProviderID(f *testing.F) {
+	seeds := []string{
+		"ibm://myaccountid/us-south/us-south-1/myclusterid/0717_6b3c1c2f-8a7e-4b2b-9a8e-2f2f8d4c9b10",
+		"ibm://myaccountid///myclusterid/kube-myclusterid-default-00000123",
+		"ibm://myaccountid///myclusterid/sat-virtualser-4d7fa07cd3446b1f9d8131420f7011175a8c1e14",
+		"ibm://myaccountid///myclusterid/",
+		"ibm:///////",
+		"ibm://",
+		"",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		providerID, err := ParseProviderID(input)
+		if err != nil {
+			if providerID != nil {
+				t.Fatalf("Expected nil provider ID on error for %q", input)
+			}
+			return
+		}
+		if providerID.AccountID == "" || providerID.ClusterID == "" || providerID.InstanceID == "" || providerID.Type == "" {
+			t.Fatalf("Incomplete provider ID parsed from %q: %+v", input, providerID)
+		}
+		if providerID.String() != input {
+			t.Fatalf("Provider ID %q does not round trip, got %q", input, providerID.String())
+		}
+	})
+}
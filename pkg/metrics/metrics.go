@@ -31,6 +31,26 @@ type FunctionLabel string
 
 var pluginNamespace string
 
+const (
+	// NodeMetadataLive node metadata is read from the API server
+	NodeMetadataLive = "live"
+
+	// NodeMetadataCached node metadata is read from the on-disk cache as the API server is unreachable
+	NodeMetadataCached = "cached"
+
+	// NodeMetadataFailed node metadata is neither read from the API server nor from the cache
+	NodeMetadataFailed = "failed"
+
+	// SessionCacheHit cached provider session is reused
+	SessionCacheHit = "hit"
+
+	// SessionCacheMiss no cached provider session, a new one is opened
+	SessionCacheMiss = "miss"
+
+	// SessionCacheRefresh cached provider session is about to expire or failed to authenticate, a new one is opened
+	SessionCacheRefresh = "refresh"
+)
+
 var (
 	/**** Metrics related to controller ****/
 	volumesCount = prometheus.NewGauge(
@@ -70,6 +90,57 @@ var (
 			Help:      "The number of plugin operation  failed due to an error.",
 		}, []string{"type"},
 	)
+
+	/**** Metrics related to node ****/
+	nodeMetadataLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: pluginNamespace,
+			Name:      "node_metadata_lookups_total",
+			Help:      "The number of node metadata lookups by source of the metadata, live, cached or failed.",
+		}, []string{"source"},
+	)
+
+	nodeMetadataRetries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: pluginNamespace,
+			Name:      "node_metadata_retries_total",
+			Help:      "The number of node lookups retried due to API server errors.",
+		},
+	)
+
+	nodeMetadataServiceFallbacks = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: pluginNamespace,
+			Name:      "node_metadata_service_fallbacks_total",
+			Help:      "The number of node metadata lookups falling back to node labels as the VPC instance metadata service failed.",
+		},
+	)
+
+	/**** Metrics related to provider ****/
+	providerSessionCache = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: pluginNamespace,
+			Name:      "provider_session_cache_total",
+			Help:      "The number of provider session lookups by result, hit, miss or refresh.",
+		}, []string{"result"},
+	)
+
+	/**** Metrics related to mount helper ****/
+	mountHelperHealthy = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: pluginNamespace,
+			Name:      "mount_helper_healthy",
+			Help:      "Whether the mount-helper-container answered the last health probes, 1 if healthy and 0 otherwise.",
+		},
+	)
+
+	mountHelperProbeFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: pluginNamespace,
+			Name:      "mount_helper_probe_failures_total",
+			Help:      "The number of failed mount-helper-container health probes.",
+		},
+	)
 )
 
 // RegisterAll registers all metrics.
@@ -80,6 +151,12 @@ func RegisterAll(namespace string) {
 	prometheus.MustRegister(functionDuration)
 	prometheus.MustRegister(functionCount)
 	prometheus.MustRegister(errorsCount)
+	prometheus.MustRegister(nodeMetadataLookups)
+	prometheus.MustRegister(nodeMetadataRetries)
+	prometheus.MustRegister(nodeMetadataServiceFallbacks)
+	prometheus.MustRegister(providerSessionCache)
+	prometheus.MustRegister(mountHelperHealthy)
+	prometheus.MustRegister(mountHelperProbeFailures)
 }
 
 // UpdateVolumeCount records number of volumes currently present in the cluster
@@ -117,3 +194,37 @@ func RegisterError(errType string, err error) {
 func RegisterFunction(label FunctionLabel) {
 	functionCount.WithLabelValues(string(label)).Add(1.0)
 }
+
+// RegisterNodeMetadataLookup records the source of the node metadata i.e NodeMetadataLive
+func RegisterNodeMetadataLookup(source string) {
+	nodeMetadataLookups.WithLabelValues(source).Add(1.0)
+}
+
+// RegisterNodeMetadataRetry records a retried node lookup
+func RegisterNodeMetadataRetry() {
+	nodeMetadataRetries.Add(1.0)
+}
+
+// RegisterNodeMetadataServiceFallback records a node metadata lookup falling back to node labels
+func RegisterNodeMetadataServiceFallback() {
+	nodeMetadataServiceFallbacks.Add(1.0)
+}
+
+// RegisterSessionCacheLookup records the result of a provider session lookup i.e SessionCacheHit
+func RegisterSessionCacheLookup(result string) {
+	providerSessionCache.WithLabelValues(result).Add(1.0)
+}
+
+// UpdateMountHelperHealth records whether the mount-helper-container is healthy
+func UpdateMountHelperHealth(healthy bool) {
+	if healthy {
+		mountHelperHealthy.Set(1)
+	} else {
+		mountHelperHealthy.Set(0)
+	}
+}
+
+// RegisterMountHelperProbeFailure records a failed mount-helper-container health probe
+func RegisterMountHelperProbeFailure() {
+	mountHelperProbeFailures.Add(1.0)
+}
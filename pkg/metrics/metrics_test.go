@@ -58,3 +58,28 @@ func TestRegisterFunction(t *testing.T) {
 	funLabel := FunctionLabel("myFunction")
 	RegisterFunction(funLabel)
 }
+
+func TestRegisterNodeMetadataLookup(t *testing.T) {
+	RegisterNodeMetadataLookup(NodeMetadataLive)
+	RegisterNodeMetadataLookup(NodeMetadataCached)
+}
+
+func TestRegisterNodeMetadataRetry(t *testing.T) {
+	RegisterNodeMetadataRetry()
+}
+
+func TestRegisterNodeMetadataServiceFallback(t *testing.T) {
+	RegisterNodeMetadataServiceFallback()
+}
+
+func TestRegisterSessionCacheLookup(t *testing.T) {
+	RegisterSessionCacheLookup(SessionCacheHit)
+	RegisterSessionCacheLookup(SessionCacheMiss)
+	RegisterSessionCacheLookup(SessionCacheRefresh)
+}
+
+func TestUpdateMountHelperHealth(t *testing.T) {
+	UpdateMountHelperHealth(true)
+	UpdateMountHelperHealth(false)
+	RegisterMountHelperProbeFailure()
+}
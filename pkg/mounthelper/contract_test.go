@@ -0,0 +1,160 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mounthelper ...
+package mounthelper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/mountmanager"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	mount "k8s.io/mount-utils"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+// commandResult is the scripted output and error of a command
+type commandResult struct {
+	output string
+	err    error
+}
+
+// fakeExec returns an executor running the scripted commands in order, the arguments of every command are
+// sent to commands
+func fakeExec(commands chan<- []string, results ...commandResult) *testingexec.FakeExec {
+	fake := &testingexec.FakeExec{}
+	for _, result := range results {
+		result := result
+		fake.CommandScript = append(fake.CommandScript, func(cmd string, args ...string) exec.Cmd {
+			commands <- append([]string{cmd}, args...)
+			return &testingexec.FakeCmd{
+				CombinedOutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) {
+					return []byte(result.output), nil, result.err
+				}},
+			}
+		})
+	}
+	return fake
+}
+
+// startServer serves server on a unix socket in a temporary directory and returns a client of it
+func startServer(t *testing.T, server *Server) *mountmanager.MountHelperClient {
+	socketPath := filepath.Join(t.TempDir(), "mount-helper.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, socketPath)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.Nil(t, <-served)
+	})
+
+	client := mountmanager.NewMountHelperClient(socketPath, 5*time.Second)
+	assert.Eventually(t, func() bool { return client.Health(context.Background()) == nil }, 5*time.Second, 10*time.Millisecond)
+	return client
+}
+
+func TestMountHelperContract(t *testing.T) {
+	commands := make(chan []string, 10)
+	server := NewServer(fakeExec(commands,
+		commandResult{},
+		commandResult{output: "mount.ibmshare: access denied by server\n", err: testingexec.FakeExitError{Status: 32}},
+		commandResult{},
+	), zap.NewNop())
+	targetPath := t.TempDir()
+	server.Mounter = mount.NewFakeMounter([]mount.MountPoint{{Path: targetPath}})
+	client := startServer(t, server)
+	ctx := context.Background()
+
+	// Mount
+	mount := mountmanager.MountRequest{MountPath: `10.240.0.5:/share"01`, TargetPath: targetPath, FsType: "ibmshare", RequestID: "req-1"}
+	response, err := client.Mount(ctx, mount)
+	assert.Nil(t, err)
+	assert.Equal(t, mountmanager.MountExitCodeSuccess, response.ExitCode())
+	assert.Equal(t, []string{"mount", "-t", "ibmshare", mount.MountPath, mount.TargetPath}, <-commands)
+	mounts, err := client.ListMounts(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []mountmanager.EITMount{{MountPath: mount.MountPath, TargetPath: mount.TargetPath, FsType: "ibmshare"}}, mounts)
+
+	// Failed mount with its debug logs
+	_, err = client.Mount(ctx, mountmanager.MountRequest{MountPath: "10.240.0.6:/share", TargetPath: "/mnt/share", FsType: "ibmshare", RequestID: "req-2"})
+	var helperErr *mountmanager.MountHelperError
+	assert.True(t, errors.As(err, &helperErr))
+	assert.Equal(t, http.StatusInternalServerError, helperErr.StatusCode)
+	assert.Equal(t, mountmanager.MountExitCodeMountFailure, helperErr.ExitCode)
+	assert.Equal(t, "mount.ibmshare: access denied by server", helperErr.Description)
+	<-commands
+	logs, err := client.DebugLogs(ctx, "req-2")
+	assert.Nil(t, err)
+	assert.Contains(t, logs, "Mounting file share")
+	assert.Contains(t, logs, "access denied by server")
+	assert.NotContains(t, logs, "req-1")
+
+	// Unmount
+	_, err = client.Unmount(ctx, mountmanager.UnmountRequest{TargetPath: mount.TargetPath, RequestID: "req-3"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"umount", mount.TargetPath}, <-commands)
+	mounts, err = client.ListMounts(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, mounts)
+
+	// Invalid requests are not run
+	testCases := []struct {
+		testCaseName string
+		call         func() error
+	}{
+		{
+			testCaseName: "Relative target path",
+			call: func() error {
+				_, err := client.Mount(ctx, mountmanager.MountRequest{MountPath: "10.240.0.5:/share", TargetPath: "mnt", FsType: "ibmshare", RequestID: "req-4"})
+				return err
+			},
+		},
+		{
+			testCaseName: "Unmount without requestID",
+			call: func() error {
+				_, err := client.Unmount(ctx, mountmanager.UnmountRequest{TargetPath: "/mnt/share"})
+				return err
+			},
+		},
+	}
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			var helperErr *mountmanager.MountHelperError
+			assert.True(t, errors.As(testcase.call(), &helperErr))
+			assert.Equal(t, http.StatusBadRequest, helperErr.StatusCode)
+			assert.Equal(t, mountmanager.MountExitCodeIncorrectInvocation, helperErr.ExitCode)
+		})
+	}
+	assert.Len(t, commands, 0)
+
+	_, err = client.DebugLogs(ctx, "req-unknown")
+	assert.True(t, errors.As(err, &helperErr))
+	assert.Equal(t, http.StatusNotFound, helperErr.StatusCode)
+
+	// The prober of the node server sees the server healthy
+	prober := mountmanager.NewMountHelperProber(client, zap.NewNop())
+	assert.Nil(t, prober.Probe(ctx))
+	assert.Nil(t, prober.Ready())
+}
@@ -0,0 +1,102 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mounthelper ...
+package mounthelper
+
+import (
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// maxLoggedRequests is the number of requests whose logs are kept, the oldest are dropped first
+	maxLoggedRequests = 256
+
+	// maxLinesPerRequest is the number of log lines kept per request, the latest lines are kept
+	maxLinesPerRequest = 200
+)
+
+// requestLogs keeps the log lines of the latest requests by requestID, they are served as debug logs
+type requestLogs struct {
+	mutex       sync.Mutex
+	maxRequests int
+	maxLines    int
+	order       []string
+	lines       map[string][]string
+}
+
+// newRequestLogs ...
+func newRequestLogs(maxRequests int, maxLines int) *requestLogs {
+	return &requestLogs{maxRequests: maxRequests, maxLines: maxLines, lines: map[string][]string{}}
+}
+
+// add appends the line to the logs of the request
+func (logs *requestLogs) add(requestID string, line string) {
+	logs.mutex.Lock()
+	defer logs.mutex.Unlock()
+	lines, found := logs.lines[requestID]
+	if !found {
+		if len(logs.order) >= logs.maxRequests {
+			delete(logs.lines, logs.order[0])
+			logs.order = logs.order[1:]
+		}
+		logs.order = append(logs.order, requestID)
+	}
+	lines = append(lines, line)
+	if len(lines) > logs.maxLines {
+		lines = lines[len(lines)-logs.maxLines:]
+	}
+	logs.lines[requestID] = lines
+}
+
+// get returns the log lines of the request, false if there is none
+func (logs *requestLogs) get(requestID string) ([]string, bool) {
+	logs.mutex.Lock()
+	defer logs.mutex.Unlock()
+	lines, found := logs.lines[requestID]
+	return append([]string(nil), lines...), found
+}
+
+// requestLogWriter writes the log entries of a request to the request logs
+type requestLogWriter struct {
+	logs      *requestLogs
+	requestID string
+}
+
+// Write ...
+func (writer requestLogWriter) Write(p []byte) (int, error) {
+	writer.logs.add(writer.requestID, strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// Sync ...
+func (writer requestLogWriter) Sync() error {
+	return nil
+}
+
+// withRequestLogs returns logger also writing every entry, including debug ones, to the logs of the request
+func withRequestLogs(logger *zap.Logger, logs *requestLogs, requestID string) *zap.Logger {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	requestCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), requestLogWriter{logs: logs, requestID: requestID}, zapcore.DebugLevel)
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, requestCore)
+	})).With(zap.String("requestID", requestID))
+}
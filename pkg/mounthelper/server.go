@@ -0,0 +1,376 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mounthelper implements the mount-helper-container server, which mounts the EIT based file shares
+// on the host for the node server. It serves the protocol of the mountmanager client on a unix socket.
+package mounthelper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/mountmanager"
+	"github.com/IBM/ibm-csi-common/pkg/utils"
+	"go.uber.org/zap"
+	mount "k8s.io/mount-utils"
+	"k8s.io/utils/exec"
+)
+
+const (
+	// DefaultMaxConcurrentRequests is the default number of mount and unmount requests run at the same time
+	DefaultMaxConcurrentRequests = 10
+
+	// DefaultCommandTimeout is the default timeout of a mount or unmount command, shorter than the client
+	// timeout so the client gets the failure
+	DefaultCommandTimeout = 2 * time.Minute
+
+	// DefaultShutdownTimeout is how long in-flight requests are given to complete on shutdown
+	DefaultShutdownTimeout = 30 * time.Second
+
+	// socketPermissions only the user running the server and the node server may connect
+	socketPermissions = 0600
+
+	// maxRequestSize limits the request bodies
+	maxRequestSize = 64 << 10
+
+	// maxRequestIDLength ...
+	maxRequestIDLength = 128
+)
+
+// Server is the mount-helper-container server. Mounts and unmounts run the commands through Exec, at most
+// MaxConcurrentRequests at a time and one at a time per target path. The log lines of every request are kept
+// by requestID and served as its debug logs. Unmounting a target path which is not mounted succeeds.
+type Server struct {
+	Exec   exec.Interface
+	Logger *zap.Logger
+	// Mounter checks whether the target path of an unmount is mounted
+	Mounter mount.Interface
+
+	// MaxConcurrentRequests DefaultMaxConcurrentRequests if zero, it must be set before the first request
+	MaxConcurrentRequests int
+	// CommandTimeout DefaultCommandTimeout if zero
+	CommandTimeout time.Duration
+	// ShutdownTimeout DefaultShutdownTimeout if zero
+	ShutdownTimeout time.Duration
+
+	initOnce    sync.Once
+	slots       chan struct{}
+	targetLocks utils.LockStore
+	logs        *requestLogs
+
+	mutex sync.Mutex
+	// mounts are the file shares mounted since the server started, by target path
+	mounts map[string]mountmanager.EITMount
+}
+
+// NewServer ...
+func NewServer(executor exec.Interface, logger *zap.Logger) *Server {
+	return &Server{
+		Exec:    executor,
+		Logger:  logger,
+		Mounter: mount.New(""),
+		logs:    newRequestLogs(maxLoggedRequests, maxLinesPerRequest),
+		mounts:  map[string]mountmanager.EITMount{},
+	}
+}
+
+// Handler returns the handler of the mount-helper-container endpoints
+func (server *Server) Handler() http.Handler {
+	server.initOnce.Do(func() {
+		limit := server.MaxConcurrentRequests
+		if limit <= 0 {
+			limit = DefaultMaxConcurrentRequests
+		}
+		server.slots = make(chan struct{}, limit)
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(mountmanager.MountHelperMountPath, server.handleMount)
+	mux.HandleFunc(mountmanager.MountHelperUnmountPath, server.handleUnmount)
+	mux.HandleFunc(mountmanager.MountHelperListMountsPath, server.handleListMounts)
+	mux.HandleFunc(mountmanager.MountHelperDebugLogsPath, server.handleDebugLogs)
+	mux.HandleFunc(mountmanager.MountHelperHealthPath, server.handleHealth)
+	return mux
+}
+
+// Serve listens on the unix socket at socketPath and serves requests until ctx is done. On shutdown the
+// in-flight requests are given ShutdownTimeout to complete before the connections are closed.
+func (server *Server) Serve(ctx context.Context, socketPath string) error {
+	listener, err := utils.ListenUnixSocket(socketPath, socketPermissions)
+	if err != nil {
+		server.Logger.Error("Failed to listen on unix socket", zap.String("socketPath", socketPath), zap.Error(err))
+		return err
+	}
+
+	httpServer := &http.Server{Handler: server.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	served := make(chan error, 1)
+	go func() {
+		served <- httpServer.Serve(listener)
+	}()
+	server.Logger.Info("Serving mount-helper-container", zap.String("socketPath", socketPath))
+
+	select {
+	case err = <-served:
+		server.Logger.Error("mount-helper-container server stopped", zap.Error(err))
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := server.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err = httpServer.Shutdown(shutdownCtx); err != nil {
+		server.Logger.Warn("Timed out waiting for in-flight requests, closing connections", zap.Duration("timeout", timeout))
+		_ = httpServer.Close()
+	}
+	server.Logger.Info("mount-helper-container server stopped")
+	return nil
+}
+
+// handleMount mounts the file share of a mountmanager.MountRequest
+func (server *Server) handleMount(w http.ResponseWriter, r *http.Request) {
+	var request mountmanager.MountRequest
+	if !server.decodeRequest(w, r, &request) {
+		return
+	}
+	logger, ok := server.validate(w, request.RequestID, validateMountRequest(request))
+	if !ok {
+		return
+	}
+	release, ok := server.acquire(w, r, logger)
+	if !ok {
+		return
+	}
+	defer release()
+	server.targetLocks.Lock(request.TargetPath)
+	defer server.targetLocks.Unlock(request.TargetPath)
+
+	logger.Info("Mounting file share", zap.String("mountPath", request.MountPath), zap.String("targetPath", request.TargetPath), zap.String("fsType", request.FsType))
+	if !server.run(w, r, logger, "mount", "-t", request.FsType, request.MountPath, request.TargetPath) {
+		return
+	}
+	server.mutex.Lock()
+	server.mounts[request.TargetPath] = mountmanager.EITMount{MountPath: request.MountPath, TargetPath: request.TargetPath, FsType: request.FsType}
+	server.mutex.Unlock()
+	logger.Info("Mounted file share", zap.String("targetPath", request.TargetPath))
+	writeResponse(w, http.StatusOK, mountmanager.MountResponse{MountExitCode: exitCode(mountmanager.MountExitCodeSuccess), Description: "Success"})
+}
+
+// handleUnmount unmounts the file share of a mountmanager.UnmountRequest
+func (server *Server) handleUnmount(w http.ResponseWriter, r *http.Request) {
+	var request mountmanager.UnmountRequest
+	if !server.decodeRequest(w, r, &request) {
+		return
+	}
+	logger, ok := server.validate(w, request.RequestID, validateUnmountRequest(request))
+	if !ok {
+		return
+	}
+	release, ok := server.acquire(w, r, logger)
+	if !ok {
+		return
+	}
+	defer release()
+	server.targetLocks.Lock(request.TargetPath)
+	defer server.targetLocks.Unlock(request.TargetPath)
+
+	notMounted, err := mount.IsNotMountPoint(server.Mounter, request.TargetPath)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warn("Failed to check whether target path is mounted, unmounting it", zap.String("targetPath", request.TargetPath), zap.Error(err))
+		notMounted = false
+	}
+	if notMounted {
+		// Already unmounted or removed, i.e the request is retried after a timeout
+		logger.Info("Target path is not mounted", zap.String("targetPath", request.TargetPath))
+	} else {
+		logger.Info("Unmounting file share", zap.String("targetPath", request.TargetPath))
+		if !server.run(w, r, logger, "umount", request.TargetPath) {
+			return
+		}
+	}
+	server.mutex.Lock()
+	delete(server.mounts, request.TargetPath)
+	server.mutex.Unlock()
+	logger.Info("Unmounted file share", zap.String("targetPath", request.TargetPath))
+	writeResponse(w, http.StatusOK, mountmanager.MountResponse{MountExitCode: exitCode(mountmanager.MountExitCodeSuccess), Description: "Success"})
+}
+
+// handleListMounts returns the file shares mounted since the server started, sorted by target path
+func (server *Server) handleListMounts(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	server.mutex.Lock()
+	mounts := make([]mountmanager.EITMount, 0, len(server.mounts))
+	for _, eitMount := range server.mounts {
+		mounts = append(mounts, eitMount)
+	}
+	server.mutex.Unlock()
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].TargetPath < mounts[j].TargetPath })
+	writeResponse(w, http.StatusOK, mountmanager.ListMountsResponse{Mounts: mounts})
+}
+
+// handleDebugLogs returns the log lines of a mountmanager.DebugLogsRequest
+func (server *Server) handleDebugLogs(w http.ResponseWriter, r *http.Request) {
+	var request mountmanager.DebugLogsRequest
+	if !server.decodeRequest(w, r, &request) {
+		return
+	}
+	if err := validateRequestID(request.RequestID); err != nil {
+		writeInvalidRequest(w, err)
+		return
+	}
+	lines, found := server.logs.get(request.RequestID)
+	if !found {
+		writeResponse(w, http.StatusNotFound, mountmanager.MountResponse{
+			MountExitCode: exitCode(mountmanager.MountExitCodeUnknown),
+			Description:   fmt.Sprintf("No debug logs for request %s", request.RequestID),
+		})
+		return
+	}
+	writeResponse(w, http.StatusOK, mountmanager.MountResponse{MountExitCode: exitCode(mountmanager.MountExitCodeSuccess), Description: strings.Join(lines, "\n")})
+}
+
+// handleHealth answers as long as the server is responsive, it does not take a request slot
+func (server *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, http.StatusOK, mountmanager.MountResponse{MountExitCode: exitCode(mountmanager.MountExitCodeSuccess), Description: "Healthy"})
+}
+
+// decodeRequest decodes the JSON body of a POST request into request, it writes the error response and returns false on failure
+func (server *Server) decodeRequest(w http.ResponseWriter, r *http.Request, request interface{}) bool {
+	if !allowMethod(w, r, http.MethodPost) {
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(request); err != nil {
+		server.Logger.Error("Failed to decode request", zap.String("path", r.URL.Path), zap.Error(err))
+		writeInvalidRequest(w, fmt.Errorf("Invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// validate returns the logger of the request, or writes the error response and returns false if err is not nil.
+// Requests with a valid requestID have their validation errors in their debug logs.
+func (server *Server) validate(w http.ResponseWriter, requestID string, err error) (*zap.Logger, bool) {
+	logger := server.Logger
+	if validateRequestID(requestID) == nil {
+		logger = withRequestLogs(server.Logger, server.logs, requestID)
+	}
+	if err != nil {
+		logger.Error("Invalid request", zap.Error(err))
+		writeInvalidRequest(w, err)
+		return nil, false
+	}
+	return logger, true
+}
+
+// acquire waits for a request slot, it writes the error response and returns false if the client gave up first
+func (server *Server) acquire(w http.ResponseWriter, r *http.Request, logger *zap.Logger) (func(), bool) {
+	select {
+	case server.slots <- struct{}{}:
+		return func() { <-server.slots }, true
+	default:
+	}
+	logger.Info("Waiting for a request slot", zap.Int("maxConcurrentRequests", cap(server.slots)))
+	select {
+	case server.slots <- struct{}{}:
+		return func() { <-server.slots }, true
+	case <-r.Context().Done():
+		logger.Error("Request cancelled while waiting for a request slot", zap.Error(r.Context().Err()))
+		writeResponse(w, http.StatusServiceUnavailable, mountmanager.MountResponse{
+			MountExitCode: exitCode(mountmanager.MountExitCodeUnknown),
+			Description:   "Too many concurrent requests",
+		})
+		return nil, false
+	}
+}
+
+// run runs the command, it writes the error response with the exit code and output and returns false on failure
+func (server *Server) run(w http.ResponseWriter, r *http.Request, logger *zap.Logger, command string, args ...string) bool {
+	timeout := server.CommandTimeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	output, err := server.Exec.CommandContext(ctx, command, args...).CombinedOutput()
+	logger.Debug("Command completed", zap.String("command", command), zap.Strings("args", args), zap.String("output", string(output)))
+	if err == nil {
+		return true
+	}
+
+	code := mountmanager.MountExitCodeUnknown
+	var exitErr exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = mountmanager.MountExitCode(exitErr.ExitStatus())
+	}
+	description := strings.TrimSpace(string(output))
+	if description == "" {
+		description = err.Error()
+	}
+	logger.Error("Command failed", zap.String("command", command), zap.Stringer("exitCode", code), zap.String("output", description), zap.Error(err))
+	writeResponse(w, http.StatusInternalServerError, mountmanager.MountResponse{MountExitCode: exitCode(code), Description: description})
+	return false
+}
+
+// allowMethod writes the error response and returns false if the request does not use method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeResponse(w, http.StatusMethodNotAllowed, mountmanager.MountResponse{
+		MountExitCode: exitCode(mountmanager.MountExitCodeUnknown),
+		Description:   fmt.Sprintf("Method %s is not allowed", r.Method),
+	})
+	return false
+}
+
+// writeInvalidRequest ...
+func writeInvalidRequest(w http.ResponseWriter, err error) {
+	writeResponse(w, http.StatusBadRequest, mountmanager.MountResponse{
+		MountExitCode: exitCode(mountmanager.MountExitCodeIncorrectInvocation),
+		Description:   err.Error(),
+	})
+}
+
+// writeResponse ...
+func writeResponse(w http.ResponseWriter, statusCode int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// exitCode is the MountExitCode field of a response
+func exitCode(code mountmanager.MountExitCode) string {
+	if code == mountmanager.MountExitCodeUnknown {
+		return ""
+	}
+	return strconv.Itoa(int(code))
+}
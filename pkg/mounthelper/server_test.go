@@ -0,0 +1,205 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mounthelper ...
+package mounthelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/mountmanager"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	mount "k8s.io/mount-utils"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestValidateMountRequest(t *testing.T) {
+	valid := mountmanager.MountRequest{MountPath: "10.240.0.5:/share", TargetPath: "/mnt/share", FsType: "ibmshare", RequestID: "5f0d8a4e-1c2b-4d3e-9f00-1a2b3c4d5e6f"}
+	testCases := []struct {
+		testCaseName string
+		update       func(request *mountmanager.MountRequest)
+		expectedErr  string
+	}{
+		{testCaseName: "Valid", update: func(request *mountmanager.MountRequest) {}},
+		{testCaseName: "IPv6 source", update: func(request *mountmanager.MountRequest) { request.MountPath = "[fd00::5]:/share" }},
+		{testCaseName: "Missing requestID", update: func(request *mountmanager.MountRequest) { request.RequestID = "" }, expectedErr: "requestID is required"},
+		{testCaseName: "RequestID with spaces", update: func(request *mountmanager.MountRequest) { request.RequestID = "req 1" }, expectedErr: "requestID 'req 1' is invalid"},
+		{testCaseName: "Source without share", update: func(request *mountmanager.MountRequest) { request.MountPath = "10.240.0.5" }, expectedErr: "mountPath"},
+		{testCaseName: "Source as an option", update: func(request *mountmanager.MountRequest) { request.MountPath = "-oremount:/share" }, expectedErr: "mountPath"},
+		{testCaseName: "Relative target", update: func(request *mountmanager.MountRequest) { request.TargetPath = "mnt/share" }, expectedErr: "targetPath"},
+		{testCaseName: "Unclean target", update: func(request *mountmanager.MountRequest) { request.TargetPath = "/mnt/../etc" }, expectedErr: "targetPath"},
+		{testCaseName: "Root target", update: func(request *mountmanager.MountRequest) { request.TargetPath = "/" }, expectedErr: "targetPath"},
+		{testCaseName: "Invalid fsType", update: func(request *mountmanager.MountRequest) { request.FsType = "nfs,ro" }, expectedErr: "fsType"},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			request := valid
+			testcase.update(&request)
+			err := validateMountRequest(request)
+			if testcase.expectedErr == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+				assert.Contains(t, err.Error(), testcase.expectedErr)
+			}
+		})
+	}
+}
+
+func TestRequestLogs(t *testing.T) {
+	logs := newRequestLogs(2, 3)
+	for i := 0; i < 5; i++ {
+		logs.add("req-1", fmt.Sprintf("line %d", i))
+	}
+	lines, found := logs.get("req-1")
+	assert.True(t, found)
+	assert.Equal(t, []string{"line 2", "line 3", "line 4"}, lines)
+
+	// The oldest request is dropped
+	logs.add("req-2", "line")
+	logs.add("req-3", "line")
+	_, found = logs.get("req-1")
+	assert.False(t, found)
+	_, found = logs.get("req-3")
+	assert.True(t, found)
+
+	// Debug entries are kept with the requestID
+	logger := withRequestLogs(zap.NewNop(), logs, "req-4")
+	logger.Debug("Command completed", zap.String("output", "mounted"))
+	lines, _ = logs.get("req-4")
+	assert.Equal(t, 1, len(lines))
+	assert.Contains(t, lines[0], "Command completed")
+	assert.Contains(t, lines[0], `"requestID": "req-4"`)
+}
+
+func TestServerMethods(t *testing.T) {
+	handler := NewServer(&testingexec.FakeExec{}, zap.NewNop()).Handler()
+	testCases := []struct {
+		testCaseName   string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{testCaseName: "Mount with GET", method: http.MethodGet, path: mountmanager.MountHelperMountPath, expectedStatus: http.StatusMethodNotAllowed},
+		{testCaseName: "List with POST", method: http.MethodPost, path: mountmanager.MountHelperListMountsPath, expectedStatus: http.StatusMethodNotAllowed},
+		{testCaseName: "Invalid JSON", method: http.MethodPost, path: mountmanager.MountHelperMountPath, body: "{", expectedStatus: http.StatusBadRequest},
+		{testCaseName: "Request too large", method: http.MethodPost, path: mountmanager.MountHelperMountPath, body: `{"mountPath":"` + strings.Repeat("a", maxRequestSize) + `"}`, expectedStatus: http.StatusBadRequest},
+		{testCaseName: "Unknown endpoint", method: http.MethodGet, path: "/api/unknown", expectedStatus: http.StatusNotFound},
+		{testCaseName: "Health", method: http.MethodGet, path: mountmanager.MountHelperHealthPath, expectedStatus: http.StatusOK},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(testcase.method, testcase.path, strings.NewReader(testcase.body)))
+			assert.Equal(t, testcase.expectedStatus, recorder.Code)
+		})
+	}
+}
+
+func TestServerConcurrencyLimit(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	blockingCommand := func(cmd string, args ...string) exec.Cmd {
+		return &testingexec.FakeCmd{
+			CombinedOutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) {
+				started <- struct{}{}
+				<-release
+				return nil, nil, nil
+			}},
+		}
+	}
+	fake := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{blockingCommand, blockingCommand}}
+	server := NewServer(fake, zap.NewNop())
+	server.MaxConcurrentRequests = 1
+	client := startServer(t, server)
+
+	// The first mount takes the only slot
+	mounted := make(chan error, 1)
+	go func() {
+		_, err := client.Mount(context.Background(), mountmanager.MountRequest{MountPath: "10.240.0.5:/share", TargetPath: "/mnt/a", FsType: "ibmshare", RequestID: "req-1"})
+		mounted <- err
+	}()
+	<-started
+
+	// The second one gives up while waiting for it
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := client.Mount(ctx, mountmanager.MountRequest{MountPath: "10.240.0.5:/share", TargetPath: "/mnt/b", FsType: "ibmshare", RequestID: "req-2"})
+	assert.NotNil(t, err)
+	assert.Eventually(t, func() bool {
+		lines, _ := server.logs.get("req-2")
+		return len(lines) == 2 && strings.Contains(lines[1], "Request cancelled while waiting for a request slot")
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, fake.CommandCalls)
+	// The health check does not need a slot
+	assert.Nil(t, client.Health(context.Background()))
+
+	close(release)
+	assert.Nil(t, <-mounted)
+}
+
+func TestServerUnmountNotMounted(t *testing.T) {
+	commands := make(chan []string, 10)
+	server := NewServer(fakeExec(commands, commandResult{}, commandResult{}), zap.NewNop())
+	mounter := mount.NewFakeMounter(nil)
+	server.Mounter = mounter
+	client := startServer(t, server)
+	ctx := context.Background()
+
+	targetPath := t.TempDir()
+	_, err := client.Mount(ctx, mountmanager.MountRequest{MountPath: "10.240.0.5:/share", TargetPath: targetPath, FsType: "ibmshare", RequestID: "req-1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "mount", (<-commands)[0])
+
+	// Target paths which are not mounted, or removed already, are unmounted without running umount
+	testCases := []struct {
+		testCaseName string
+		targetPath   string
+	}{
+		{testCaseName: "Not mounted", targetPath: targetPath},
+		{testCaseName: "Removed", targetPath: filepath.Join(targetPath, "removed")},
+	}
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			response, err := client.Unmount(ctx, mountmanager.UnmountRequest{TargetPath: testcase.targetPath, RequestID: "req-2"})
+			assert.Nil(t, err)
+			assert.Equal(t, mountmanager.MountExitCodeSuccess, response.ExitCode())
+		})
+	}
+	assert.Len(t, commands, 0)
+	mounts, err := client.ListMounts(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, mounts)
+
+	// umount is run if the mount check fails
+	mounter.MountCheckErrors = map[string]error{targetPath: errors.New("permission denied")}
+	_, err = client.Unmount(ctx, mountmanager.UnmountRequest{TargetPath: targetPath, RequestID: "req-3"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"umount", targetPath}, <-commands)
+}
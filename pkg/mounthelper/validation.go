@@ -0,0 +1,83 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mounthelper ...
+package mounthelper
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/IBM/ibm-csi-common/pkg/mountmanager"
+)
+
+var (
+	// requestIDPattern the requestID is a log key, i.e an UUID
+	requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+	// fsTypePattern i.e ibmshare or nfs4
+	fsTypePattern = regexp.MustCompile(`^[a-z0-9.]+$`)
+)
+
+// validateRequestID ...
+func validateRequestID(requestID string) error {
+	if requestID == "" {
+		return errors.New("requestID is required")
+	}
+	if len(requestID) > maxRequestIDLength || !requestIDPattern.MatchString(requestID) {
+		return fmt.Errorf("requestID '%s' is invalid", requestID)
+	}
+	return nil
+}
+
+// validateTargetPath the target path is an absolute and clean path, other than the root
+func validateTargetPath(targetPath string) error {
+	if targetPath == "" {
+		return errors.New("targetPath is required")
+	}
+	if !path.IsAbs(targetPath) || path.Clean(targetPath) != targetPath || targetPath == "/" {
+		return fmt.Errorf("targetPath '%s' must be an absolute path", targetPath)
+	}
+	return nil
+}
+
+// validateMountRequest checks the fields of the request. The commands are run without a shell, the checks
+// make sure no field is taken as an option of the command.
+func validateMountRequest(request mountmanager.MountRequest) error {
+	var errs []error
+	if err := validateRequestID(request.RequestID); err != nil {
+		errs = append(errs, err)
+	}
+	// The mount path is the NFS source, i.e 10.240.0.5:/share or [fd00::5]:/share
+	if index := strings.Index(request.MountPath, ":/"); index <= 0 || strings.HasPrefix(request.MountPath, "-") {
+		errs = append(errs, fmt.Errorf("mountPath '%s' must be <host>:<absolute path>", request.MountPath))
+	}
+	if err := validateTargetPath(request.TargetPath); err != nil {
+		errs = append(errs, err)
+	}
+	if !fsTypePattern.MatchString(request.FsType) {
+		errs = append(errs, fmt.Errorf("fsType '%s' is invalid", request.FsType))
+	}
+	return errors.Join(errs...)
+}
+
+// validateUnmountRequest ...
+func validateUnmountRequest(request mountmanager.UnmountRequest) error {
+	return errors.Join(validateRequestID(request.RequestID), validateTargetPath(request.TargetPath))
+}
@@ -18,6 +18,7 @@
 package mountmanager
 
 import (
+	"context"
 	"errors"
 
 	mount "k8s.io/mount-utils"
@@ -31,7 +32,22 @@ type FakeNodeMounter struct {
 }
 
 // MountEITBasedFileShare implements Mounter.
-func (*FakeNodeMounter) MountEITBasedFileShare(mountPath string, targetPath string, fsType string, requestID string) (string, error) {
+func (*FakeNodeMounter) MountEITBasedFileShare(ctx context.Context, mountPath string, targetPath string, fsType string, requestID string) (string, error) {
+	return "", nil
+}
+
+// UnmountEITBasedFileShare implements Mounter.
+func (*FakeNodeMounter) UnmountEITBasedFileShare(ctx context.Context, targetPath string, requestID string) (string, error) {
+	return "", nil
+}
+
+// ListEITMounts implements Mounter.
+func (*FakeNodeMounter) ListEITMounts(ctx context.Context) ([]EITMount, error) {
+	return nil, nil
+}
+
+// GetMountHelperDebugLogs implements Mounter.
+func (*FakeNodeMounter) GetMountHelperDebugLogs(ctx context.Context, requestID string) (string, error) {
 	return "", nil
 }
 
@@ -97,7 +113,22 @@ type FakeNodeMounterWithCustomActions struct {
 }
 
 // MountEITBasedFileShare implements Mounter.
-func (*FakeNodeMounterWithCustomActions) MountEITBasedFileShare(mountPath string, targetPath string, fsType string, requestID string) (string, error) {
+func (*FakeNodeMounterWithCustomActions) MountEITBasedFileShare(ctx context.Context, mountPath string, targetPath string, fsType string, requestID string) (string, error) {
+	return "", nil
+}
+
+// UnmountEITBasedFileShare implements Mounter.
+func (*FakeNodeMounterWithCustomActions) UnmountEITBasedFileShare(ctx context.Context, targetPath string, requestID string) (string, error) {
+	return "", nil
+}
+
+// ListEITMounts implements Mounter.
+func (*FakeNodeMounterWithCustomActions) ListEITMounts(ctx context.Context) ([]EITMount, error) {
+	return nil, nil
+}
+
+// GetMountHelperDebugLogs implements Mounter.
+func (*FakeNodeMounterWithCustomActions) GetMountHelperDebugLogs(ctx context.Context, requestID string) (string, error) {
 	return "", nil
 }
 
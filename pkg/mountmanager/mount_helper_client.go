@@ -0,0 +1,350 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mountmanager ...
+package mountmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MountHelperMountPath is the mount endpoint of the mount-helper-container
+	MountHelperMountPath = "/api/mount"
+	// MountHelperUnmountPath is the unmount endpoint of the mount-helper-container
+	MountHelperUnmountPath = "/api/unmount"
+	// MountHelperListMountsPath is the list mounts endpoint of the mount-helper-container
+	MountHelperListMountsPath = "/api/listMounts"
+	// MountHelperDebugLogsPath is the debug logs endpoint of the mount-helper-container
+	MountHelperDebugLogsPath = "/api/debugLogs"
+	// MountHelperHealthPath is the health endpoint of the mount-helper-container
+	MountHelperHealthPath = "/api/health"
+
+	//socket path
+	defaultSocketPath = "/tmp/mysocket.sock"
+	// base url of the requests, the host is ignored by the unix socket dialer
+	urlBase = "http://unix"
+	// mount url
+	urlMountPath = urlBase + MountHelperMountPath
+	// debug url
+	urlDebugPath = urlBase + MountHelperDebugLogsPath
+	// unmount url
+	urlUnmountPath = urlBase + MountHelperUnmountPath
+	// list mounts url
+	urlListMountsPath = urlBase + MountHelperListMountsPath
+	// health url
+	urlHealthPath = urlBase + MountHelperHealthPath
+
+	// SocketPathEnv is the environment variable with the unix socket of the mount-helper-container
+	SocketPathEnv = "SOCKET_PATH"
+
+	// DefaultMountHelperTimeout is the default timeout of a mount-helper-container request
+	DefaultMountHelperTimeout = 3 * time.Minute
+
+	// maxResponseSize limits how much of a response is read, mount output is small
+	maxResponseSize = 1 << 20
+
+	// MaxDebugLogsSize is how much of the mount-helper-container debug logs is attached to a mount error
+	MaxDebugLogsSize = 4096
+
+	// debugLogsTimeout limits fetching the debug logs after a failed mount
+	debugLogsTimeout = 30 * time.Second
+)
+
+// MountExitCode is the exit code of the mount command run by the mount-helper-container, see mount(8)
+type MountExitCode int
+
+const (
+	// MountExitCodeUnknown the exit code is missing or could not be parsed
+	MountExitCodeUnknown MountExitCode = -1
+	// MountExitCodeSuccess ...
+	MountExitCodeSuccess MountExitCode = 0
+	// MountExitCodeIncorrectInvocation incorrect invocation or permissions
+	MountExitCodeIncorrectInvocation MountExitCode = 1
+	// MountExitCodeSystemError system error, i.e out of memory or cannot fork
+	MountExitCodeSystemError MountExitCode = 2
+	// MountExitCodeInternalBug internal mount bug
+	MountExitCodeInternalBug MountExitCode = 4
+	// MountExitCodeUserInterrupt user interrupt
+	MountExitCodeUserInterrupt MountExitCode = 8
+	// MountExitCodeMtabError problems writing or locking /etc/mtab
+	MountExitCodeMtabError MountExitCode = 16
+	// MountExitCodeMountFailure mount failure
+	MountExitCodeMountFailure MountExitCode = 32
+	// MountExitCodeSomeSucceeded some mount succeeded
+	MountExitCodeSomeSucceeded MountExitCode = 64
+)
+
+// String ...
+func (code MountExitCode) String() string {
+	switch code {
+	case MountExitCodeSuccess:
+		return "Success"
+	case MountExitCodeIncorrectInvocation:
+		return "IncorrectInvocation"
+	case MountExitCodeSystemError:
+		return "SystemError"
+	case MountExitCodeInternalBug:
+		return "InternalBug"
+	case MountExitCodeUserInterrupt:
+		return "UserInterrupt"
+	case MountExitCodeMtabError:
+		return "MtabError"
+	case MountExitCodeMountFailure:
+		return "MountFailure"
+	case MountExitCodeSomeSucceeded:
+		return "SomeSucceeded"
+	case MountExitCodeUnknown:
+		return "Unknown"
+	}
+	return fmt.Sprintf("MountExitCode(%d)", int(code))
+}
+
+// ParseMountExitCode parses the MountExitCode of a response, which is either the exit code i.e "32"
+// or the error of the command i.e "exit status 32"
+func ParseMountExitCode(value string) MountExitCode {
+	value = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(value), "exit status"))
+	code, err := strconv.Atoi(value)
+	if err != nil || code < 0 {
+		return MountExitCodeUnknown
+	}
+	return MountExitCode(code)
+}
+
+// MountRequest is the body of a mount request to the mount-helper-container
+type MountRequest struct {
+	MountPath  string `json:"mountPath"`
+	TargetPath string `json:"targetPath"`
+	FsType     string `json:"fsType"`
+	RequestID  string `json:"requestID"`
+}
+
+// UnmountRequest is the body of an unmount request to the mount-helper-container
+type UnmountRequest struct {
+	TargetPath string `json:"targetPath"`
+	RequestID  string `json:"requestID"`
+}
+
+// EITMount is a file share mounted by the mount-helper-container
+type EITMount struct {
+	MountPath  string `json:"mountPath"`
+	TargetPath string `json:"targetPath"`
+	FsType     string `json:"fsType"`
+}
+
+// ListMountsResponse is the body of a list mounts response of the mount-helper-container
+type ListMountsResponse struct {
+	Mounts []EITMount `json:"Mounts"`
+}
+
+// DebugLogsRequest is the body of a debug logs request to the mount-helper-container
+type DebugLogsRequest struct {
+	RequestID string `json:"requestID"`
+}
+
+// MountResponse is the body of a mount-helper-container response
+type MountResponse struct {
+	MountExitCode string `json:"MountExitCode"`
+	Description   string `json:"Description"`
+}
+
+// ExitCode ...
+func (response *MountResponse) ExitCode() MountExitCode {
+	return ParseMountExitCode(response.MountExitCode)
+}
+
+// MountHelperError is returned when the mount-helper-container rejects a request
+type MountHelperError struct {
+	StatusCode  int
+	ExitCode    MountExitCode
+	Description string
+	// DebugLogs are the trimmed mount-helper-container logs of the request, if they could be fetched
+	DebugLogs string
+}
+
+// Error ...
+func (e *MountHelperError) Error() string {
+	return fmt.Sprintf("Response from mount-helper-container -> Exit Status Code: %s(%d) ,ResponseCode: %v", e.ExitCode, int(e.ExitCode), e.StatusCode)
+}
+
+// MountHelperClient calls the mount-helper-container over its unix socket. The connections are reused
+// across requests, the client is safe for concurrent use.
+type MountHelperClient struct {
+	socketPath string
+	timeout    time.Duration
+	httpClient *http.Client
+}
+
+// NewMountHelperClient returns a client of the mount-helper-container listening on socketPath.
+// Every request is limited to timeout, DefaultMountHelperTimeout is used if it is zero.
+func NewMountHelperClient(socketPath string, timeout time.Duration) *MountHelperClient {
+	if timeout <= 0 {
+		timeout = DefaultMountHelperTimeout
+	}
+	dialer := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+		MaxIdleConns:    4,
+		IdleConnTimeout: 90 * time.Second,
+	}
+	return &MountHelperClient{
+		socketPath: socketPath,
+		timeout:    timeout,
+		httpClient: &http.Client{Transport: transport},
+	}
+}
+
+// NewMountHelperClientFromEnv returns a client of the socket in SOCKET_PATH, defaultSocketPath if it is not set
+func NewMountHelperClientFromEnv() *MountHelperClient {
+	socketPath := os.Getenv(SocketPathEnv)
+	if socketPath == "" {
+		socketPath = defaultSocketPath
+	}
+	return NewMountHelperClient(socketPath, 0)
+}
+
+// SocketPath ...
+func (c *MountHelperClient) SocketPath() string {
+	return c.socketPath
+}
+
+// Mount asks the mount-helper-container to mount the file share. A rejected mount returns a *MountHelperError
+// with the output of the mount command as description.
+func (c *MountHelperClient) Mount(ctx context.Context, request MountRequest) (*MountResponse, error) {
+	return c.post(ctx, urlMountPath, request)
+}
+
+// Unmount asks the mount-helper-container to unmount the file share at the target path and to clean up
+// its state, i.e the stunnel process of the EIT mount
+func (c *MountHelperClient) Unmount(ctx context.Context, request UnmountRequest) (*MountResponse, error) {
+	return c.post(ctx, urlUnmountPath, request)
+}
+
+// ListMounts returns the EIT mounts set up by the mount-helper-container
+func (c *MountHelperClient) ListMounts(ctx context.Context) ([]EITMount, error) {
+	response := &ListMountsResponse{}
+	if err := c.do(ctx, http.MethodGet, urlListMountsPath, nil, response); err != nil {
+		return nil, err
+	}
+	return response.Mounts, nil
+}
+
+// Health checks the mount-helper-container answers on its socket with a successful (2xx) response
+func (c *MountHelperClient) Health(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlHealthPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("mount-helper-container health check failed with ResponseCode: %v", resp.StatusCode)
+	}
+	return nil
+}
+
+// DebugLogs returns the mount-helper-container logs of the request with requestID
+func (c *MountHelperClient) DebugLogs(ctx context.Context, requestID string) (string, error) {
+	response, err := c.post(ctx, urlDebugPath, DebugLogsRequest{RequestID: requestID})
+	if err != nil {
+		return "", err
+	}
+	return response.Description, nil
+}
+
+// TrimDebugLogs keeps the last maxSize bytes of logs, starting at a line, as the latest lines explain the failure
+func TrimDebugLogs(logs string, maxSize int) string {
+	logs = strings.TrimSpace(logs)
+	if len(logs) <= maxSize {
+		return logs
+	}
+	logs = logs[len(logs)-maxSize:]
+	if index := strings.IndexByte(logs, '\n'); index >= 0 && index < len(logs)-1 {
+		logs = logs[index+1:]
+	}
+	return "...(truncated)\n" + logs
+}
+
+// post sends the request as JSON to url and decodes the response, the request is cancelled with ctx or after the timeout
+func (c *MountHelperClient) post(ctx context.Context, url string, request interface{}) (*MountResponse, error) {
+	response := &MountResponse{}
+	if err := c.do(ctx, http.MethodPost, url, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// do sends the request, if not nil, as JSON to url and decodes the response into response. A status other than OK
+// returns a *MountHelperError decoded from the MountResponse in the body.
+func (c *MountHelperClient) do(ctx context.Context, method string, url string, request interface{}, response interface{}) error {
+	var payload io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, payload)
+	if err != nil {
+		return err
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		errorBody := &MountResponse{}
+		if err = json.Unmarshal(body, errorBody); err != nil {
+			return &MountHelperError{StatusCode: resp.StatusCode, ExitCode: MountExitCodeUnknown, Description: strings.TrimSpace(string(body))}
+		}
+		return &MountHelperError{StatusCode: resp.StatusCode, ExitCode: errorBody.ExitCode(), Description: errorBody.Description}
+	}
+	if err = json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("Invalid response from mount-helper-container: %w", err)
+	}
+	return nil
+}
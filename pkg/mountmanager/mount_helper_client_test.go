@@ -0,0 +1,262 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mountmanager ...
+package mountmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startMountHelperServer serves handler on a unix socket in a temporary directory and returns the socket path
+func startMountHelperServer(t *testing.T, handler http.Handler) string {
+	socketPath, _ := startCountingMountHelperServer(t, handler)
+	return socketPath
+}
+
+// startCountingMountHelperServer is startMountHelperServer also counting the accepted connections
+func startCountingMountHelperServer(t *testing.T, handler http.Handler) (string, *atomic.Int32) {
+	socketPath := filepath.Join(t.TempDir(), "mount-helper.sock")
+	listener, err := net.Listen("unix", socketPath)
+	assert.Nil(t, err)
+	connections := &atomic.Int32{}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return socketPath, connections
+}
+
+func TestParseMountExitCode(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		value        string
+		expectedCode MountExitCode
+	}{
+		{testCaseName: "Success", value: "0", expectedCode: MountExitCodeSuccess},
+		{testCaseName: "Exit code", value: "32", expectedCode: MountExitCodeMountFailure},
+		{testCaseName: "Command error", value: "exit status 32", expectedCode: MountExitCodeMountFailure},
+		{testCaseName: "Unlisted code", value: "exit status 3", expectedCode: MountExitCode(3)},
+		{testCaseName: "Missing", value: "", expectedCode: MountExitCodeUnknown},
+		{testCaseName: "Not a code", value: "signal: killed", expectedCode: MountExitCodeUnknown},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			assert.Equal(t, testcase.expectedCode, ParseMountExitCode(testcase.value))
+		})
+	}
+	assert.Equal(t, "MountFailure", MountExitCodeMountFailure.String())
+	assert.Equal(t, "MountExitCode(3)", MountExitCode(3).String())
+}
+
+func TestMountHelperClientMount(t *testing.T) {
+	var received MountRequest
+	socketPath, connections := startCountingMountHelperServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/mount", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+		switch received.TargetPath {
+		case "/failed":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"MountExitCode":"exit status 32","Description":"mount.ibmshare: access denied"}`))
+		case "/crashed":
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("upstream crashed\n"))
+		case "/garbled":
+			_, _ = w.Write([]byte("{"))
+		default:
+			_, _ = w.Write([]byte(`{"MountExitCode":"0","Description":"Success"}`))
+		}
+	}))
+	client := NewMountHelperClient(socketPath, time.Second)
+	assert.Equal(t, socketPath, client.SocketPath())
+
+	// Paths are encoded, not formatted into the payload
+	request := MountRequest{MountPath: `10.0.0.1:/share"with quote`, TargetPath: `/mnt/a\b`, FsType: "ibmshare", RequestID: "req-1"}
+	response, err := client.Mount(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, request, received)
+	assert.Equal(t, MountExitCodeSuccess, response.ExitCode())
+
+	testCases := []struct {
+		testCaseName        string
+		targetPath          string
+		expectedStatus      int
+		expectedCode        MountExitCode
+		expectedDescription string
+	}{
+		{
+			testCaseName:        "Mount failure",
+			targetPath:          "/failed",
+			expectedStatus:      http.StatusInternalServerError,
+			expectedCode:        MountExitCodeMountFailure,
+			expectedDescription: "mount.ibmshare: access denied",
+		},
+		{
+			testCaseName:        "Not a JSON error",
+			targetPath:          "/crashed",
+			expectedStatus:      http.StatusBadGateway,
+			expectedCode:        MountExitCodeUnknown,
+			expectedDescription: "upstream crashed",
+		},
+	}
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			_, err := client.Mount(context.Background(), MountRequest{TargetPath: testcase.targetPath})
+			var helperErr *MountHelperError
+			assert.True(t, errors.As(err, &helperErr))
+			assert.Equal(t, testcase.expectedStatus, helperErr.StatusCode)
+			assert.Equal(t, testcase.expectedCode, helperErr.ExitCode)
+			assert.Equal(t, testcase.expectedDescription, helperErr.Description)
+		})
+	}
+
+	_, err = client.Mount(context.Background(), MountRequest{TargetPath: "/garbled"})
+	assert.NotNil(t, err)
+	// The connection is reused across requests
+	assert.Equal(t, int32(1), connections.Load())
+}
+
+func TestMountHelperClientCancellation(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	socketPath := startMountHelperServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+
+	// Caller cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := NewMountHelperClient(socketPath, time.Minute).Mount(ctx, MountRequest{})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// Client timeout
+	_, err = NewMountHelperClient(socketPath, 50*time.Millisecond).Mount(context.Background(), MountRequest{})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// No server listening
+	_, err = NewMountHelperClient(filepath.Join(t.TempDir(), "missing.sock"), time.Second).Mount(context.Background(), MountRequest{})
+	assert.NotNil(t, err)
+}
+
+func TestNewMountHelperClientFromEnv(t *testing.T) {
+	t.Setenv(SocketPathEnv, "")
+	assert.Equal(t, defaultSocketPath, NewMountHelperClientFromEnv().SocketPath())
+	t.Setenv(SocketPathEnv, "/run/mount-helper.sock")
+	client := NewMountHelperClientFromEnv()
+	assert.Equal(t, "/run/mount-helper.sock", client.SocketPath())
+	assert.Equal(t, DefaultMountHelperTimeout, client.timeout)
+}
+
+func TestMountHelperClientDebugLogs(t *testing.T) {
+	socketPath := startMountHelperServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/debugLogs", r.URL.Path)
+		var request DebugLogsRequest
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		if request.RequestID == "unknown" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"MountExitCode":"","Description":"No logs for request"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"MountExitCode":"0","Description":"` + request.RequestID + `: mount.ibmshare: access denied"}`))
+	}))
+	client := NewMountHelperClient(socketPath, time.Second)
+
+	logs, err := client.DebugLogs(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "req-1: mount.ibmshare: access denied", logs)
+	_, err = client.DebugLogs(context.Background(), "unknown")
+	var helperErr *MountHelperError
+	assert.True(t, errors.As(err, &helperErr))
+	assert.Equal(t, http.StatusNotFound, helperErr.StatusCode)
+}
+
+func TestTrimDebugLogs(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		logs         string
+		maxSize      int
+		expectedLogs string
+	}{
+		{testCaseName: "Short", logs: "line 1\nline 2\n", maxSize: 20, expectedLogs: "line 1\nline 2"},
+		{testCaseName: "Keeps the latest lines", logs: "line 1\nline 2\nline 3", maxSize: 10, expectedLogs: "...(truncated)\nline 3"},
+		{testCaseName: "Single long line", logs: "0123456789abcdef", maxSize: 4, expectedLogs: "...(truncated)\ncdef"},
+		{testCaseName: "Empty", logs: "\n", maxSize: 4, expectedLogs: ""},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			assert.Equal(t, testcase.expectedLogs, TrimDebugLogs(testcase.logs, testcase.maxSize))
+		})
+	}
+}
+
+func TestMountHelperClientUnmountAndListMounts(t *testing.T) {
+	mounts := []EITMount{{MountPath: "10.0.0.1:/share", TargetPath: "/mnt/share", FsType: "ibmshare"}}
+	socketPath := startMountHelperServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/unmount":
+			assert.Equal(t, http.MethodPost, r.Method)
+			var request UnmountRequest
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+			if request.TargetPath != "/mnt/share" {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"MountExitCode":"exit status 32","Description":"umount: not mounted"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"MountExitCode":"0","Description":"Success"}`))
+		case "/api/listMounts":
+			assert.Equal(t, http.MethodGet, r.Method)
+			assert.Empty(t, r.Header.Get("Content-Type"))
+			_ = json.NewEncoder(w).Encode(ListMountsResponse{Mounts: mounts})
+		}
+	}))
+	client := NewMountHelperClient(socketPath, time.Second)
+
+	response, err := client.Unmount(context.Background(), UnmountRequest{TargetPath: "/mnt/share", RequestID: "req-1"})
+	assert.Nil(t, err)
+	assert.Equal(t, MountExitCodeSuccess, response.ExitCode())
+	_, err = client.Unmount(context.Background(), UnmountRequest{TargetPath: "/mnt/other", RequestID: "req-2"})
+	var helperErr *MountHelperError
+	assert.True(t, errors.As(err, &helperErr))
+	assert.Equal(t, "umount: not mounted", helperErr.Description)
+
+	listed, err := client.ListMounts(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, mounts, listed)
+}
@@ -0,0 +1,176 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mountmanager ...
+package mountmanager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/messages"
+	"github.com/IBM/ibm-csi-common/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultMountHelperProbeInterval is the default interval between two mount-helper-container health probes
+	DefaultMountHelperProbeInterval = 30 * time.Second
+
+	// DefaultMountHelperProbeTimeout is the default timeout of a health probe, a wedged helper does not answer in time
+	DefaultMountHelperProbeTimeout = 5 * time.Second
+
+	// DefaultMountHelperFailureThreshold is the default number of consecutive failed probes before the helper is down
+	DefaultMountHelperFailureThreshold = 2
+)
+
+// errNotProbed is the readiness error until the first probe completed
+var errNotProbed = errors.New("mount-helper-container has not been probed yet")
+
+// MountHelperProber probes the mount-helper-container in the background. It is the circuit breaker of the
+// mount requests: once FailureThreshold consecutive probes failed the helper is down, and requests fail fast
+// until a probe succeeds again.
+type MountHelperProber struct {
+	client *MountHelperClient
+	logger *zap.Logger
+
+	// Interval between two probes, DefaultMountHelperProbeInterval if zero
+	Interval time.Duration
+	// Timeout of a probe, DefaultMountHelperProbeTimeout if zero
+	Timeout time.Duration
+	// FailureThreshold is the number of consecutive failed probes to open the circuit, DefaultMountHelperFailureThreshold if zero
+	FailureThreshold int
+
+	mutex    sync.RWMutex
+	probed   bool
+	healthy  bool
+	failures int
+	lastErr  error
+}
+
+// NewMountHelperProber returns a prober of the mount-helper-container served by client
+func NewMountHelperProber(client *MountHelperClient, logger *zap.Logger) *MountHelperProber {
+	return &MountHelperProber{client: client, logger: logger}
+}
+
+// Start probes the mount-helper-container right away and then every interval, until ctx is done
+func (p *MountHelperProber) Start(ctx context.Context) {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultMountHelperProbeInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			_ = p.Probe(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Probe checks the mount-helper-container once and updates the health state, it returns the error of the check
+func (p *MountHelperProber) Probe(ctx context.Context) error {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultMountHelperProbeTimeout
+	}
+	threshold := p.FailureThreshold
+	if threshold <= 0 {
+		threshold = DefaultMountHelperFailureThreshold
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := p.client.Health(ctx)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	wasHealthy := p.isHealthy()
+	if err == nil {
+		p.failures, p.lastErr = 0, nil
+		p.healthy = true
+	} else {
+		metrics.RegisterMountHelperProbeFailure()
+		p.failures, p.lastErr = p.failures+1, err
+		// Until the threshold the helper keeps its state, it is down from the start if the first probes fail
+		p.healthy = p.healthy && p.failures < threshold
+	}
+	if p.healthy || p.failures >= threshold {
+		p.probed = true
+	}
+	metrics.UpdateMountHelperHealth(p.isHealthy())
+
+	switch {
+	case p.isHealthy() && !wasHealthy:
+		p.logger.Info("mount-helper-container is healthy again", zap.String("socketPath", p.client.SocketPath()))
+	case !p.isHealthy() && wasHealthy:
+		p.logger.Error("mount-helper-container is down, failing mount requests until it recovers", zap.String("socketPath", p.client.SocketPath()), zap.Int("failures", p.failures), zap.Error(err))
+	case err != nil:
+		p.logger.Warn("mount-helper-container health probe failed", zap.String("socketPath", p.client.SocketPath()), zap.Int("failures", p.failures), zap.Error(err))
+	}
+	return err
+}
+
+// Healthy returns false if the mount-helper-container is down, it is healthy until the probes decided otherwise
+func (p *MountHelperProber) Healthy() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.isHealthy()
+}
+
+// isHealthy is Healthy, the caller must hold the mutex
+func (p *MountHelperProber) isHealthy() bool {
+	return p.healthy || !p.probed
+}
+
+// Ready is the readiness check of the mount-helper-container, it returns nil once a probe succeeded and
+// the UnresponsiveMountHelperContainerUtility message while the helper is down
+func (p *MountHelperProber) Ready() error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if !p.probed {
+		return errNotProbed
+	}
+	if !p.healthy {
+		return p.unavailable()
+	}
+	return nil
+}
+
+// checkCircuit returns false and the UnresponsiveMountHelperContainerUtility message if the mount-helper-container is down
+func (p *MountHelperProber) checkCircuit() (messages.Message, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if !p.isHealthy() {
+		return p.unavailable(), false
+	}
+	return messages.Message{}, true
+}
+
+// unavailable returns the UnresponsiveMountHelperContainerUtility message with the last probe error, the caller must hold the mutex
+func (p *MountHelperProber) unavailable() messages.Message {
+	message := messages.InitMessages()[messages.UnresponsiveMountHelperContainerUtility]
+	if p.lastErr != nil {
+		message.BackendError = p.lastErr.Error()
+	}
+	return message
+}
@@ -0,0 +1,135 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mountmanager ...
+package mountmanager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/messages"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// startHealthServer serves the health endpoint answering with the status code in status, blocking while it is zero
+func startHealthServer(t *testing.T, status *atomic.Int32) string {
+	return startMountHelperServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		code := int(status.Load())
+		if code == 0 {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(code)
+	}))
+}
+
+func TestMountHelperClientHealth(t *testing.T) {
+	status := &atomic.Int32{}
+	client := NewMountHelperClient(startHealthServer(t, status), time.Second)
+
+	testCases := []struct {
+		testCaseName string
+		status       int
+		expectedErr  bool
+	}{
+		{testCaseName: "Healthy", status: http.StatusOK},
+		{testCaseName: "No content", status: http.StatusNoContent},
+		{testCaseName: "Not found", status: http.StatusNotFound, expectedErr: true},
+		{testCaseName: "Server error", status: http.StatusServiceUnavailable, expectedErr: true},
+		{testCaseName: "Wedged", status: 0, expectedErr: true},
+	}
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			status.Store(int32(testcase.status))
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err := client.Health(ctx)
+			assert.Equal(t, testcase.expectedErr, err != nil)
+		})
+	}
+
+	err := NewMountHelperClient(filepath.Join(t.TempDir(), "missing.sock"), time.Second).Health(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestMountHelperProber(t *testing.T) {
+	status := &atomic.Int32{}
+	status.Store(http.StatusOK)
+	prober := NewMountHelperProber(NewMountHelperClient(startHealthServer(t, status), time.Second), zap.NewNop())
+	prober.Timeout = 50 * time.Millisecond
+
+	// Healthy until the first probes decided
+	assert.True(t, prober.Healthy())
+	assert.Equal(t, errNotProbed, prober.Ready())
+	assert.Nil(t, prober.Probe(context.Background()))
+	assert.Nil(t, prober.Ready())
+
+	// Down after the consecutive failures of the threshold
+	status.Store(0)
+	assert.NotNil(t, prober.Probe(context.Background()))
+	assert.True(t, prober.Healthy())
+	_, ok := prober.checkCircuit()
+	assert.True(t, ok)
+	assert.NotNil(t, prober.Probe(context.Background()))
+	assert.False(t, prober.Healthy())
+	message, ok := prober.checkCircuit()
+	assert.False(t, ok)
+	assert.Equal(t, messages.UnresponsiveMountHelperContainerUtility, message.Code)
+	assert.Contains(t, message.BackendError, "deadline exceeded")
+	var readyErr messages.Message
+	assert.True(t, errors.As(prober.Ready(), &readyErr))
+	assert.Equal(t, messages.UnresponsiveMountHelperContainerUtility, readyErr.Code)
+
+	// Recovers with the first successful probe
+	status.Store(http.StatusOK)
+	assert.Nil(t, prober.Probe(context.Background()))
+	assert.True(t, prober.Healthy())
+	assert.Nil(t, prober.Ready())
+
+	// Down from the start
+	down := NewMountHelperProber(NewMountHelperClient(filepath.Join(t.TempDir(), "missing.sock"), time.Second), zap.NewNop())
+	down.FailureThreshold = 1
+	assert.NotNil(t, down.Probe(context.Background()))
+	assert.False(t, down.Healthy())
+	assert.NotNil(t, down.Ready())
+}
+
+func TestMountHelperProberStart(t *testing.T) {
+	status := &atomic.Int32{}
+	status.Store(http.StatusOK)
+	prober := NewMountHelperProber(NewMountHelperClient(startHealthServer(t, status), time.Second), zap.NewNop())
+	prober.Interval, prober.Timeout = 20*time.Millisecond, 50*time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	prober.Start(ctx)
+
+	assert.Eventually(t, func() bool { return prober.Ready() == nil }, 2*time.Second, 10*time.Millisecond)
+	status.Store(http.StatusInternalServerError)
+	assert.Eventually(t, func() bool { return !prober.Healthy() }, 2*time.Second, 10*time.Millisecond)
+	status.Store(http.StatusOK)
+	assert.Eventually(t, prober.Healthy, 2*time.Second, 10*time.Millisecond)
+}
@@ -22,41 +22,91 @@ package mountmanager
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net"
-	"net/http"
+	"errors"
 	"os"
 	"strings"
-	"time"
 
+	"go.uber.org/zap"
 	mount "k8s.io/mount-utils"
 )
 
-const (
-	//socket path
-	defaultSocketPath = "/tmp/mysocket.sock"
-	// mount url
-	urlMountPath = "http://unix/api/mount"
-	// debug url
-	urlDebugPath = "http://unix/api/debugLogs"
-	// http timeout
-	timeout = 3 * time.Minute
-)
-
-// MountEITBasedFileShare mounts EIT based FileShare on host system
-func (m *NodeMounter) MountEITBasedFileShare(mountPath string, targetPath string, fsType string, requestID string) (string, error) {
-	// Create payload
-	payload := fmt.Sprintf(`{"mountPath":"%s","targetPath":"%s","fsType":"%s","requestID":"%s"}`, mountPath, targetPath, fsType, requestID)
-	errResponse, err := createMountHelperContainerRequest(payload, urlMountPath)
+// MountEITBasedFileShare mounts EIT based FileShare on host system. On failure the mount-helper-container
+// debug logs of the request are fetched and appended to the returned description.
+func (m *NodeMounter) MountEITBasedFileShare(ctx context.Context, mountPath string, targetPath string, fsType string, requestID string) (string, error) {
+	if message, ok := m.checkMountHelper(); !ok {
+		return message.Description, message
+	}
+	_, err := m.getMountHelper().Mount(ctx, MountRequest{MountPath: mountPath, TargetPath: targetPath, FsType: fsType, RequestID: requestID})
+	if err != nil {
+		return m.describeFailure(ctx, err, targetPath, requestID), err
+	}
+	return "", nil
+}
 
+// UnmountEITBasedFileShare unmounts EIT based FileShare from host system, the mount-helper-container also stops
+// the stunnel of the mount. On failure the debug logs are appended to the returned description.
+func (m *NodeMounter) UnmountEITBasedFileShare(ctx context.Context, targetPath string, requestID string) (string, error) {
+	if message, ok := m.checkMountHelper(); !ok {
+		return message.Description, message
+	}
+	_, err := m.getMountHelper().Unmount(ctx, UnmountRequest{TargetPath: targetPath, RequestID: requestID})
 	if err != nil {
-		return errResponse, err
+		return m.describeFailure(ctx, err, targetPath, requestID), err
 	}
 	return "", nil
 }
 
+// ListEITMounts returns the EIT based FileShares mounted by the mount-helper-container, i.e to reconcile them after a restart
+func (m *NodeMounter) ListEITMounts(ctx context.Context) ([]EITMount, error) {
+	if message, ok := m.checkMountHelper(); !ok {
+		return nil, message
+	}
+	return m.getMountHelper().ListMounts(ctx)
+}
+
+// describeFailure returns the description of the failed mount-helper-container request. The debug logs of the
+// request are only fetched and appended if the mount-helper-container answered with a MountHelperError and
+// ctx is not done yet.
+func (m *NodeMounter) describeFailure(ctx context.Context, err error, targetPath string, requestID string) string {
+	var helperErr *MountHelperError
+	if !errors.As(err, &helperErr) {
+		return err.Error()
+	}
+
+	logger := m.getLogger().With(zap.String("requestID", requestID))
+	if ctx.Err() != nil {
+		logger.Debug("Skipped fetching mount-helper-container debug logs of cancelled request", zap.Error(ctx.Err()))
+		return helperErr.Description
+	}
+	logs, logsErr := m.fetchDebugLogs(ctx, requestID)
+	if logsErr != nil {
+		logger.Warn("Failed to fetch mount-helper-container debug logs", zap.Error(logsErr))
+		return helperErr.Description
+	}
+	if logs == "" {
+		return helperErr.Description
+	}
+	logger.Debug("mount-helper-container debug logs of failed request", zap.String("targetPath", targetPath), zap.String("debugLogs", logs))
+	helperErr.DebugLogs = logs
+	return strings.TrimSpace(helperErr.Description + "\nmount-helper-container debug logs:\n" + logs)
+}
+
+// GetMountHelperDebugLogs returns the trimmed mount-helper-container debug logs of the request with requestID
+func (m *NodeMounter) GetMountHelperDebugLogs(ctx context.Context, requestID string) (string, error) {
+	return m.fetchDebugLogs(ctx, requestID)
+}
+
+// fetchDebugLogs fetches the debug logs within debugLogsTimeout, or until ctx is done if earlier
+func (m *NodeMounter) fetchDebugLogs(ctx context.Context, requestID string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, debugLogsTimeout)
+	defer cancel()
+	logs, err := m.getMountHelper().DebugLogs(ctx, requestID)
+	if err != nil {
+		return "", err
+	}
+	return TrimDebugLogs(logs, MaxDebugLogsSize), nil
+}
+
 // MakeFile creates an empty file.
 func (m *NodeMounter) MakeFile(path string) error {
 	f, err := os.OpenFile(path, os.O_CREATE, os.FileMode(0644))
@@ -106,55 +156,3 @@ func (m *NodeMounter) Resize(devicePath string, deviceMountPath string) (bool, e
 	}
 	return true, nil
 }
-
-// createMountHelperContainerRequest creates a request to mount-helper-container server over UNIX socket and returns errors if any.
-func createMountHelperContainerRequest(payload string, url string) (string, error) {
-	// Get socket path
-	socketPath := os.Getenv("SOCKET_PATH")
-	if socketPath == "" {
-		socketPath = defaultSocketPath
-	}
-	// Create a custom dialer function for Unix socket connection
-	dialer := func(ctx context.Context, network, addr string) (net.Conn, error) {
-		return net.Dial("unix", socketPath)
-	}
-
-	// Create an HTTP client with the Unix socket transport
-	client := &http.Client{
-		Transport: &http.Transport{
-			DialContext: dialer,
-		},
-		Timeout: timeout,
-	}
-
-	//Create POST request
-	req, err := http.NewRequest("POST", url, strings.NewReader(payload))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	response, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return "", err
-	}
-
-	// Unmarshell json response
-	var responseBody struct {
-		MountExitCode   string `json:"MountExitCode"`
-		ExitDescription string `json:"Description"`
-	}
-	err = json.Unmarshal(body, &responseBody)
-	if err != nil {
-		return "", err
-	}
-
-	if response.StatusCode != http.StatusOK {
-		return responseBody.ExitDescription, fmt.Errorf("Response from mount-helper-container -> Exit Status Code: %s ,ResponseCode: %v", responseBody.MountExitCode, response.StatusCode)
-	}
-	return "", nil
-}
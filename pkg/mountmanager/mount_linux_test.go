@@ -0,0 +1,179 @@
+//go:build linux
+// +build linux
+
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mountmanager ...
+package mountmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-csi-common/pkg/messages"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMountEITBasedFileShare(t *testing.T) {
+	var debugLogs string
+	socketPath := startMountHelperServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/mount":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"MountExitCode":"exit status 32","Description":"mount.ibmshare: access denied"}`))
+		case "/api/debugLogs":
+			if debugLogs == "" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			response, _ := json.Marshal(MountResponse{MountExitCode: "0", Description: debugLogs})
+			_, _ = w.Write(response)
+		}
+	}))
+	core, observedLogs := observer.New(zap.DebugLevel)
+	mounter := &NodeMounter{SafeFormatAndMount: newSafeMounter(), MountHelper: NewMountHelperClient(socketPath, time.Second), Logger: zap.New(core)}
+
+	// Debug logs are not available
+	description, err := mounter.MountEITBasedFileShare(context.Background(), "10.0.0.1:/share", "/mnt/share", "ibmshare", "req-1")
+	assert.NotNil(t, err)
+	assert.Equal(t, "mount.ibmshare: access denied", description)
+	assert.Equal(t, 1, observedLogs.FilterMessage("Failed to fetch mount-helper-container debug logs").Len())
+
+	// Debug logs are trimmed and attached
+	debugLogs = strings.Repeat("mount.ibmshare: retrying\n", 1000) + "mount.ibmshare: access denied for 10.0.0.1"
+	description, err = mounter.MountEITBasedFileShare(context.Background(), "10.0.0.1:/share", "/mnt/share", "ibmshare", "req-1")
+	var helperErr *MountHelperError
+	assert.True(t, errors.As(err, &helperErr))
+	assert.Equal(t, MountExitCodeMountFailure, helperErr.ExitCode)
+	assert.LessOrEqual(t, len(helperErr.DebugLogs), MaxDebugLogsSize+len("...(truncated)\n"))
+	assert.True(t, strings.HasPrefix(description, "mount.ibmshare: access denied\nmount-helper-container debug logs:\n...(truncated)\n"))
+	assert.True(t, strings.HasSuffix(description, "access denied for 10.0.0.1"))
+	entries := observedLogs.FilterMessage("mount-helper-container debug logs of failed request").All()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, zap.DebugLevel, entries[0].Level)
+	assert.Equal(t, "req-1", entries[0].ContextMap()["requestID"])
+
+	// On demand
+	logs, err := mounter.GetMountHelperDebugLogs(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, helperErr.DebugLogs, logs)
+
+	// SOCKET_PATH is used without a client
+	t.Setenv(SocketPathEnv, socketPath)
+	envMounter := &NodeMounter{SafeFormatAndMount: newSafeMounter()}
+	description, err = envMounter.MountEITBasedFileShare(context.Background(), "10.0.0.1:/share", "/mnt/share", "ibmshare", "req-1")
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(description, "mount.ibmshare: access denied\n"))
+	// The client of SOCKET_PATH is created once and shared by the requests
+	assert.NotNil(t, envMounter.getMountHelper())
+	assert.Same(t, envMounter.getMountHelper(), envMounter.getMountHelper())
+}
+
+func TestUnmountAndListEITMounts(t *testing.T) {
+	debugLogsRequests := &atomic.Int32{}
+	socketPath := startMountHelperServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/unmount":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"MountExitCode":"exit status 32","Description":"umount: target is busy"}`))
+		case "/api/debugLogs":
+			debugLogsRequests.Add(1)
+			_, _ = w.Write([]byte(`{"MountExitCode":"0","Description":"stunnel still running"}`))
+		case "/api/listMounts":
+			_, _ = w.Write([]byte(`{"Mounts":[{"mountPath":"10.0.0.1:/share","targetPath":"/mnt/share","fsType":"ibmshare"}]}`))
+		}
+	}))
+	mounter := &NodeMounter{SafeFormatAndMount: newSafeMounter(), MountHelper: NewMountHelperClient(socketPath, time.Second)}
+
+	description, err := mounter.UnmountEITBasedFileShare(context.Background(), "/mnt/share", "req-1")
+	assert.NotNil(t, err)
+	assert.Equal(t, "umount: target is busy\nmount-helper-container debug logs:\nstunnel still running", description)
+
+	mounts, err := mounter.ListEITMounts(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []EITMount{{MountPath: "10.0.0.1:/share", TargetPath: "/mnt/share", FsType: "ibmshare"}}, mounts)
+
+	// Requests are cancelled with the caller's context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = mounter.ListEITMounts(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// Debug logs are only fetched for the errors of the mount-helper-container
+	description, err = mounter.UnmountEITBasedFileShare(ctx, "/mnt/share", "req-2")
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, err.Error(), description)
+	assert.Equal(t, int32(1), debugLogsRequests.Load())
+
+	// Debug logs are not fetched once the caller's context is done
+	description = mounter.describeFailure(ctx, &MountHelperError{Description: "umount: target is busy"}, "/mnt/share", "req-3")
+	assert.Equal(t, "umount: target is busy", description)
+	_, err = mounter.GetMountHelperDebugLogs(ctx, "req-3")
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, int32(1), debugLogsRequests.Load())
+
+	// Fakes
+	for _, fake := range []Mounter{NewFakeNodeMounter(), NewFakeNodeMounterWithCustomActions(nil)} {
+		_, err = fake.UnmountEITBasedFileShare(context.Background(), "/mnt/share", "req-1")
+		assert.Nil(t, err)
+		mounts, err = fake.ListEITMounts(context.Background())
+		assert.Nil(t, err)
+		assert.Empty(t, mounts)
+	}
+}
+
+func TestEITRequestsFailFastWhileMountHelperIsDown(t *testing.T) {
+	mountRequests := &atomic.Int32{}
+	socketPath := startMountHelperServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/health":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			mountRequests.Add(1)
+			_, _ = w.Write([]byte(`{"MountExitCode":"0","Description":"Success"}`))
+		}
+	}))
+	client := NewMountHelperClient(socketPath, time.Second)
+	prober := NewMountHelperProber(client, zap.NewNop())
+	prober.FailureThreshold = 1
+	mounter := &NodeMounter{SafeFormatAndMount: newSafeMounter(), MountHelper: client, Prober: prober}
+
+	// Not probed yet
+	_, err := mounter.MountEITBasedFileShare(context.Background(), "10.0.0.1:/share", "/mnt/share", "ibmshare", "req-1")
+	assert.Nil(t, err)
+
+	assert.NotNil(t, prober.Probe(context.Background()))
+	description, err := mounter.MountEITBasedFileShare(context.Background(), "10.0.0.1:/share", "/mnt/share", "ibmshare", "req-2")
+	var message messages.Message
+	assert.True(t, errors.As(err, &message))
+	assert.Equal(t, messages.UnresponsiveMountHelperContainerUtility, message.Code)
+	assert.Equal(t, message.Description, description)
+	_, err = mounter.UnmountEITBasedFileShare(context.Background(), "/mnt/share", "req-3")
+	assert.NotNil(t, err)
+	_, err = mounter.ListEITMounts(context.Background())
+	assert.True(t, errors.As(err, &message))
+	assert.Equal(t, messages.UnresponsiveMountHelperContainerUtility, message.Code)
+	assert.Equal(t, int32(1), mountRequests.Load())
+}
@@ -21,6 +21,7 @@
 package mountmanager
 
 import (
+	"context"
 	"errors"
 
 	mount "k8s.io/mount-utils"
@@ -54,6 +55,21 @@ func (m *NodeMounter) Resize(devicePath string, deviceMountPath string) (bool, e
 }
 
 // MountEITBasedFileShare ...
-func (m *NodeMounter) MountEITBasedFileShare(mountPath string, targetPath string, fsType string, requestID string) (string, error) {
+func (m *NodeMounter) MountEITBasedFileShare(ctx context.Context, mountPath string, targetPath string, fsType string, requestID string) (string, error) {
 	return "", nil
 }
+
+// UnmountEITBasedFileShare ...
+func (m *NodeMounter) UnmountEITBasedFileShare(ctx context.Context, targetPath string, requestID string) (string, error) {
+	return "", nil
+}
+
+// ListEITMounts ...
+func (m *NodeMounter) ListEITMounts(ctx context.Context) ([]EITMount, error) {
+	return nil, nil
+}
+
+// GetMountHelperDebugLogs ...
+func (m *NodeMounter) GetMountHelperDebugLogs(ctx context.Context, requestID string) (string, error) {
+	return "", errUnsupported
+}
@@ -18,6 +18,11 @@
 package mountmanager
 
 import (
+	"context"
+	"sync"
+
+	"github.com/IBM/ibm-csi-common/pkg/messages"
+	"go.uber.org/zap"
 	mount "k8s.io/mount-utils"
 	exec "k8s.io/utils/exec"
 )
@@ -28,7 +33,10 @@ type mountInterface = mount.Interface
 type Mounter interface {
 	mountInterface
 
-	MountEITBasedFileShare(mountPath string, targetPath string, fsType string, requestID string) (string, error)
+	MountEITBasedFileShare(ctx context.Context, mountPath string, targetPath string, fsType string, requestID string) (string, error)
+	UnmountEITBasedFileShare(ctx context.Context, targetPath string, requestID string) (string, error)
+	ListEITMounts(ctx context.Context) ([]EITMount, error)
+	GetMountHelperDebugLogs(ctx context.Context, requestID string) (string, error)
 	GetSafeFormatAndMount() *mount.SafeFormatAndMount
 	MakeFile(path string) error
 	MakeDir(path string) error
@@ -40,13 +48,51 @@ type Mounter interface {
 // A superstruct of SafeFormatAndMount.
 type NodeMounter struct {
 	*mount.SafeFormatAndMount
+	// MountHelper is the client of the mount-helper-container, the one of SOCKET_PATH is used if it is nil
+	MountHelper *MountHelperClient
+	// Logger receives the mount-helper-container debug logs of failed mounts, the global logger is used if it is nil
+	Logger *zap.Logger
+	// Prober, if set, fails the EIT requests fast while the mount-helper-container is down
+	Prober *MountHelperProber
+
+	// envMountHelper is the client of SOCKET_PATH used without MountHelper, created on first use
+	envMountHelper     *MountHelperClient
+	envMountHelperOnce sync.Once
 }
 
 // NewNodeMounter ...
 func NewNodeMounter() Mounter {
 	// mounter.newSafeMounter returns a SafeFormatAndMount
 	safeMounter := newSafeMounter()
-	return &NodeMounter{safeMounter}
+	return &NodeMounter{SafeFormatAndMount: safeMounter, MountHelper: NewMountHelperClientFromEnv()}
+}
+
+// getMountHelper returns MountHelper, or the client of SOCKET_PATH shared by all the requests if it is nil
+func (m *NodeMounter) getMountHelper() *MountHelperClient {
+	if m.MountHelper != nil {
+		return m.MountHelper
+	}
+	m.envMountHelperOnce.Do(func() {
+		m.envMountHelper = NewMountHelperClientFromEnv()
+	})
+	return m.envMountHelper
+}
+
+// checkMountHelper returns false and the UnresponsiveMountHelperContainerUtility message if the prober found
+// the mount-helper-container down
+func (m *NodeMounter) checkMountHelper() (messages.Message, bool) {
+	if m.Prober == nil {
+		return messages.Message{}, true
+	}
+	return m.Prober.checkCircuit()
+}
+
+// getLogger ...
+func (m *NodeMounter) getLogger() *zap.Logger {
+	if m.Logger == nil {
+		return zap.L()
+	}
+	return m.Logger
 }
 
 // NewSafeMounter ...
@@ -17,10 +17,43 @@
 // Package utils ...
 package utils
 
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
 // ClusterInfo contains the cluster information
 type ClusterInfo struct {
 	ClusterID   string `json:"cluster_id"`
 	ClusterName string `json:"cluster_name,omitempty"`
 	DataCenter  string `json:"datacenter,omitempty"`
 	CustomerID  string `json:"customer_id,omitempty"`
+	AccountID   string `json:"account_id,omitempty"`
+}
+
+// GetConfigDir returns the directory of the storage secret files i.e slclient.toml and cluster info
+func GetConfigDir() string {
+	if configDir := os.Getenv(SecretConfigPathEnv); configDir != "" {
+		return configDir
+	}
+	return DefaultSecretConfigPath
+}
+
+// GetClusterInfoPath returns the path of the cluster info file in the given config directory
+func GetClusterInfoPath(configDir string) string {
+	return filepath.Join(configDir, ClusterInfoPath)
+}
+
+// ReadClusterInfo reads and parses the cluster info file
+func ReadClusterInfo(clusterInfoPath string) (*ClusterInfo, error) {
+	data, err := os.ReadFile(filepath.Clean(clusterInfoPath))
+	if err != nil {
+		return nil, err
+	}
+	clusterInfo := &ClusterInfo{}
+	if err = json.Unmarshal(data, clusterInfo); err != nil {
+		return nil, err
+	}
+	return clusterInfo, nil
 }
@@ -0,0 +1,51 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package utils ...
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetConfigDir(t *testing.T) {
+	t.Setenv(SecretConfigPathEnv, "")
+	assert.Equal(t, DefaultSecretConfigPath, GetConfigDir())
+
+	t.Setenv(SecretConfigPathEnv, "/my/config")
+	assert.Equal(t, "/my/config", GetConfigDir())
+	assert.Equal(t, "/my/config/cluster_info/cluster-config.json", GetClusterInfoPath(GetConfigDir()))
+}
+
+func TestReadClusterInfo(t *testing.T) {
+	fixtures := filepath.Join("..", "..", "test-fixtures")
+
+	clusterInfo, err := ReadClusterInfo(GetClusterInfoPath(filepath.Join(fixtures, "valid")))
+	assert.Nil(t, err)
+	assert.Equal(t, "blhl930d0ruuc29rd523", clusterInfo.ClusterID)
+	assert.Equal(t, "t242f140687cd68a8e037b26680e0f23", clusterInfo.AccountID)
+
+	clusterInfo, err = ReadClusterInfo(GetClusterInfoPath(filepath.Join(fixtures, "invalid")))
+	assert.NotNil(t, err)
+	assert.Nil(t, clusterInfo)
+
+	clusterInfo, err = ReadClusterInfo(GetClusterInfoPath(filepath.Join(fixtures, "missing")))
+	assert.NotNil(t, err)
+	assert.Nil(t, clusterInfo)
+}
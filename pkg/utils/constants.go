@@ -58,15 +58,42 @@ const (
 	// NodeRegionLabel Region Label attached to node
 	NodeRegionLabel = "failure-domain.beta.kubernetes.io/region"
 
+	// TopologyZoneLabel GA topology Zone Label attached to node
+	TopologyZoneLabel = "topology.kubernetes.io/zone"
+
+	// TopologyRegionLabel GA topology Region Label attached to node
+	TopologyRegionLabel = "topology.kubernetes.io/region"
+
 	// NodeInstanceIDLabel VPC ID label attached to satellite host
 	NodeInstanceIDLabel = "ibm-cloud.kubernetes.io/vpc-instance-id"
 
+	// InstanceTypeLabel is the node label carrying the instance profile
+	InstanceTypeLabel = "node.kubernetes.io/instance-type"
+
+	// VPCIDLabel is the node label carrying the VPC ID of the worker
+	VPCIDLabel = "ibm-cloud.kubernetes.io/vpc-id"
+
+	// WorkerPoolLabel is the node label carrying the worker pool name
+	WorkerPoolLabel = "ibm-cloud.kubernetes.io/worker-pool-name"
+
 	// MachineTypeLabel is the node label used to identify the cluster type (upi,ipi,etc)
 	MachineTypeLabel = "ibm-cloud.kubernetes.io/machine-type"
 
 	// UPI is the expected value assigned to machine-type label on satellite cluster nodes
 	UPI = "upi"
 
+	// AccountIDLabel is the node label or annotation carrying the IBM cloud account ID on satellite cluster nodes
+	AccountIDLabel = "ibm-cloud.kubernetes.io/account-id"
+
+	// AccountIDEnv is the environment variable carrying the IBM cloud account ID
+	AccountIDEnv = "IBMCLOUD_ACCOUNT_ID"
+
+	// SecretConfigPathEnv is the environment variable carrying the directory of the storage secret files
+	SecretConfigPathEnv = "SECRET_CONFIG_PATH"
+
+	// DefaultSecretConfigPath is the directory of the storage secret files if SECRET_CONFIG_PATH is not set
+	DefaultSecretConfigPath = "/etc/storage_ibmc"
+
 	// VolumeIDLabel ...
 	VolumeIDLabel = "volumeId"
 
@@ -0,0 +1,297 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpcclient ...
+package grpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/health" // registers the client side health checking
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	// DefaultKeepaliveTime matches the minimum ping interval the grpc servers accept by default
+	DefaultKeepaliveTime = 5 * time.Minute
+
+	// DefaultKeepaliveTimeout ...
+	DefaultKeepaliveTimeout = 20 * time.Second
+
+	// DefaultMaxAttempts is the number of attempts of a call, including the first one
+	DefaultMaxAttempts = 4
+
+	// DefaultInitialBackoff ...
+	DefaultInitialBackoff = 100 * time.Millisecond
+
+	// DefaultMaxBackoff ...
+	DefaultMaxBackoff = 2 * time.Second
+
+	// maxRetryAttempts is the upper limit grpc applies to the retry policy
+	maxRetryAttempts = 5
+)
+
+// DialConfig configures a connection created by GrpcSession.GrpcDialWithConfig, the zero values use the defaults
+type DialConfig struct {
+	// Target is unix:///path/to/socket, an absolute socket path, host:port or any target supported by grpc.NewClient
+	Target string
+
+	// TLS enables TLS, or mTLS if a client certificate is set. The connection is insecure if nil.
+	TLS *TLSConfig
+
+	// KeepaliveTime is the interval of the pings sent while calls are active, negative to disable them
+	KeepaliveTime    time.Duration
+	KeepaliveTimeout time.Duration
+
+	// MaxAttempts of a call failing with one of RetryableCodes, 1 disables the retries
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// RetryableCodes defaults to Unavailable
+	RetryableCodes []codes.Code
+
+	// HealthCheck enables the client side health checking of HealthCheckService, the connection is only used
+	// while the server reports it as serving. An empty service name checks the whole server.
+	HealthCheck        bool
+	HealthCheckService string
+
+	// ConnectTimeout blocks GrpcDialWithConfig until the connection is ready or the timeout expires.
+	// The connection is established lazily on the first call if zero.
+	ConnectTimeout time.Duration
+
+	// DialOptions are appended to the options built from the config
+	DialOptions []grpc.DialOption
+}
+
+// TLSConfig configures the TLS credentials, the files are read again whenever they change so rotated
+// certificates are used for the new connections without a restart
+type TLSConfig struct {
+	// CAFile verifies the server certificate, the system roots are used if empty
+	CAFile string
+	// CertFile and KeyFile are the client certificate presented to the server for mTLS, optional
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name verified in the server certificate
+	ServerName string
+}
+
+// serviceConfig is the grpc service config, see https://github.com/grpc/grpc/blob/master/doc/service_config.md
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig,omitempty"`
+	MethodConfig        []methodConfig        `json:"methodConfig,omitempty"`
+	HealthCheckConfig   *healthCheckConfig    `json:"healthCheckConfig,omitempty"`
+}
+
+type methodConfig struct {
+	Name        []struct{}   `json:"name"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+type healthCheckConfig struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// target returns the grpc target, absolute paths are unix sockets
+func (config *DialConfig) target() (string, error) {
+	target := strings.TrimSpace(config.Target)
+	if target == "" {
+		return "", errors.New("grpc target is not set")
+	}
+	if strings.HasPrefix(target, "/") {
+		return "unix://" + target, nil
+	}
+	return target, nil
+}
+
+// serviceConfig builds the retry policy and the health checking of the service config
+func (config *DialConfig) serviceConfig() (string, error) {
+	maxAttempts := config.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	if maxAttempts < 0 || maxAttempts > maxRetryAttempts {
+		return "", fmt.Errorf("grpc max attempts must be between 1 and %d, got %d", maxRetryAttempts, maxAttempts)
+	}
+
+	var svcConfig serviceConfig
+	if maxAttempts > 1 {
+		initialBackoff, maxBackoff := config.InitialBackoff, config.MaxBackoff
+		if initialBackoff <= 0 {
+			initialBackoff = DefaultInitialBackoff
+		}
+		if maxBackoff <= 0 {
+			maxBackoff = DefaultMaxBackoff
+		}
+		retryableCodes := config.RetryableCodes
+		if len(retryableCodes) == 0 {
+			retryableCodes = []codes.Code{codes.Unavailable}
+		}
+		policy := &retryPolicy{
+			MaxAttempts:       maxAttempts,
+			InitialBackoff:    fmt.Sprintf("%gs", initialBackoff.Seconds()),
+			MaxBackoff:        fmt.Sprintf("%gs", maxBackoff.Seconds()),
+			BackoffMultiplier: 2,
+		}
+		for _, code := range retryableCodes {
+			// Service config uses the canonical upper case names i.e UNAVAILABLE
+			name, err := toServiceConfigCode(code)
+			if err != nil {
+				return "", err
+			}
+			policy.RetryableStatusCodes = append(policy.RetryableStatusCodes, name)
+		}
+		svcConfig.MethodConfig = []methodConfig{{Name: []struct{}{{}}, RetryPolicy: policy}}
+	}
+	if config.HealthCheck {
+		// pick_first does not support health checking
+		svcConfig.LoadBalancingConfig = []map[string]struct{}{{"round_robin": {}}}
+		svcConfig.HealthCheckConfig = &healthCheckConfig{ServiceName: config.HealthCheckService}
+	}
+	data, err := json.Marshal(svcConfig)
+	return string(data), err
+}
+
+// serviceConfigCodes are the canonical names of the codes in the service config
+var serviceConfigCodes = map[codes.Code]string{
+	codes.OK:                 "OK",
+	codes.Canceled:           "CANCELLED",
+	codes.Unknown:            "UNKNOWN",
+	codes.InvalidArgument:    "INVALID_ARGUMENT",
+	codes.DeadlineExceeded:   "DEADLINE_EXCEEDED",
+	codes.NotFound:           "NOT_FOUND",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.PermissionDenied:   "PERMISSION_DENIED",
+	codes.ResourceExhausted:  "RESOURCE_EXHAUSTED",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.Aborted:            "ABORTED",
+	codes.OutOfRange:         "OUT_OF_RANGE",
+	codes.Unimplemented:      "UNIMPLEMENTED",
+	codes.Internal:           "INTERNAL",
+	codes.Unavailable:        "UNAVAILABLE",
+	codes.DataLoss:           "DATA_LOSS",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+}
+
+// toServiceConfigCode returns the canonical name of the code i.e DEADLINE_EXCEEDED, an error if the code is unknown
+func toServiceConfigCode(code codes.Code) (string, error) {
+	name, ok := serviceConfigCodes[code]
+	if !ok {
+		return "", fmt.Errorf("Unknown retryable status code %d", code)
+	}
+	return name, nil
+}
+
+// dialOptions builds the grpc dial options from the config
+func (config *DialConfig) dialOptions() ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+	if config.TLS != nil {
+		tlsConfig, err := config.TLS.newReloadingConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	if config.KeepaliveTime >= 0 {
+		params := keepalive.ClientParameters{Time: config.KeepaliveTime, Timeout: config.KeepaliveTimeout}
+		if params.Time == 0 {
+			params.Time = DefaultKeepaliveTime
+		}
+		if params.Timeout <= 0 {
+			params.Timeout = DefaultKeepaliveTimeout
+		}
+		opts = append(opts, grpc.WithKeepaliveParams(params))
+	}
+
+	svcConfig, err := config.serviceConfig()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, grpc.WithDefaultServiceConfig(svcConfig))
+	return append(opts, config.DialOptions...), nil
+}
+
+// ConnectWithConfig creates a client connection configured by config. If ConnectTimeout is set, it waits for
+// the connection to be ready until the timeout expires or ctx is done, the connection is closed on failure.
+func (c *GrpcSes) ConnectWithConfig(ctx context.Context, config DialConfig) (*grpc.ClientConn, error) {
+	target, err := config.target()
+	if err != nil {
+		return nil, err
+	}
+	opts, err := config.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ConnectTimeout > 0 {
+		if err = waitForReady(ctx, conn, config.ConnectTimeout); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("grpc connection to %s is not ready: %w", target, err)
+		}
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+// waitForReady starts connecting and waits for the connection to be ready
+func waitForReady(ctx context.Context, conn *grpc.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Idle:
+			conn.Connect()
+		case connectivity.Shutdown:
+			return errors.New("connection closed")
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("%w, last state %s", ctx.Err(), state)
+		}
+	}
+}
+
+// GrpcDialWithConfig establishes a grpc-client client server connection configured by config
+func (c *GrpcSes) GrpcDialWithConfig(ctx context.Context, config DialConfig) (*grpc.ClientConn, error) {
+	return c.ConnectWithConfig(ctx, config)
+}
@@ -0,0 +1,311 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// flakyHealthServer fails the first calls with Unavailable and records the client certificate name
+type flakyHealthServer struct {
+	healthpb.UnimplementedHealthServer
+
+	mutex    sync.Mutex
+	failures int
+	calls    int
+	clientCN string
+}
+
+func (s *flakyHealthServer) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls++
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+			s.clientCN = tlsInfo.State.PeerCertificates[0].Subject.CommonName
+		}
+	}
+	if s.calls <= s.failures {
+		return nil, status.Error(codes.Unavailable, "not yet")
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+// startServer serves the health service on a temporary unix socket and returns the socket path
+func startServer(t *testing.T, service healthpb.HealthServer, opts ...grpc.ServerOption) string {
+	socketPath := filepath.Join(t.TempDir(), "grpc.sock")
+	listener, err := net.Listen("unix", socketPath)
+	assert.Nil(t, err)
+	server := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(server, service)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return socketPath
+}
+
+func TestServiceConfig(t *testing.T) {
+	testCases := []struct {
+		testCaseName   string
+		config         DialConfig
+		expectedConfig string
+		expectedErr    bool
+	}{
+		{
+			testCaseName:   "Defaults",
+			expectedConfig: `{"methodConfig":[{"name":[{}],"retryPolicy":{"maxAttempts":4,"initialBackoff":"0.1s","maxBackoff":"2s","backoffMultiplier":2,"retryableStatusCodes":["UNAVAILABLE"]}}]}`,
+		},
+		{
+			testCaseName:   "Retries disabled with health check",
+			config:         DialConfig{MaxAttempts: 1, HealthCheck: true, HealthCheckService: "provider"},
+			expectedConfig: `{"loadBalancingConfig":[{"round_robin":{}}],"healthCheckConfig":{"serviceName":"provider"}}`,
+		},
+		{
+			testCaseName:   "Retry policy",
+			config:         DialConfig{MaxAttempts: 2, InitialBackoff: 50 * time.Millisecond, MaxBackoff: time.Minute, RetryableCodes: []codes.Code{codes.DeadlineExceeded, codes.ResourceExhausted}},
+			expectedConfig: `{"methodConfig":[{"name":[{}],"retryPolicy":{"maxAttempts":2,"initialBackoff":"0.05s","maxBackoff":"60s","backoffMultiplier":2,"retryableStatusCodes":["DEADLINE_EXCEEDED","RESOURCE_EXHAUSTED"]}}]}`,
+		},
+		{
+			testCaseName: "Too many attempts",
+			config:       DialConfig{MaxAttempts: 10},
+			expectedErr:  true,
+		},
+		{
+			testCaseName: "Unknown code",
+			config:       DialConfig{RetryableCodes: []codes.Code{codes.Code(42)}},
+			expectedErr:  true,
+		},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			svcConfig, err := testcase.config.serviceConfig()
+			if testcase.expectedErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.JSONEq(t, testcase.expectedConfig, svcConfig)
+		})
+	}
+}
+
+func TestConnectWithConfig(t *testing.T) {
+	service := &flakyHealthServer{failures: 2}
+	socketPath := startServer(t, service)
+
+	// Absolute path is a unix socket, unavailable calls are retried
+	conn, err := (&ConnObjFactory{}).NewGrpcSession().GrpcDialWithConfig(context.Background(), DialConfig{Target: socketPath, ConnectTimeout: 5 * time.Second, InitialBackoff: time.Millisecond})
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, service.calls)
+
+	// Retries disabled
+	service.calls = 0
+	session := &GrpcSes{}
+	conn, err = session.ConnectWithConfig(context.Background(), DialConfig{Target: "unix://" + socketPath, MaxAttempts: 1})
+	assert.Nil(t, err)
+	defer session.Close()
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 1, service.calls)
+
+	_, err = session.ConnectWithConfig(context.Background(), DialConfig{})
+	assert.NotNil(t, err)
+}
+
+func TestConnectWithConfigTimeout(t *testing.T) {
+	missingSocket := filepath.Join(t.TempDir(), "missing.sock")
+	start := time.Now()
+	_, err := (&GrpcSes{}).ConnectWithConfig(context.Background(), DialConfig{Target: missingSocket, ConnectTimeout: 200 * time.Millisecond})
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = (&GrpcSes{}).ConnectWithConfig(ctx, DialConfig{Target: missingSocket, ConnectTimeout: time.Minute})
+	assert.NotNil(t, err)
+}
+
+func TestConnectWithConfigHealthCheck(t *testing.T) {
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("provider", healthpb.HealthCheckResponse_NOT_SERVING)
+	socketPath := startServer(t, healthServer)
+
+	config := DialConfig{Target: socketPath, HealthCheck: true, HealthCheckService: "provider", ConnectTimeout: 300 * time.Millisecond}
+	_, err := (&GrpcSes{}).ConnectWithConfig(context.Background(), config)
+	assert.NotNil(t, err)
+
+	healthServer.SetServingStatus("provider", healthpb.HealthCheckResponse_SERVING)
+	config.ConnectTimeout = 5 * time.Second
+	conn, err := (&GrpcSes{}).ConnectWithConfig(context.Background(), config)
+	assert.Nil(t, err)
+	assert.Nil(t, conn.Close())
+}
+
+func TestConnectWithConfigMTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newCertificate(t, "test-ca", nil, nil)
+	writePEM(t, filepath.Join(dir, "ca.crt"), "CERTIFICATE", ca.Raw)
+	serverCert, serverKey := newCertificate(t, "localhost", ca, caKey)
+	clientCertPath, clientKeyPath := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	writeClientCert := func(name string, modTime time.Time) {
+		cert, key := newCertificate(t, name, ca, caKey)
+		writePEM(t, clientCertPath, "CERTIFICATE", cert.Raw)
+		keyBytes, err := x509.MarshalECPrivateKey(key)
+		assert.Nil(t, err)
+		writePEM(t, clientKeyPath, "EC PRIVATE KEY", keyBytes)
+		assert.Nil(t, os.Chtimes(clientCertPath, modTime, modTime))
+		assert.Nil(t, os.Chtimes(clientKeyPath, modTime, modTime))
+	}
+	writeClientCert("client-1", time.Now().Add(-time.Hour))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	serverTLS := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		ClientCAs:    roots,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	service := &flakyHealthServer{}
+	socketPath := startServer(t, service, grpc.Creds(credentials.NewTLS(serverTLS)))
+
+	check := func(tlsConfig *TLSConfig) error {
+		conn, err := (&GrpcSes{}).ConnectWithConfig(context.Background(), DialConfig{Target: socketPath, TLS: tlsConfig, MaxAttempts: 1})
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		return err
+	}
+	tlsConfig := &TLSConfig{CAFile: filepath.Join(dir, "ca.crt"), CertFile: clientCertPath, KeyFile: clientKeyPath}
+	assert.Nil(t, check(tlsConfig))
+	assert.Equal(t, "client-1", service.clientCN)
+
+	// Rotated client certificate is used without creating a new config
+	writeClientCert("client-2", time.Now())
+	assert.Nil(t, check(tlsConfig))
+	assert.Equal(t, "client-2", service.clientCN)
+
+	// Server requires a client certificate
+	assert.NotNil(t, check(&TLSConfig{CAFile: filepath.Join(dir, "ca.crt")}))
+	// Server certificate is not trusted
+	assert.NotNil(t, check(&TLSConfig{CertFile: clientCertPath, KeyFile: clientKeyPath}))
+	// Server certificate does not match the name
+	assert.NotNil(t, check(&TLSConfig{CAFile: filepath.Join(dir, "ca.crt"), CertFile: clientCertPath, KeyFile: clientKeyPath, ServerName: "other"}))
+	// Invalid configurations
+	assert.NotNil(t, check(&TLSConfig{CertFile: clientCertPath}))
+	assert.NotNil(t, check(&TLSConfig{CAFile: filepath.Join(dir, "missing.crt")}))
+}
+
+// newCertificate creates a certificate signed by parent, or a self signed CA if parent is nil
+func newCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert, key
+}
+
+// writePEM ...
+func writePEM(t *testing.T, path string, blockType string, data []byte) {
+	assert.Nil(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0600))
+}
+
+func TestToServiceConfigCode(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		code         codes.Code
+		expectedName string
+	}{
+		{testCaseName: "OK", code: codes.OK, expectedName: "OK"},
+		{testCaseName: "Canceled", code: codes.Canceled, expectedName: "CANCELLED"},
+		{testCaseName: "Unknown", code: codes.Unknown, expectedName: "UNKNOWN"},
+		{testCaseName: "InvalidArgument", code: codes.InvalidArgument, expectedName: "INVALID_ARGUMENT"},
+		{testCaseName: "DeadlineExceeded", code: codes.DeadlineExceeded, expectedName: "DEADLINE_EXCEEDED"},
+		{testCaseName: "NotFound", code: codes.NotFound, expectedName: "NOT_FOUND"},
+		{testCaseName: "AlreadyExists", code: codes.AlreadyExists, expectedName: "ALREADY_EXISTS"},
+		{testCaseName: "PermissionDenied", code: codes.PermissionDenied, expectedName: "PERMISSION_DENIED"},
+		{testCaseName: "ResourceExhausted", code: codes.ResourceExhausted, expectedName: "RESOURCE_EXHAUSTED"},
+		{testCaseName: "FailedPrecondition", code: codes.FailedPrecondition, expectedName: "FAILED_PRECONDITION"},
+		{testCaseName: "Aborted", code: codes.Aborted, expectedName: "ABORTED"},
+		{testCaseName: "OutOfRange", code: codes.OutOfRange, expectedName: "OUT_OF_RANGE"},
+		{testCaseName: "Unimplemented", code: codes.Unimplemented, expectedName: "UNIMPLEMENTED"},
+		{testCaseName: "Internal", code: codes.Internal, expectedName: "INTERNAL"},
+		{testCaseName: "Unavailable", code: codes.Unavailable, expectedName: "UNAVAILABLE"},
+		{testCaseName: "DataLoss", code: codes.DataLoss, expectedName: "DATA_LOSS"},
+		{testCaseName: "Unauthenticated", code: codes.Unauthenticated, expectedName: "UNAUTHENTICATED"},
+	}
+
+	for _, testcase := range testCases {
+		t.Run(testcase.testCaseName, func(t *testing.T) {
+			name, err := toServiceConfigCode(testcase.code)
+			assert.Nil(t, err)
+			assert.Equal(t, testcase.expectedName, name)
+			// grpc parses the name back to the code
+			var parsed codes.Code
+			assert.Nil(t, json.Unmarshal([]byte(`"`+name+`"`), &parsed))
+			assert.Equal(t, testcase.code, parsed)
+		})
+	}
+	assert.Len(t, testCases, len(serviceConfigCodes))
+}
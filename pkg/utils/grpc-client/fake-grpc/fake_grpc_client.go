@@ -18,13 +18,25 @@
 package fakegrpc
 
 import (
+	"context"
 	"errors"
+	"net"
+	"sync"
+	"time"
 
 	grpcClient "github.com/IBM/ibm-csi-common/pkg/utils/grpc-client"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 )
 
-// FakeGrpcSessionFactory implements grpcClient.GrpcSessionFactory
+const bufSize = 1024 * 1024
+
+// FakeGrpcSessionFactory implements grpcClient.GrpcSessionFactory. The sessions connect to an in-process
+// bufconn server serving the registered services, whatever the target is. Services must be registered
+// before the first dial, i.e apiKeyProvider.RegisterAPIKeyProviderServer(factory, fakeServer).
 //
 //nolint:golint
 type FakeGrpcSessionFactory struct {
@@ -34,9 +46,30 @@ type FakeGrpcSessionFactory struct {
 	FailGrpcConnectionErr string
 	//PassGrpcConnection ...
 	PassGrpcConnection bool
+
+	mutex    sync.Mutex
+	services []service
+	server   *grpc.Server
+	listener *bufconn.Listener
+	latency  map[string]time.Duration
+	failures map[string]*failure
+	calls    map[string]int
+}
+
+// service is a registered service implementation
+type service struct {
+	desc *grpc.ServiceDesc
+	impl interface{}
+}
+
+// failure is an error code returned by a method, count times or until cleared if count is 0
+type failure struct {
+	code  codes.Code
+	count int
 }
 
 var _ grpcClient.GrpcSessionFactory = (*FakeGrpcSessionFactory)(nil)
+var _ grpc.ServiceRegistrar = (*FakeGrpcSessionFactory)(nil)
 
 // fakeGrpcSession implements grpcClient.GrpcSession
 type fakeGrpcSession struct {
@@ -50,10 +83,139 @@ func (f *FakeGrpcSessionFactory) NewGrpcSession() grpcClient.GrpcSession {
 	}
 }
 
-// GrpcDial method creates a fake-grpc-client connection
-func (c *fakeGrpcSession) GrpcDial(clientConn grpcClient.ClientConn, target string, opts ...grpc.DialOption) (conn *grpc.ClientConn, err error) {
+// RegisterService registers a service implementation on the in-process server, it panics once the server started
+func (f *FakeGrpcSessionFactory) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.server != nil {
+		panic("fakegrpc: services must be registered before the first dial")
+	}
+	f.services = append(f.services, service{desc: desc, impl: impl})
+}
+
+// SetLatency delays every call of the method, fullMethod is i.e /provider.APIKeyProvider/GetVPCAPIKey
+func (f *FakeGrpcSessionFactory) SetLatency(fullMethod string, latency time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.latency == nil {
+		f.latency = map[string]time.Duration{}
+	}
+	f.latency[fullMethod] = latency
+}
+
+// InjectError makes the next count calls of the method fail with code, or all of them until cleared if count is 0
+func (f *FakeGrpcSessionFactory) InjectError(fullMethod string, code codes.Code, count int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.failures == nil {
+		f.failures = map[string]*failure{}
+	}
+	f.failures[fullMethod] = &failure{code: code, count: count}
+}
+
+// ClearErrors removes the errors injected for the method
+func (f *FakeGrpcSessionFactory) ClearErrors(fullMethod string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.failures, fullMethod)
+}
+
+// CallCount returns how many times the method was called, including the failed calls
+func (f *FakeGrpcSessionFactory) CallCount(fullMethod string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.calls[fullMethod]
+}
+
+// Close stops the in-process server
+func (f *FakeGrpcSessionFactory) Close() {
+	f.mutex.Lock()
+	server := f.server
+	f.mutex.Unlock()
+	if server != nil {
+		server.Stop()
+	}
+}
+
+// intercept counts the call, then applies the latency and the injected error of the method
+func (f *FakeGrpcSessionFactory) intercept(ctx context.Context, fullMethod string) error {
+	f.mutex.Lock()
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	f.calls[fullMethod]++
+	latency := f.latency[fullMethod]
+	var err error
+	if injected, ok := f.failures[fullMethod]; ok {
+		err = status.Errorf(injected.code, "fakegrpc: injected error for %s", fullMethod)
+		if injected.count > 0 {
+			injected.count--
+			if injected.count == 0 {
+				delete(f.failures, fullMethod)
+			}
+		}
+	}
+	f.mutex.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return err
+}
+
+// start starts the in-process server with the registered services on the first call
+func (f *FakeGrpcSessionFactory) start() *bufconn.Listener {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.server != nil {
+		return f.listener
+	}
+	f.listener = bufconn.Listen(bufSize)
+	f.server = grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := f.intercept(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := f.intercept(stream.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	for _, registered := range f.services {
+		f.server.RegisterService(registered.desc, registered.impl)
+	}
+	server, listener := f.server, f.listener
+	go func() { _ = server.Serve(listener) }()
+	return f.listener
+}
+
+// connect returns a client connection to the in-process server, the options of the caller can not change the dialer
+func (c *fakeGrpcSession) connect(opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	if c.factory.FailGrpcConnection {
-		return conn, errors.New(c.factory.FailGrpcConnectionErr)
+		return nil, errors.New(c.factory.FailGrpcConnectionErr)
 	}
-	return conn, err
+	listener := c.factory.start()
+	opts = append(opts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	return grpc.NewClient("passthrough:///bufnet", opts...)
+}
+
+// GrpcDial method creates a fake-grpc-client connection
+func (c *fakeGrpcSession) GrpcDial(clientConn grpcClient.ClientConn, target string, opts ...grpc.DialOption) (conn *grpc.ClientConn, err error) {
+	return c.connect(opts...)
+}
+
+// GrpcDialWithConfig method creates a fake-grpc-client connection, the target and TLS settings are ignored
+func (c *fakeGrpcSession) GrpcDialWithConfig(ctx context.Context, config grpcClient.DialConfig) (conn *grpc.ClientConn, err error) {
+	return c.connect(config.DialOptions...)
 }
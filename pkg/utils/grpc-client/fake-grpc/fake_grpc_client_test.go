@@ -0,0 +1,118 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fakegrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	grpcClient "github.com/IBM/ibm-csi-common/pkg/utils/grpc-client"
+	apiKeyProvider "github.com/IBM/ibm-csi-common/provider"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAPIKeyServer ...
+type fakeAPIKeyServer struct {
+	apiKeyProvider.UnimplementedAPIKeyProviderServer
+}
+
+func (s *fakeAPIKeyServer) GetVPCAPIKey(ctx context.Context, in *apiKeyProvider.Provider) (*apiKeyProvider.APIKey, error) {
+	return &apiKeyProvider.APIKey{Apikey: "vpc-key"}, nil
+}
+
+func (s *fakeAPIKeyServer) WatchAPIKey(in *apiKeyProvider.APIKeyRequest, stream apiKeyProvider.APIKeyProvider_WatchAPIKeyServer) error {
+	return stream.Send(&apiKeyProvider.APIKey{Apikey: "vpc-key"})
+}
+
+func TestFakeGrpcSession(t *testing.T) {
+	factory := &FakeGrpcSessionFactory{}
+	apiKeyProvider.RegisterAPIKeyProviderServer(factory, &fakeAPIKeyServer{})
+	defer factory.Close()
+
+	// Both dial paths connect to the in-process server whatever the target is
+	conn, err := factory.NewGrpcSession().GrpcDial(&grpcClient.GrpcSes{}, "unix:///tmp/missing.sock", grpc.WithBlock()) //nolint:staticcheck
+	assert.Nil(t, err)
+	defer conn.Close()
+	configConn, err := factory.NewGrpcSession().GrpcDialWithConfig(context.Background(), grpcClient.DialConfig{Target: "/tmp/missing.sock"})
+	assert.Nil(t, err)
+	defer configConn.Close()
+
+	for _, cc := range []*grpc.ClientConn{conn, configConn} {
+		apiKey, err := apiKeyProvider.NewAPIKeyProviderClient(cc).GetVPCAPIKey(context.Background(), &apiKeyProvider.Provider{})
+		assert.Nil(t, err)
+		assert.Equal(t, "vpc-key", apiKey.GetApikey())
+	}
+	assert.Equal(t, 2, factory.CallCount(apiKeyProvider.APIKeyProvider_GetVPCAPIKey_FullMethodName))
+
+	// Unregistered services and methods
+	_, err = apiKeyProvider.NewAPIKeyProviderClient(conn).GetContainerAPIKey(context.Background(), &apiKeyProvider.Provider{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	assert.Panics(t, func() { apiKeyProvider.RegisterAPIKeyProviderServer(factory, &fakeAPIKeyServer{}) })
+}
+
+func TestFakeGrpcSessionInjection(t *testing.T) {
+	factory := &FakeGrpcSessionFactory{}
+	apiKeyProvider.RegisterAPIKeyProviderServer(factory, &fakeAPIKeyServer{})
+	defer factory.Close()
+	conn, err := factory.NewGrpcSession().GrpcDialWithConfig(context.Background(), grpcClient.DialConfig{})
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := apiKeyProvider.NewAPIKeyProviderClient(conn)
+
+	// Error injected for the next two calls
+	factory.InjectError(apiKeyProvider.APIKeyProvider_GetVPCAPIKey_FullMethodName, codes.Unavailable, 2)
+	for i := 0; i < 2; i++ {
+		_, err = client.GetVPCAPIKey(context.Background(), &apiKeyProvider.Provider{})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	}
+	_, err = client.GetVPCAPIKey(context.Background(), &apiKeyProvider.Provider{})
+	assert.Nil(t, err)
+
+	// Error injected until cleared, on a streaming method
+	factory.InjectError(apiKeyProvider.APIKeyProvider_WatchAPIKey_FullMethodName, codes.PermissionDenied, 0)
+	for i := 0; i < 3; i++ {
+		stream, err := client.WatchAPIKey(context.Background(), &apiKeyProvider.APIKeyRequest{})
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+	factory.ClearErrors(apiKeyProvider.APIKeyProvider_WatchAPIKey_FullMethodName)
+	stream, err := client.WatchAPIKey(context.Background(), &apiKeyProvider.APIKeyRequest{})
+	assert.Nil(t, err)
+	apiKey, err := stream.Recv()
+	assert.Nil(t, err)
+	assert.Equal(t, "vpc-key", apiKey.GetApikey())
+
+	// Latency, bounded by the caller deadline
+	factory.SetLatency(apiKeyProvider.APIKeyProvider_GetVPCAPIKey_FullMethodName, 200*time.Millisecond)
+	start := time.Now()
+	_, err = client.GetVPCAPIKey(context.Background(), &apiKeyProvider.Provider{})
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.GetVPCAPIKey(ctx, &apiKeyProvider.Provider{})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// Connection failure
+	_, err = (&FakeGrpcSessionFactory{FailGrpcConnection: true, FailGrpcConnectionErr: "dial failed"}).NewGrpcSession().GrpcDialWithConfig(context.Background(), grpcClient.DialConfig{})
+	assert.EqualError(t, err, "dial failed")
+}
@@ -18,6 +18,8 @@
 package grpcclient
 
 import (
+	"context"
+
 	"google.golang.org/grpc"
 )
 
@@ -26,9 +28,10 @@ type GrpcSessionFactory interface {
 	NewGrpcSession() GrpcSession
 }
 
-// GrpcSession defines GrpcDial
+// GrpcSession defines GrpcDial and GrpcDialWithConfig
 type GrpcSession interface {
 	GrpcDial(cc ClientConn, target string, opts ...grpc.DialOption) (*grpc.ClientConn, error)
+	GrpcDialWithConfig(ctx context.Context, config DialConfig) (*grpc.ClientConn, error)
 }
 
 // ConnObjFactory defines empty object
@@ -46,7 +49,7 @@ type GrpcSes struct {
 	cc   ClientConn
 }
 
-// Connect creates a client connection to a given target
+// Connect creates a client connection to a given target with grpc.Dial, prefer ConnectWithConfig
 func (c *GrpcSes) Connect(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	var err error
 	c.conn, err = grpc.Dial(target, opts...)
@@ -0,0 +1,153 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpcclient ...
+package grpcclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// certReloader holds the certificates read from the TLS files and reads them again when a file is modified
+type certReloader struct {
+	config TLSConfig
+
+	mutex    sync.Mutex
+	modTimes map[string]time.Time
+	cert     *tls.Certificate
+	roots    *x509.CertPool
+}
+
+// newReloadingConfig returns a tls.Config reading the certificates on each handshake if they changed.
+// The server certificate is verified in VerifyConnection against the current CA, as RootCAs can not be updated.
+func (config *TLSConfig) newReloadingConfig() (*tls.Config, error) {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, errors.New("TLS client certificate and key files must be set together")
+	}
+	reloader := &certReloader{config: *config, modTimes: map[string]time.Time{}}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config.ServerName,
+		// #nosec G402: the server certificate is verified by VerifyConnection with the reloaded CA
+		InsecureSkipVerify: true,
+		VerifyConnection:   reloader.verifyConnection,
+	}
+	if config.CertFile != "" {
+		tlsConfig.GetClientCertificate = reloader.clientCertificate
+	}
+	return tlsConfig, nil
+}
+
+// reload reads the files again if any of them was modified since the last read. If reading fails the
+// previous certificates are kept, an error is only returned if there are none.
+func (reloader *certReloader) reload() error {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	modTimes := map[string]time.Time{}
+	changed := false
+	for _, path := range []string{reloader.config.CAFile, reloader.config.CertFile, reloader.config.KeyFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(filepath.Clean(path))
+		if err != nil {
+			return reloader.keepOrFail(err)
+		}
+		modTimes[path] = info.ModTime()
+		if !info.ModTime().Equal(reloader.modTimes[path]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	var roots *x509.CertPool
+	if reloader.config.CAFile != "" {
+		data, err := os.ReadFile(filepath.Clean(reloader.config.CAFile))
+		if err != nil {
+			return reloader.keepOrFail(err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return reloader.keepOrFail(fmt.Errorf("no certificate found in CA file %s", reloader.config.CAFile))
+		}
+	}
+	var cert *tls.Certificate
+	if reloader.config.CertFile != "" {
+		keyPair, err := tls.LoadX509KeyPair(reloader.config.CertFile, reloader.config.KeyFile)
+		if err != nil {
+			return reloader.keepOrFail(err)
+		}
+		cert = &keyPair
+	}
+	reloader.roots, reloader.cert, reloader.modTimes = roots, cert, modTimes
+	return nil
+}
+
+// keepOrFail returns err if no certificate was read yet, the caller must hold the mutex
+func (reloader *certReloader) keepOrFail(err error) error {
+	if len(reloader.modTimes) == 0 {
+		return err
+	}
+	return nil
+}
+
+// clientCertificate ...
+func (reloader *certReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	return reloader.cert, nil
+}
+
+// verifyConnection verifies the server certificate chain and name, as the default verification would
+func (reloader *certReloader) verifyConnection(state tls.ConnectionState) error {
+	if err := reloader.reload(); err != nil {
+		return err
+	}
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server did not present a certificate")
+	}
+	reloader.mutex.Lock()
+	roots := reloader.roots
+	reloader.mutex.Unlock()
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       state.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
@@ -19,7 +19,10 @@ package utils
 
 import (
 	"bytes"
+	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -117,3 +120,32 @@ func GetTestLogger(t *testing.T) (logger *zap.Logger, teardown func()) {
 	}
 	return
 }
+
+// ListenUnixSocket listens on the unix socket at socketPath with the given permissions. The directory is created
+// if missing and a stale socket of a previous run is removed, any other file at socketPath is an error.
+func ListenUnixSocket(socketPath string, perm os.FileMode) (net.Listener, error) {
+	socketPath = filepath.Clean(socketPath)
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0750); err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a unix socket", socketPath)
+		}
+		if err = os.Remove(socketPath); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(socketPath, perm); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -60,7 +60,7 @@ func TestNew(t *testing.T) {
 	}
 
 	configPath := filepath.Join(pwd, "..", "..", "test-fixtures", "slconfig.toml")
-	ibmCloudProvider, err := ibmcloudprovider.NewIBMCloudStorageProvider(configPath, logger)
+	ibmCloudProvider, err := ibmcloudprovider.NewIBMCloudStorageProvider(configPath, &fakes.Provider{}, logger)
 	assert.Nil(t, err)
 
 	watcher := New(logger, "ibm-csi-driver", ibmCloudProvider)
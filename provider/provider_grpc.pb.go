@@ -1,10 +1,27 @@
+// Copyright 2024 IBM Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: provider.proto
 
 package provider
 
 import (
 	context "context"
-
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
@@ -12,7 +29,15 @@ import (
 
 // This is a compile-time assertion to ensure that this generated file
 // is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion6
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	APIKeyProvider_GetVPCAPIKey_FullMethodName       = "/provider.APIKeyProvider/GetVPCAPIKey"
+	APIKeyProvider_GetContainerAPIKey_FullMethodName = "/provider.APIKeyProvider/GetContainerAPIKey"
+	APIKeyProvider_GetIAMToken_FullMethodName        = "/provider.APIKeyProvider/GetIAMToken"
+	APIKeyProvider_WatchAPIKey_FullMethodName        = "/provider.APIKeyProvider/WatchAPIKey"
+)
 
 // APIKeyProviderClient is the client API for APIKeyProvider service.
 //
@@ -22,6 +47,10 @@ type APIKeyProviderClient interface {
 	GetVPCAPIKey(ctx context.Context, in *Provider, opts ...grpc.CallOption) (*APIKey, error)
 	// Get Container API key
 	GetContainerAPIKey(ctx context.Context, in *Provider, opts ...grpc.CallOption) (*APIKey, error)
+	// Get an IAM token exchanged for the requested API key
+	GetIAMToken(ctx context.Context, in *APIKeyRequest, opts ...grpc.CallOption) (*IAMToken, error)
+	// Watch the requested API key, the current key is sent first and then the key after every rotation
+	WatchAPIKey(ctx context.Context, in *APIKeyRequest, opts ...grpc.CallOption) (APIKeyProvider_WatchAPIKeyClient, error)
 }
 
 type aPIKeyProviderClient struct {
@@ -34,7 +63,7 @@ func NewAPIKeyProviderClient(cc grpc.ClientConnInterface) APIKeyProviderClient {
 
 func (c *aPIKeyProviderClient) GetVPCAPIKey(ctx context.Context, in *Provider, opts ...grpc.CallOption) (*APIKey, error) {
 	out := new(APIKey)
-	err := c.cc.Invoke(ctx, "/provider.APIKeyProvider/GetVPCAPIKey", in, out, opts...)
+	err := c.cc.Invoke(ctx, APIKeyProvider_GetVPCAPIKey_FullMethodName, in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -43,25 +72,69 @@ func (c *aPIKeyProviderClient) GetVPCAPIKey(ctx context.Context, in *Provider, o
 
 func (c *aPIKeyProviderClient) GetContainerAPIKey(ctx context.Context, in *Provider, opts ...grpc.CallOption) (*APIKey, error) {
 	out := new(APIKey)
-	err := c.cc.Invoke(ctx, "/provider.APIKeyProvider/GetContainerAPIKey", in, out, opts...)
+	err := c.cc.Invoke(ctx, APIKeyProvider_GetContainerAPIKey_FullMethodName, in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
+func (c *aPIKeyProviderClient) GetIAMToken(ctx context.Context, in *APIKeyRequest, opts ...grpc.CallOption) (*IAMToken, error) {
+	out := new(IAMToken)
+	err := c.cc.Invoke(ctx, APIKeyProvider_GetIAMToken_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIKeyProviderClient) WatchAPIKey(ctx context.Context, in *APIKeyRequest, opts ...grpc.CallOption) (APIKeyProvider_WatchAPIKeyClient, error) {
+	stream, err := c.cc.NewStream(ctx, &APIKeyProvider_ServiceDesc.Streams[0], APIKeyProvider_WatchAPIKey_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &aPIKeyProviderWatchAPIKeyClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type APIKeyProvider_WatchAPIKeyClient interface {
+	Recv() (*APIKey, error)
+	grpc.ClientStream
+}
+
+type aPIKeyProviderWatchAPIKeyClient struct {
+	grpc.ClientStream
+}
+
+func (x *aPIKeyProviderWatchAPIKeyClient) Recv() (*APIKey, error) {
+	m := new(APIKey)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // APIKeyProviderServer is the server API for APIKeyProvider service.
-// All implementations must embed UnimplementedAPIKeyProviderServer
+// All implementations should embed UnimplementedAPIKeyProviderServer
 // for forward compatibility
 type APIKeyProviderServer interface {
 	// Get VPC API key
 	GetVPCAPIKey(context.Context, *Provider) (*APIKey, error)
 	// Get Container API key
 	GetContainerAPIKey(context.Context, *Provider) (*APIKey, error)
-	mustEmbedUnimplementedAPIKeyProviderServer()
+	// Get an IAM token exchanged for the requested API key
+	GetIAMToken(context.Context, *APIKeyRequest) (*IAMToken, error)
+	// Watch the requested API key, the current key is sent first and then the key after every rotation
+	WatchAPIKey(*APIKeyRequest, APIKeyProvider_WatchAPIKeyServer) error
 }
 
-// UnimplementedAPIKeyProviderServer must be embedded to have forward compatible implementations.
+// UnimplementedAPIKeyProviderServer should be embedded to have forward compatible implementations.
 type UnimplementedAPIKeyProviderServer struct {
 }
 
@@ -71,7 +144,12 @@ func (UnimplementedAPIKeyProviderServer) GetVPCAPIKey(context.Context, *Provider
 func (UnimplementedAPIKeyProviderServer) GetContainerAPIKey(context.Context, *Provider) (*APIKey, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetContainerAPIKey not implemented")
 }
-func (UnimplementedAPIKeyProviderServer) mustEmbedUnimplementedAPIKeyProviderServer() {}
+func (UnimplementedAPIKeyProviderServer) GetIAMToken(context.Context, *APIKeyRequest) (*IAMToken, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetIAMToken not implemented")
+}
+func (UnimplementedAPIKeyProviderServer) WatchAPIKey(*APIKeyRequest, APIKeyProvider_WatchAPIKeyServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchAPIKey not implemented")
+}
 
 // UnsafeAPIKeyProviderServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to APIKeyProviderServer will
@@ -80,8 +158,8 @@ type UnsafeAPIKeyProviderServer interface {
 	mustEmbedUnimplementedAPIKeyProviderServer()
 }
 
-func RegisterAPIKeyProviderServer(s *grpc.Server, srv APIKeyProviderServer) {
-	s.RegisterService(&_APIKeyProvider_serviceDesc, srv)
+func RegisterAPIKeyProviderServer(s grpc.ServiceRegistrar, srv APIKeyProviderServer) {
+	s.RegisterService(&APIKeyProvider_ServiceDesc, srv)
 }
 
 func _APIKeyProvider_GetVPCAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
@@ -94,7 +172,7 @@ func _APIKeyProvider_GetVPCAPIKey_Handler(srv interface{}, ctx context.Context,
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/provider.APIKeyProvider/GetVPCAPIKey",
+		FullMethod: APIKeyProvider_GetVPCAPIKey_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
 		return srv.(APIKeyProviderServer).GetVPCAPIKey(ctx, req.(*Provider))
@@ -112,7 +190,7 @@ func _APIKeyProvider_GetContainerAPIKey_Handler(srv interface{}, ctx context.Con
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/provider.APIKeyProvider/GetContainerAPIKey",
+		FullMethod: APIKeyProvider_GetContainerAPIKey_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
 		return srv.(APIKeyProviderServer).GetContainerAPIKey(ctx, req.(*Provider))
@@ -120,10 +198,49 @@ func _APIKeyProvider_GetContainerAPIKey_Handler(srv interface{}, ctx context.Con
 	return interceptor(ctx, in, info, handler)
 }
 
-// APIKeyProvider_serviceDesc is the grpc.ServiceDesc for APIKeyProvider service.
+func _APIKeyProvider_GetIAMToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIKeyProviderServer).GetIAMToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: APIKeyProvider_GetIAMToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIKeyProviderServer).GetIAMToken(ctx, req.(*APIKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _APIKeyProvider_WatchAPIKey_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(APIKeyRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(APIKeyProviderServer).WatchAPIKey(m, &aPIKeyProviderWatchAPIKeyServer{stream})
+}
+
+type APIKeyProvider_WatchAPIKeyServer interface {
+	Send(*APIKey) error
+	grpc.ServerStream
+}
+
+type aPIKeyProviderWatchAPIKeyServer struct {
+	grpc.ServerStream
+}
+
+func (x *aPIKeyProviderWatchAPIKeyServer) Send(m *APIKey) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// APIKeyProvider_ServiceDesc is the grpc.ServiceDesc for APIKeyProvider service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
-var _APIKeyProvider_serviceDesc = grpc.ServiceDesc{
+var APIKeyProvider_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "provider.APIKeyProvider",
 	HandlerType: (*APIKeyProviderServer)(nil),
 	Methods: []grpc.MethodDesc{
@@ -135,7 +252,17 @@ var _APIKeyProvider_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetContainerAPIKey",
 			Handler:    _APIKeyProvider_GetContainerAPIKey_Handler,
 		},
+		{
+			MethodName: "GetIAMToken",
+			Handler:    _APIKeyProvider_GetIAMToken_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchAPIKey",
+			Handler:       _APIKeyProvider_WatchAPIKey_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "provider.proto",
 }
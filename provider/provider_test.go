@@ -0,0 +1,67 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TestWireCompatibility checks that messages of the clients and servers built before
+// the metadata fields were added are still understood, and the other way round
+func TestWireCompatibility(t *testing.T) {
+	// Requests of old clients had no field
+	request := &Provider{}
+	assert.Nil(t, proto.Unmarshal(nil, request))
+	assert.Equal(t, "", request.GetProviderName())
+	data, err := proto.Marshal(&Provider{})
+	assert.Nil(t, err)
+	assert.Empty(t, data)
+
+	// Old servers only set the API key in field 1
+	oldResponse := protowire.AppendTag(nil, 1, protowire.BytesType)
+	oldResponse = protowire.AppendString(oldResponse, "api-key")
+	response := &APIKey{}
+	assert.Nil(t, proto.Unmarshal(oldResponse, response))
+	assert.Equal(t, "api-key", response.GetApikey())
+	assert.Equal(t, "", response.GetKeyId())
+	assert.Nil(t, response.GetExpiresAt())
+
+	// Old clients read field 1 and skip the new ones
+	data, err = proto.Marshal(&APIKey{Apikey: "api-key", KeyId: "key-id", ExpiresAt: timestamppb.New(time.Now())})
+	assert.Nil(t, err)
+	var apiKey string
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		assert.True(t, n > 0)
+		data = data[n:]
+		if number == 1 {
+			value, m := protowire.ConsumeString(data)
+			apiKey, n = value, m
+		} else {
+			n = protowire.ConsumeFieldValue(number, wireType, data)
+		}
+		assert.True(t, n > 0)
+		data = data[n:]
+	}
+	assert.Equal(t, "api-key", apiKey)
+}